@@ -403,6 +403,70 @@ const (
 	AggFuncMin = "min"
 	// AggFuncGroupConcat is the name of group_concat function.
 	AggFuncGroupConcat = "group_concat"
+	// AggFuncMedian is the name of median function.
+	AggFuncMedian = "median"
+	// AggFuncAnyValue is the name of any_value function.
+	AggFuncAnyValue = "any_value"
+	// AggFuncBitAnd is the name of bit_and function.
+	AggFuncBitAnd = "bit_and"
+	// AggFuncBitOr is the name of bit_or function.
+	AggFuncBitOr = "bit_or"
+	// AggFuncBitXor is the name of bit_xor function.
+	AggFuncBitXor = "bit_xor"
+	// AggFuncFirstValue is the name of first_value function.
+	AggFuncFirstValue = "first_value"
+	// AggFuncLastValue is the name of last_value function.
+	AggFuncLastValue = "last_value"
+	// AggFuncStd is the name of std function, it's a synonym for stddev_pop.
+	AggFuncStd = "std"
+	// AggFuncStddevPop is the name of stddev_pop function.
+	AggFuncStddevPop = "stddev_pop"
+	// AggFuncVarPop is the name of var_pop function.
+	AggFuncVarPop = "var_pop"
+	// AggFuncJSONArrayAgg is the name of json_arrayagg function.
+	AggFuncJSONArrayAgg = "json_arrayagg"
+	// AggFuncJSONObjectAgg is the name of json_objectagg function.
+	AggFuncJSONObjectAgg = "json_objectagg"
+	// AggFuncPercentileCont is the name of percentile_cont function.
+	AggFuncPercentileCont = "percentile_cont"
+	// AggFuncWAvg is the name of wavg function.
+	AggFuncWAvg = "wavg"
+	// AggFuncCollectSet is the name of collect_set function.
+	AggFuncCollectSet = "collect_set"
+	// AggFuncHistogram is the name of histogram function.
+	AggFuncHistogram = "histogram"
+	// AggFuncApproxCountDistinct is the name of approx_count_distinct function.
+	AggFuncApproxCountDistinct = "approx_count_distinct"
+	// AggFuncMaxKeep is the name of max_keep function.
+	AggFuncMaxKeep = "max_keep"
+	// AggFuncMinKeep is the name of min_keep function.
+	AggFuncMinKeep = "min_keep"
+	// AggFuncMode is the name of mode function.
+	AggFuncMode = "mode"
+	// AggFuncMAD is the name of mad function, the median absolute deviation.
+	AggFuncMAD = "mad"
+	// AggFuncCountIf is the name of countif function.
+	AggFuncCountIf = "countif"
+	// AggFuncCorr is the name of corr function, the Pearson correlation coefficient.
+	AggFuncCorr = "corr"
+	// AggFuncFirst is the name of first function, the first non-NULL value in the input order.
+	AggFuncFirst = "first"
+	// AggFuncLast is the name of last function, the last non-NULL value in the input order.
+	AggFuncLast = "last"
+	// AggFuncCovarPop is the name of covar_pop function, the population covariance.
+	AggFuncCovarPop = "covar_pop"
+	// AggFuncCovarSamp is the name of covar_samp function, the sample covariance.
+	AggFuncCovarSamp = "covar_samp"
+	// AggFuncApproxPercentile is the name of approx_percentile function, the percentile_cont estimated by a t-digest.
+	AggFuncApproxPercentile = "approx_percentile"
+	// AggFuncArgMax is the name of arg_max function, the value of the row with the maximum order value.
+	AggFuncArgMax = "arg_max"
+	// AggFuncArgMin is the name of arg_min function, the value of the row with the minimum order value.
+	AggFuncArgMin = "arg_min"
+	// AggFuncJSONMergeAgg is the name of json_merge_agg function, which merges the JSON documents like JSON_MERGE_PRESERVE.
+	AggFuncJSONMergeAgg = "json_merge_agg"
+	// AggFuncTopK is the name of topk function, the approximate k most frequent values estimated by Space-Saving.
+	AggFuncTopK = "topk"
 )
 
 // AggregateFuncExpr represents aggregate function expression.
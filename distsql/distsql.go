@@ -261,6 +261,7 @@ func SelectDAG(client kv.Client, ctx goctx.Context, dag *tipb.DAGRequest, keyRan
 		Desc:           desc,
 		IsolationLevel: isolationLevel,
 		Priority:       priority,
+		StartTs:        dag.StartTs,
 	}
 	kvReq.Data, err = dag.Marshal()
 	if err != nil {
@@ -299,6 +300,7 @@ func Analyze(client kv.Client, ctx goctx.Context, req *tipb.AnalyzeReq, keyRange
 		Desc:           false,
 		IsolationLevel: kv.RC,
 		Priority:       priority,
+		StartTs:        req.StartTs,
 	}
 	kvReq.Data, err = req.Marshal()
 	if err != nil {
@@ -326,6 +328,7 @@ func composeRequest(req *tipb.SelectRequest, keyRanges []kv.KeyRange, concurrenc
 		KeyRanges:      keyRanges,
 		IsolationLevel: isolationLevel,
 		Priority:       priority,
+		StartTs:        req.StartTs,
 	}
 	if req.IndexInfo != nil {
 		kvReq.Tp = kv.ReqTypeIndex
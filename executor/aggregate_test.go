@@ -353,4 +353,10 @@ func (s *testSuite) TestAggPushDown(c *C) {
 	tk.MustExec("insert into tt values(1, 2, 1)")
 	tk.MustQuery("select max(a.b), max(b.b) from t a join tt b on a.a = b.a group by a.c").Check(testkit.Rows("1 2"))
 	tk.MustQuery("select a, count(b) from (select * from t union all select * from tt) k group by a").Check(testkit.Rows("1 2", "2 1"))
+
+	// The aggregation is pushed down to the inner side of the outer join, the
+	// unmatched rows use the default values of count and sum.
+	tk.MustExec("insert into t values(3, 1, 2)")
+	tk.MustQuery("select a.a, count(b.b), sum(b.b) from t a left join tt b on a.c = b.c group by a.a").Check(testkit.Rows("1 1 2", "2 1 2", "3 0 <nil>"))
+	tk.MustQuery("select b.a, count(a.b), sum(a.b) from tt a right join t b on a.c = b.c group by b.a").Check(testkit.Rows("1 1 2", "2 1 2", "3 0 <nil>"))
 }
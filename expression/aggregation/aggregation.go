@@ -37,6 +37,12 @@ type Aggregation interface {
 
 	// GetPartialResult will called by coprocessor to get partial results. For avg function, partial results will return
 	// sum and count values at the same time.
+	// The partial results are the arguments of the same function in FinalMode, which merges them. The layout is the
+	// count first if the function needs it, then the value, see needCount and needValue in the plan package:
+	//   count:   [count], the count is int64.
+	//   max/min: [value], the value is NULL if the group has no non-NULL values.
+	//   sum:     [sum], the sum is decimal or float64, or NULL if the group has no non-NULL values.
+	//   avg:     [count, sum].
 	GetPartialResult(groupKey []byte) []types.Datum
 
 	// StreamUpdate updates data using streaming algo.
@@ -66,6 +72,10 @@ type Aggregation interface {
 	// Reset resets this aggregate function.
 	Reset()
 
+	// ResetContext resets the evaluation context of the group in place, so the
+	// group can be evaluated again without allocating a new context.
+	ResetContext(groupKey []byte)
+
 	// IsDistinct indicates if the aggregate function contains distinct attribute.
 	IsDistinct() bool
 
@@ -93,17 +103,102 @@ func NewAggFunction(funcType string, funcArgs []expression.Expression, distinct
 	case ast.AggFuncSum:
 		return &sumFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
 	case ast.AggFuncCount:
-		return &countFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+		return &countFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), isStar: isCountStar(funcArgs)}
 	case ast.AggFuncAvg:
 		return &avgFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
 	case ast.AggFuncGroupConcat:
-		return &concatFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+		return &concatFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), separator: defaultGroupConcatSeparator}
 	case ast.AggFuncMax:
 		return &maxMinFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), isMax: true}
 	case ast.AggFuncMin:
 		return &maxMinFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), isMax: false}
 	case ast.AggFuncFirstRow:
 		return &firstRowFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncMedian:
+		return &medianFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncAnyValue:
+		return &anyValueFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncBitAnd:
+		return newBitAndFunction(newAggFunc(tp, funcArgs, distinct))
+	case ast.AggFuncBitOr:
+		return newBitOrFunction(newAggFunc(tp, funcArgs, distinct))
+	case ast.AggFuncBitXor:
+		return newBitXorFunction(newAggFunc(tp, funcArgs, distinct))
+	case ast.AggFuncFirstValue:
+		return &firstLastFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncLastValue:
+		return &firstLastFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), desc: true}
+	case ast.AggFuncStd, ast.AggFuncStddevPop:
+		return &varianceFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), isStd: true}
+	case ast.AggFuncVarPop:
+		return &varianceFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncJSONArrayAgg:
+		return &jsonArrayAggFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncPercentileCont:
+		return &percentileContFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncWAvg:
+		return &wavgFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncCollectSet:
+		return &collectSetFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncHistogram:
+		return &histogramFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncApproxCountDistinct:
+		return &approxCountDistinctFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncMaxKeep:
+		return &keepFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), isMax: true}
+	case ast.AggFuncMinKeep:
+		return &keepFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncArgMax:
+		return &keepFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), isMax: true, orderLast: true}
+	case ast.AggFuncArgMin:
+		return &keepFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), orderLast: true}
+	case ast.AggFuncMode:
+		return &modeFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncMAD:
+		return &madFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncCountIf:
+		return &countIfFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncJSONObjectAgg:
+		return &jsonObjectAggFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncJSONMergeAgg:
+		return &jsonMergeAggFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncTopK:
+		return &topKFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncCorr:
+		return &corrFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncCovarPop:
+		return &covarFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncCovarSamp:
+		return &covarFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), sample: true}
+	case ast.AggFuncApproxPercentile:
+		return &approxPercentileFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncFirst:
+		return &firstLastNonNullFunction{aggFunction: newAggFunc(tp, funcArgs, distinct)}
+	case ast.AggFuncLast:
+		return &firstLastNonNullFunction{aggFunction: newAggFunc(tp, funcArgs, distinct), isLast: true}
+	}
+	return nil
+}
+
+// SlidingAggregation is an Aggregation which supports removing rows, so it can be
+// evaluated over the moving frame of a window without recomputing the frame.
+type SlidingAggregation interface {
+	Aggregation
+
+	// Remove removes row from the group, the rows of a group must be removed in
+	// the order they're updated. GetGroupResult returns the result of the rows
+	// not removed yet.
+	Remove(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error
+}
+
+// NewSlidingAggFunction creates a SlidingAggregation, it returns nil if the
+// function doesn't support sliding, only max and min are supported now.
+func NewSlidingAggFunction(funcType string, funcArgs []expression.Expression) SlidingAggregation {
+	switch tp := strings.ToLower(funcType); tp {
+	case ast.AggFuncMax:
+		return &slidingMaxMinFunction{maxMinFunction{aggFunction: newAggFunc(tp, funcArgs, false), isMax: true}}
+	case ast.AggFuncMin:
+		return &slidingMaxMinFunction{maxMinFunction{aggFunction: newAggFunc(tp, funcArgs, false)}}
 	}
 	return nil
 }
@@ -122,7 +217,7 @@ func NewDistAggFunc(expr *tipb.Expr, fieldTps []*types.FieldType, sc *variable.S
 	case tipb.ExprType_Sum:
 		return &sumFunction{aggFunction: newAggFunc(ast.AggFuncSum, args, false)}, nil
 	case tipb.ExprType_Count:
-		return &countFunction{aggFunction: newAggFunc(ast.AggFuncCount, args, false)}, nil
+		return &countFunction{aggFunction: newAggFunc(ast.AggFuncCount, args, false), isStar: isCountStar(args)}, nil
 	case tipb.ExprType_Avg:
 		return &avgFunction{aggFunction: newAggFunc(ast.AggFuncAvg, args, false)}, nil
 	case tipb.ExprType_GroupConcat:
@@ -142,8 +237,27 @@ type aggEvaluateContext struct {
 	DistinctChecker *distinctChecker
 	Count           int64
 	Value           types.Datum
-	Buffer          *bytes.Buffer // Buffer is used for group_concat.
-	GotFirstRow     bool          // It will check if the agg has met the first row key.
+	Buffer          *bytes.Buffer   // Buffer is used for group_concat.
+	GotFirstRow     bool            // It will check if the agg has met the first row key.
+	Values          []types.Datum   // Values buffers all the input values, used for median and json_arrayagg.
+	OrderValue      types.Datum     // OrderValue is the order argument of the latched row, used for first_value, last_value, max_keep and min_keep.
+	Mean            float64         // Mean is the running mean of Welford's algorithm, used for variance and standard deviation.
+	M2              float64         // M2 is the running sum of squared differences from the mean, used with Mean.
+	Weight          types.Datum     // Weight is the sum of the weights, used for wavg.
+	Set             *datumSet       // Set holds the distinct values in arrival order, used for collect_set.
+	Buckets         map[int64]int64 // Buckets maps the bucket index to the count of values in it, used for histogram.
+	Sketch          *hllSketch      // Sketch is the HyperLogLog sketch of the values, used for approx_count_distinct.
+	Counter         *datumCounter   // Counter counts the occurrences of the values, used for mode.
+	// Members maps the keys to the JSON values, used for json_objectagg.
+	Members map[string]types.Datum
+	// Window holds the candidates of the frame, used for sliding max and min.
+	Window *maxMinWindow
+	// Moments is the running means and co-moments of the pairs, used for corr and covariance.
+	Moments *coMoments
+	// Digest is the t-digest of the values, used for approx_percentile.
+	Digest *tDigest
+	// TopK is the Space-Saving counters of the values, used for topk.
+	TopK *spaceSaving
 }
 
 type aggCtxMapper map[string]*aggEvaluateContext
@@ -231,6 +345,18 @@ func (af *aggFunction) Reset() {
 	af.streamCtx = nil
 }
 
+// ResetContext implements Aggregation interface.
+func (af *aggFunction) ResetContext(groupKey []byte) {
+	ctx, ok := af.resultMapper[string(groupKey)]
+	if !ok {
+		return
+	}
+	*ctx = aggEvaluateContext{}
+	if af.Distinct {
+		ctx.DistinctChecker = createDistinctChecker()
+	}
+}
+
 // GetName implements Aggregation interface.
 func (af *aggFunction) GetName() string {
 	return af.name
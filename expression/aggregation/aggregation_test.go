@@ -0,0 +1,1817 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/ast"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/mock"
+	"github.com/pingcap/tidb/util/testleak"
+	"github.com/pingcap/tidb/util/types"
+	"github.com/pingcap/tidb/util/types/json"
+)
+
+var _ = Suite(&testAggFuncSuite{})
+
+type testAggFuncSuite struct {
+}
+
+func newColumnWithType(tp byte, idx int) *expression.Column {
+	return &expression.Column{
+		RetType: types.NewFieldType(tp),
+		Index:   idx,
+	}
+}
+
+// updateAll feeds every row into the group of groupKey and the stream context of f.
+func updateAll(c *C, f Aggregation, groupKey []byte, rows [][]types.Datum) {
+	sc := new(variable.StatementContext)
+	for _, row := range rows {
+		c.Assert(f.Update(row, groupKey, sc), IsNil)
+		c.Assert(f.StreamUpdate(row, sc), IsNil)
+	}
+}
+
+func (s *testAggFuncSuite) TestMedian(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	tests := []struct {
+		tp     byte
+		values []interface{}
+		expect interface{}
+	}{
+		{mysql.TypeLonglong, []interface{}{3, nil, 1, 2}, types.NewDecFromInt(2)},
+		{mysql.TypeLonglong, []interface{}{4, 1, nil, 3, 2}, types.NewDecFromFloatForTest(2.5)},
+		{mysql.TypeDouble, []interface{}{1.5, 0.5, 2.0, 1.0}, 1.25},
+		{mysql.TypeNewDecimal, []interface{}{types.NewDecFromInt(1), types.NewDecFromInt(2)}, types.NewDecFromFloatForTest(1.5)},
+		{mysql.TypeVarString, []interface{}{"b", "d", "a", "c"}, "b"},
+		{mysql.TypeLonglong, []interface{}{nil, nil}, nil},
+		{mysql.TypeLonglong, []interface{}{}, nil},
+	}
+	for _, t := range tests {
+		median := NewAggFunction(ast.AggFuncMedian, []expression.Expression{newColumnWithType(t.tp, 0)}, false)
+		var rows [][]types.Datum
+		for _, v := range t.values {
+			rows = append(rows, types.MakeDatums(v))
+		}
+		updateAll(c, median, nil, rows)
+		expect := types.NewDatum(t.expect)
+		for _, d := range []types.Datum{median.GetGroupResult(nil), median.GetPartialResult(nil)[0], median.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, expect.Kind(), Commentf("%v: got %v", t.values, d))
+			cmp, err := d.CompareDatum(sc, expect)
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("%v: got %v", t.values, d))
+		}
+	}
+
+	median := NewAggFunction(ast.AggFuncMedian, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	c.Assert(median.GetType().Tp, Equals, mysql.TypeNewDecimal)
+	c.Assert(median.GetType().Flen, Equals, mysql.MaxDecimalWidth)
+	median = NewAggFunction(ast.AggFuncMedian, []expression.Expression{newColumnWithType(mysql.TypeVarString, 0)}, false)
+	c.Assert(median.GetType().Tp, Equals, mysql.TypeVarString)
+
+	// Groups are calculated separately, and the cloned function doesn't share them.
+	updateAll(c, median, []byte("a"), [][]types.Datum{types.MakeDatums("x")})
+	updateAll(c, median, []byte("b"), [][]types.Datum{types.MakeDatums("y")})
+	d := median.GetGroupResult([]byte("a"))
+	c.Assert(d.GetString(), Equals, "x")
+	d = median.GetGroupResult([]byte("b"))
+	c.Assert(d.GetString(), Equals, "y")
+	d = median.Clone().GetGroupResult([]byte("a"))
+	c.Assert(d.IsNull(), IsTrue)
+}
+
+func (s *testAggFuncSuite) TestMAD(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	tests := []struct {
+		tp     byte
+		values []interface{}
+		expect interface{}
+	}{
+		// The median is 2, the deviations are 0, 0, 1, 1, 2, 4, 7.
+		{mysql.TypeLonglong, []interface{}{1, 1, 2, 2, nil, 4, 6, 9}, types.NewDecFromInt(1)},
+		// The median is 2.5, the deviations are 0.5, 0.5, 1.5, 1.5.
+		{mysql.TypeLonglong, []interface{}{4, 1, 3, 2}, types.NewDecFromInt(1)},
+		// The median is 1.25, the deviations are 0.25, 0.25, 0.75, 0.75.
+		{mysql.TypeDouble, []interface{}{1.5, 0.5, 2.0, 1.0}, 0.5},
+		{mysql.TypeNewDecimal, []interface{}{types.NewDecFromFloatForTest(-1.5), types.NewDecFromInt(3), types.NewDecFromInt(-4)}, types.NewDecFromFloatForTest(2.5)},
+		{mysql.TypeLonglong, []interface{}{7}, types.NewDecFromInt(0)},
+		{mysql.TypeLonglong, []interface{}{nil, nil}, nil},
+		{mysql.TypeLonglong, []interface{}{}, nil},
+	}
+	for _, t := range tests {
+		mad := NewAggFunction(ast.AggFuncMAD, []expression.Expression{newColumnWithType(t.tp, 0)}, false)
+		var rows [][]types.Datum
+		for _, v := range t.values {
+			rows = append(rows, types.MakeDatums(v))
+		}
+		updateAll(c, mad, nil, rows)
+		expect := types.NewDatum(t.expect)
+		for _, d := range []types.Datum{mad.GetGroupResult(nil), mad.GetPartialResult(nil)[0], mad.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, expect.Kind(), Commentf("%v: got %v", t.values, d))
+			cmp, err := d.CompareDatum(sc, expect)
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("%v: got %v", t.values, d))
+		}
+	}
+
+	mad := NewAggFunction(ast.AggFuncMAD, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	c.Assert(mad.GetType().Tp, Equals, mysql.TypeNewDecimal)
+	mad = NewAggFunction(ast.AggFuncMAD, []expression.Expression{newColumnWithType(mysql.TypeDouble, 0)}, false)
+	c.Assert(mad.GetType().Tp, Equals, mysql.TypeDouble)
+}
+
+func (s *testAggFuncSuite) TestAnyValue(c *C) {
+	defer testleak.AfterTest(c)()
+	anyValue := NewAggFunction(ast.AggFuncAnyValue, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	c.Assert(anyValue.GetType().Tp, Equals, mysql.TypeLonglong)
+
+	updateAll(c, anyValue, []byte("a"), [][]types.Datum{types.MakeDatums(3), types.MakeDatums(1), types.MakeDatums(nil)})
+	updateAll(c, anyValue, []byte("b"), [][]types.Datum{types.MakeDatums(nil), types.MakeDatums(2)})
+	d := anyValue.GetGroupResult([]byte("a"))
+	c.Assert(d.GetInt64(), Equals, int64(3))
+	partial := anyValue.GetPartialResult([]byte("a"))
+	c.Assert(partial, HasLen, 1)
+	c.Assert(partial[0].GetInt64(), Equals, int64(3))
+	// NULL is latched as well.
+	d = anyValue.GetGroupResult([]byte("b"))
+	c.Assert(d.IsNull(), IsTrue)
+	d = anyValue.GetGroupResult([]byte("c"))
+	c.Assert(d.IsNull(), IsTrue)
+
+	// The streamed context saw group "a" first, so it keeps the first value of "a".
+	d = anyValue.GetStreamResult()
+	c.Assert(d.GetInt64(), Equals, int64(3))
+	updateAll(c, anyValue, nil, [][]types.Datum{types.MakeDatums(5), types.MakeDatums(6)})
+	d = anyValue.GetStreamResult()
+	c.Assert(d.GetInt64(), Equals, int64(5))
+	d = anyValue.GetStreamResult()
+	c.Assert(d.IsNull(), IsTrue)
+}
+
+func (s *testAggFuncSuite) TestBitFuncs(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		name   string
+		values []interface{}
+		expect uint64
+	}{
+		{ast.AggFuncBitAnd, []interface{}{7, nil, 13}, 5},
+		{ast.AggFuncBitAnd, []interface{}{-1, uint64(6)}, 6},
+		{ast.AggFuncBitAnd, []interface{}{nil}, math.MaxUint64},
+		{ast.AggFuncBitAnd, []interface{}{}, math.MaxUint64},
+		{ast.AggFuncBitOr, []interface{}{1, nil, 4, "2"}, 7},
+		{ast.AggFuncBitOr, []interface{}{nil}, 0},
+		{ast.AggFuncBitXor, []interface{}{3, 5, nil, 1}, 7},
+		{ast.AggFuncBitXor, []interface{}{}, 0},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(t.name, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeLonglong)
+		c.Assert(mysql.HasUnsignedFlag(f.GetType().Flag), IsTrue)
+		var rows [][]types.Datum
+		for _, v := range t.values {
+			rows = append(rows, types.MakeDatums(v))
+		}
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, types.KindUint64)
+			c.Assert(d.GetUint64(), Equals, t.expect, Commentf("%s%v", t.name, t.values))
+		}
+	}
+}
+
+func (s *testAggFuncSuite) TestMaxMinCollation(c *C) {
+	defer testleak.AfterTest(c)()
+	rows := [][]types.Datum{types.MakeDatums("B"), types.MakeDatums("a"), types.MakeDatums(nil), types.MakeDatums("C")}
+	tests := []struct {
+		collation string
+		isMax     bool
+		expect    string
+	}{
+		{"utf8_bin", true, "a"},
+		{"utf8_general_ci", true, "C"},
+		{"utf8_bin", false, "B"},
+		{"utf8_general_ci", false, "a"},
+	}
+	for _, t := range tests {
+		col := newColumnWithType(mysql.TypeVarString, 0)
+		col.RetType.Charset, col.RetType.Collate = "utf8", t.collation
+		name := ast.AggFuncMin
+		if t.isMax {
+			name = ast.AggFuncMax
+		}
+		f := NewAggFunction(name, []expression.Expression{col}, false)
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetStreamResult()} {
+			c.Assert(d.GetString(), Equals, t.expect, Commentf("%s %s", name, t.collation))
+		}
+	}
+}
+
+func (s *testAggFuncSuite) TestMaxMinResultType(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		tp     byte
+		isMax  bool
+		rows   [][]types.Datum
+		kind   byte
+		expect string
+	}{
+		{mysql.TypeNewDecimal, false, [][]types.Datum{types.MakeDatums(int64(1)), types.MakeDatums(types.NewDecFromFloatForTest(2.5))}, types.KindMysqlDecimal, "1"},
+		{mysql.TypeNewDecimal, true, [][]types.Datum{types.MakeDatums(types.NewDecFromFloatForTest(0.5)), types.MakeDatums(int64(3))}, types.KindMysqlDecimal, "3"},
+		{mysql.TypeDouble, false, [][]types.Datum{types.MakeDatums(float64(2.5)), types.MakeDatums(int64(1)), types.MakeDatums(nil)}, types.KindFloat64, "1"},
+		{mysql.TypeLonglong, true, [][]types.Datum{types.MakeDatums(uint64(3)), types.MakeDatums(int64(1))}, types.KindUint64, "3"},
+	}
+	for _, t := range tests {
+		name := ast.AggFuncMin
+		if t.isMax {
+			name = ast.AggFuncMax
+		}
+		f := NewAggFunction(name, []expression.Expression{newColumnWithType(t.tp, 0)}, false)
+		c.Assert(f.GetType().Tp, Equals, t.tp)
+		updateAll(c, f, nil, t.rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, t.kind, Commentf("%s %v", name, t.rows))
+			s, err := d.ToString()
+			c.Assert(err, IsNil)
+			c.Assert(s, Equals, t.expect)
+		}
+	}
+}
+
+func (s *testAggFuncSuite) TestMaxMinTime(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	// The DST of New York starts at 2017-03-12 02:00:00, the wall clock skips to 03:00:00.
+	loc, err := time.LoadLocation("America/New_York")
+	if err == nil {
+		sc.TimeZone = loc
+	}
+	parseTime := func(str string, fsp int) types.Datum {
+		t, err := types.ParseTime(str, mysql.TypeDatetime, fsp)
+		c.Assert(err, IsNil)
+		return types.NewDatum(t)
+	}
+	parseDuration := func(str string, fsp int) types.Datum {
+		dur, err := types.ParseDuration(str, fsp)
+		c.Assert(err, IsNil)
+		return types.NewDatum(dur)
+	}
+	tests := []struct {
+		tp        byte
+		values    []types.Datum
+		expectMax string
+		expectMin string
+	}{
+		{
+			mysql.TypeDatetime,
+			[]types.Datum{parseTime("2017-03-12 01:59:59.5", 1), parseTime("2017-03-12 03:00:00", 0), parseTime("2017-03-12 01:59:59.25", 2), {}},
+			"2017-03-12 03:00:00.00", "2017-03-12 01:59:59.25",
+		},
+		{
+			mysql.TypeDuration,
+			[]types.Datum{parseDuration("10:00:00.5", 1), parseDuration("10:00:00", 0), parseDuration("10:00:00.25", 2)},
+			"10:00:00.50", "10:00:00.00",
+		},
+	}
+	for _, t := range tests {
+		col := newColumnWithType(t.tp, 0)
+		col.RetType.Decimal = 2
+		for _, name := range []string{ast.AggFuncMax, ast.AggFuncMin} {
+			f := NewAggFunction(name, []expression.Expression{col}, false)
+			c.Assert(f.GetType().Decimal, Equals, 2)
+			for _, v := range t.values {
+				c.Assert(f.Update([]types.Datum{v}, nil, sc), IsNil)
+				c.Assert(f.StreamUpdate([]types.Datum{v}, sc), IsNil)
+			}
+			expect := t.expectMin
+			if name == ast.AggFuncMax {
+				expect = t.expectMax
+			}
+			for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetStreamResult()} {
+				str, err := d.ToString()
+				c.Assert(err, IsNil)
+				c.Assert(str, Equals, expect, Commentf("%s %v", name, t.values))
+			}
+		}
+	}
+}
+
+func (s *testAggFuncSuite) TestSlidingMaxMin(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	values := []interface{}{3, 1, nil, 4, 1, 5, nil, nil, nil, 9, 2, 6, 5, 3, 5, 8, 9, 7, 9}
+	col := newColumnWithType(mysql.TypeLonglong, 0)
+	for _, name := range []string{ast.AggFuncMax, ast.AggFuncMin} {
+		for _, frame := range []int{1, 3, 5} {
+			f := NewSlidingAggFunction(name, []expression.Expression{col})
+			for i, v := range values {
+				c.Assert(f.Update(types.MakeDatums(v), nil, sc), IsNil)
+				start := i + 1 - frame
+				if start > 0 {
+					c.Assert(f.Remove(types.MakeDatums(values[start-1]), nil, sc), IsNil)
+				} else {
+					start = 0
+				}
+				expect := NewAggFunction(name, []expression.Expression{col}, false)
+				for _, w := range values[start : i+1] {
+					c.Assert(expect.Update(types.MakeDatums(w), nil, sc), IsNil)
+				}
+				d, e := f.GetGroupResult(nil), expect.GetGroupResult(nil)
+				cmp, err := d.CompareDatum(sc, e)
+				c.Assert(err, IsNil)
+				c.Assert(cmp, Equals, 0, Commentf("%s frame %d row %d: got %v, expect %v", name, frame, i, d.GetValue(), e.GetValue()))
+			}
+		}
+	}
+
+	// The frame becomes empty after removing all the rows.
+	f := NewSlidingAggFunction(ast.AggFuncMax, []expression.Expression{col})
+	c.Assert(f.Update(types.MakeDatums(1), nil, sc), IsNil)
+	c.Assert(f.Remove(types.MakeDatums(1), nil, sc), IsNil)
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+	c.Assert(f.Remove(types.MakeDatums(1), nil, sc), NotNil)
+
+	c.Assert(NewSlidingAggFunction(ast.AggFuncSum, []expression.Expression{col}), IsNil)
+	// The plain max doesn't support removing rows.
+	plain := NewAggFunction(ast.AggFuncMax, []expression.Expression{col}, false)
+	_, ok := plain.(SlidingAggregation)
+	c.Assert(ok, IsFalse)
+}
+
+const slidingMaxFrameSize = 1024
+
+// newSlidingMaxBench returns a sliding max and the rows of a sawtooth, so the
+// max leaves the frame regularly.
+func newSlidingMaxBench() (SlidingAggregation, [][]types.Datum) {
+	f := NewSlidingAggFunction(ast.AggFuncMax, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)})
+	rows := make([][]types.Datum, 4*slidingMaxFrameSize)
+	for i := range rows {
+		rows[i] = types.MakeDatums(int64(i * 7919 % 1000))
+	}
+	return f, rows
+}
+
+// BenchmarkSlidingMaxRecompute moves the frame by a row and recomputes max over the whole frame.
+func BenchmarkSlidingMaxRecompute(b *testing.B) {
+	f, rows := newSlidingMaxBench()
+	sc := new(variable.StatementContext)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.ResetContext(nil)
+		for j := 0; j < slidingMaxFrameSize; j++ {
+			f.Update(rows[(i+j)%len(rows)], nil, sc)
+		}
+		f.GetGroupResult(nil)
+	}
+}
+
+// BenchmarkSlidingMaxDeque moves the frame by a row with Update and Remove.
+func BenchmarkSlidingMaxDeque(b *testing.B) {
+	f, rows := newSlidingMaxBench()
+	sc := new(variable.StatementContext)
+	for j := 0; j < slidingMaxFrameSize; j++ {
+		f.Update(rows[j], nil, sc)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Update(rows[(i+slidingMaxFrameSize)%len(rows)], nil, sc)
+		f.Remove(rows[i%len(rows)], nil, sc)
+		f.GetGroupResult(nil)
+	}
+}
+
+func (s *testAggFuncSuite) TestFirstLastValue(c *C) {
+	defer testleak.AfterTest(c)()
+	args := []expression.Expression{newColumnWithType(mysql.TypeVarString, 0), newColumnWithType(mysql.TypeLonglong, 1)}
+	rows := [][]types.Datum{
+		types.MakeDatums("b", 2),
+		types.MakeDatums("a", 1),
+		types.MakeDatums("c", 3),
+		types.MakeDatums("d", 1),
+	}
+	tests := []struct {
+		name   string
+		expect string
+	}{
+		{ast.AggFuncFirstValue, "a"},
+		{ast.AggFuncLastValue, "c"},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(t.name, args, false)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeVarString)
+		updateAll(c, f, nil, rows)
+		d := f.GetGroupResult(nil)
+		c.Assert(d.GetString(), Equals, t.expect, Commentf(t.name))
+		d = f.GetStreamResult()
+		c.Assert(d.GetString(), Equals, t.expect, Commentf(t.name))
+		partial := f.GetPartialResult(nil)
+		c.Assert(partial, HasLen, 2)
+		c.Assert(partial[0].GetString(), Equals, t.expect)
+
+		// The partial results can be merged by another first_value or last_value.
+		final := NewAggFunction(t.name, args, false)
+		updateAll(c, final, nil, [][]types.Datum{partial, types.MakeDatums("e", 2)})
+		d = final.GetGroupResult(nil)
+		c.Assert(d.GetString(), Equals, t.expect, Commentf(t.name))
+	}
+
+	f := NewAggFunction(ast.AggFuncFirstValue, args, false)
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+	f = NewAggFunction(ast.AggFuncFirstValue, args[:1], false)
+	c.Assert(f.Update(types.MakeDatums("a"), nil, new(variable.StatementContext)), NotNil)
+}
+
+func (s *testAggFuncSuite) TestCompareMaxMin(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	values := types.MakeDatums(
+		int64(-1), int64(0), int64(math.MaxInt64),
+		uint64(0), uint64(1), uint64(math.MaxUint64),
+		float32(1.5), float64(-2.5), float64(math.Inf(1)),
+		types.NewDecFromFloatForTest(1.5), "1.5", nil,
+	)
+	for _, x := range values {
+		for _, y := range values {
+			expect, err := x.CompareDatum(sc, y)
+			c.Assert(err, IsNil)
+			cmp, err := compareMaxMin(sc, &x, y, "")
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, expect, Commentf("%v %v", x, y))
+		}
+	}
+}
+
+func benchmarkCountUpdate(b *testing.B, f Aggregation) {
+	sc := new(variable.StatementContext)
+	// A wide row, count(*) doesn't read it at all.
+	row := make([]types.Datum, 64)
+	for i := range row {
+		row[i] = types.NewStringDatum("a long enough string value")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Update(row, nil, sc)
+	}
+}
+
+// BenchmarkCountStar counts the rows without evaluating the args.
+func BenchmarkCountStar(b *testing.B) {
+	one := &expression.Constant{Value: types.NewDatum(1), RetType: types.NewFieldType(mysql.TypeLonglong)}
+	benchmarkCountUpdate(b, NewAggFunction(ast.AggFuncCount, []expression.Expression{one}, false))
+}
+
+// BenchmarkCountStarGeneric goes through the generic path which evaluates the args for every row.
+func BenchmarkCountStarGeneric(b *testing.B) {
+	one := &expression.Constant{Value: types.NewDatum(1), RetType: types.NewFieldType(mysql.TypeLonglong)}
+	benchmarkCountUpdate(b, &countFunction{aggFunction: newAggFunc(ast.AggFuncCount, []expression.Expression{one}, false)})
+}
+
+func benchmarkMaxUpdate(b *testing.B, values []types.Datum) {
+	f := NewAggFunction(ast.AggFuncMax, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	sc := new(variable.StatementContext)
+	rows := make([][]types.Datum, len(values))
+	for i := range values {
+		rows[i] = values[i : i+1]
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.StreamUpdate(rows[i%len(rows)], sc)
+	}
+}
+
+// BenchmarkMaxUpdateInt64 goes through the fast path of comparing int64 datums.
+func BenchmarkMaxUpdateInt64(b *testing.B) {
+	var values []types.Datum
+	for i := 0; i < 1024; i++ {
+		values = append(values, types.NewIntDatum(int64(i)))
+	}
+	benchmarkMaxUpdate(b, values)
+}
+
+// BenchmarkMaxUpdateMixed compares int64 datums with uint64 ones, which goes through CompareDatum.
+func BenchmarkMaxUpdateMixed(b *testing.B) {
+	var values []types.Datum
+	for i := 0; i < 1024; i++ {
+		if i%2 == 0 {
+			values = append(values, types.NewIntDatum(int64(i)))
+		} else {
+			values = append(values, types.NewUintDatum(uint64(i)))
+		}
+	}
+	benchmarkMaxUpdate(b, values)
+}
+
+func (s *testAggFuncSuite) TestResetContext(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	col := newColumnWithType(mysql.TypeLonglong, 0)
+	for _, name := range []string{ast.AggFuncMax, ast.AggFuncMin, ast.AggFuncCount, ast.AggFuncSum} {
+		f := NewAggFunction(name, []expression.Expression{col}, false)
+		c.Assert(f.Update(types.MakeDatums(5), []byte("a"), sc), IsNil)
+		c.Assert(f.Update(types.MakeDatums(7), []byte("b"), sc), IsNil)
+		f.ResetContext([]byte("a"))
+		// Resetting a group not evaluated yet is a no-op.
+		f.ResetContext([]byte("c"))
+		c.Assert(f.Update(types.MakeDatums(3), []byte("a"), sc), IsNil)
+
+		expect := NewAggFunction(name, []expression.Expression{col}, false)
+		c.Assert(expect.Update(types.MakeDatums(3), []byte("a"), sc), IsNil)
+		c.Assert(expect.Update(types.MakeDatums(7), []byte("b"), sc), IsNil)
+		for _, key := range []string{"a", "b"} {
+			d := f.GetGroupResult([]byte(key))
+			cmp, err := d.CompareDatum(sc, expect.GetGroupResult([]byte(key)))
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("%s group %s: got %v", name, key, d.GetValue()))
+		}
+	}
+}
+
+// benchmarkMaxManyGroups evaluates max over many partitions with small groups,
+// reset prepares the group of the next partition.
+func benchmarkMaxManyGroups(b *testing.B, reset func(f Aggregation, groupKeys [][]byte)) {
+	f := NewAggFunction(ast.AggFuncMax, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	sc := new(variable.StatementContext)
+	groupKeys := make([][]byte, 256)
+	for i := range groupKeys {
+		groupKeys[i] = []byte{byte(i)}
+	}
+	rows := [][]types.Datum{types.MakeDatums(1), types.MakeDatums(3), types.MakeDatums(2)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reset(f, groupKeys)
+		for _, key := range groupKeys {
+			for _, row := range rows {
+				f.Update(row, key, sc)
+			}
+			f.GetGroupResult(key)
+		}
+	}
+}
+
+// BenchmarkMaxManyGroupsReset reuses the contexts of the groups by ResetContext.
+func BenchmarkMaxManyGroupsReset(b *testing.B) {
+	benchmarkMaxManyGroups(b, func(f Aggregation, groupKeys [][]byte) {
+		for _, key := range groupKeys {
+			f.ResetContext(key)
+		}
+	})
+}
+
+// BenchmarkMaxManyGroupsRealloc allocates new contexts for the groups after Reset.
+func BenchmarkMaxManyGroupsRealloc(b *testing.B) {
+	benchmarkMaxManyGroups(b, func(f Aggregation, groupKeys [][]byte) {
+		f.Reset()
+	})
+}
+
+func (s *testAggFuncSuite) TestKeep(c *C) {
+	defer testleak.AfterTest(c)()
+	args := []expression.Expression{
+		newColumnWithType(mysql.TypeLonglong, 0),
+		newColumnWithType(mysql.TypeVarString, 1),
+		newColumnWithType(mysql.TypeDouble, 2),
+	}
+	rows := [][]types.Datum{
+		types.MakeDatums(2, "b", 2.5),
+		types.MakeDatums(nil, "null", 0.0),
+		types.MakeDatums(1, "a", 1.5),
+		types.MakeDatums(3, "c", 3.5),
+		types.MakeDatums(1, "a2", -1.5),
+		types.MakeDatums(3, "c2", -3.5),
+	}
+	tests := []struct {
+		name   string
+		expect []interface{}
+	}{
+		// The first row seen wins on ties.
+		{ast.AggFuncMaxKeep, []interface{}{"c", 3.5}},
+		{ast.AggFuncMinKeep, []interface{}{"a", 1.5}},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(t.name, args, false)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeVarString)
+		updateAll(c, f, nil, rows)
+		partial := f.GetPartialResult(nil)
+		c.Assert(partial, HasLen, 2)
+		c.Assert(partial[0].GetString(), Equals, t.expect[0], Commentf(t.name))
+		c.Assert(partial[1].GetFloat64(), Equals, t.expect[1], Commentf(t.name))
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetStreamResult()} {
+			c.Assert(d.GetString(), Equals, t.expect[0], Commentf(t.name))
+		}
+	}
+
+	// All the order values are NULL.
+	f := NewAggFunction(ast.AggFuncMaxKeep, args, false)
+	updateAll(c, f, nil, rows[1:2])
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+	d = f.GetStreamResult()
+	c.Assert(d.IsNull(), IsTrue)
+	partial := f.GetPartialResult(nil)
+	c.Assert(partial, HasLen, 2)
+	c.Assert(partial[0].IsNull(), IsTrue)
+	c.Assert(partial[1].IsNull(), IsTrue)
+
+	f = NewAggFunction(ast.AggFuncMaxKeep, args[:1], false)
+	c.Assert(f.Update(rows[0], nil, new(variable.StatementContext)), NotNil)
+}
+
+func (s *testAggFuncSuite) TestArgMaxMin(c *C) {
+	defer testleak.AfterTest(c)()
+	args := []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0), newColumnWithType(mysql.TypeDouble, 1)}
+	tests := []struct {
+		rows      [][]interface{}
+		expectMax interface{}
+		expectMin interface{}
+	}{
+		{[][]interface{}{{1, 2.5}, {2, 4.5}, {3, 0.5}}, int64(2), int64(3)},
+		// The NULL order values are skipped, the NULL values are kept.
+		{[][]interface{}{{1, nil}, {2, 1.5}, {nil, 9.5}, {4, nil}, {nil, -1.5}}, nil, nil},
+		{[][]interface{}{{1, nil}, {2, 1.5}, {3, nil}}, int64(2), int64(2)},
+		// The first row seen wins on ties.
+		{[][]interface{}{{1, 2.5}, {2, 4.5}, {3, 0.5}, {4, 4.5}, {5, 0.5}}, int64(2), int64(3)},
+		{[][]interface{}{{5, 1.0}, {4, 1.0}, {3, 1.0}}, int64(5), int64(5)},
+		{[][]interface{}{{1, nil}, {2, nil}}, nil, nil},
+		{nil, nil, nil},
+	}
+	for _, t := range tests {
+		for _, name := range []string{ast.AggFuncArgMax, ast.AggFuncArgMin} {
+			f := NewAggFunction(name, args, false)
+			c.Assert(f.GetType().Tp, Equals, mysql.TypeLonglong)
+			var rows [][]types.Datum
+			for _, row := range t.rows {
+				rows = append(rows, types.MakeDatums(row...))
+			}
+			updateAll(c, f, nil, rows)
+			expect := t.expectMax
+			if name == ast.AggFuncArgMin {
+				expect = t.expectMin
+			}
+			for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+				c.Assert(d.GetValue(), Equals, expect, Commentf("%s%v", name, t.rows))
+			}
+		}
+	}
+
+	f := NewAggFunction(ast.AggFuncArgMax, args[:1], false)
+	c.Assert(f.Update(types.MakeDatums(1), nil, new(variable.StatementContext)), NotNil)
+}
+
+func (s *testAggFuncSuite) TestMode(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		tp     byte
+		values []interface{}
+		expect interface{}
+	}{
+		{mysql.TypeLonglong, []interface{}{3, 1, 3, nil, 2, 3, 1}, int64(3)},
+		// Ties are broken by the smallest value.
+		{mysql.TypeLonglong, []interface{}{3, 2, 3, 2, nil, nil, nil, 5}, int64(2)},
+		{mysql.TypeVarString, []interface{}{"b", "c", "a", "c", "b", "a"}, "a"},
+		{mysql.TypeDouble, []interface{}{1.5}, 1.5},
+		{mysql.TypeLonglong, []interface{}{nil, nil}, nil},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(ast.AggFuncMode, []expression.Expression{newColumnWithType(t.tp, 0)}, false)
+		c.Assert(f.GetType().Tp, Equals, t.tp)
+		var rows [][]types.Datum
+		for _, v := range t.values {
+			rows = append(rows, types.MakeDatums(v))
+		}
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.GetValue(), Equals, t.expect, Commentf("values %v", t.values))
+		}
+	}
+
+	// The clone doesn't share the counts with the original function.
+	f := NewAggFunction(ast.AggFuncMode, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	c.Assert(f.Update(types.MakeDatums(2), nil, nil), IsNil)
+	nf := f.Clone()
+	c.Assert(nf.Update(types.MakeDatums(1), nil, nil), IsNil)
+	c.Assert(nf.Update(types.MakeDatums(1), nil, nil), IsNil)
+	d := f.GetGroupResult(nil)
+	c.Assert(d.GetInt64(), Equals, int64(2))
+	d = nf.GetGroupResult(nil)
+	c.Assert(d.GetInt64(), Equals, int64(1))
+}
+
+func (s *testAggFuncSuite) TestTopK(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	newTopK := func(k int64) Aggregation {
+		kArg := &expression.Constant{Value: types.NewIntDatum(k), RetType: types.NewFieldType(mysql.TypeLonglong)}
+		return NewAggFunction(ast.AggFuncTopK, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0), kArg}, false)
+	}
+
+	// The counts are exact if there are at most k distinct values.
+	f := newTopK(3)
+	c.Assert(f.GetType().Tp, Equals, mysql.TypeJSON)
+	var rows [][]types.Datum
+	for _, v := range []interface{}{3, 1, 3, nil, 2, 3, 1, nil} {
+		rows = append(rows, types.MakeDatums(v))
+	}
+	updateAll(c, f, nil, rows)
+	expect := `[{"value": 3, "count": 3}, {"value": 1, "count": 2}, {"value": 2, "count": 1}]`
+	for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+		c.Assert(d.Kind(), Equals, types.KindMysqlJSON)
+		e, err := json.ParseFromString(expect)
+		c.Assert(err, IsNil)
+		cmp, err := json.CompareJSON(d.GetMysqlJSON(), e)
+		c.Assert(err, IsNil)
+		c.Assert(cmp, Equals, 0, Commentf("got %s", d.GetMysqlJSON()))
+	}
+
+	// The heavy hitters of a skewed dataset are found with a few counters.
+	f = newTopK(100)
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.5, 1, 10000)
+	counts := make(map[int64]int64)
+	for i := 0; i < 100000; i++ {
+		v := int64(zipf.Uint64())
+		counts[v]++
+		c.Assert(f.Update(types.MakeDatums(v), nil, sc), IsNil)
+	}
+	type freq struct {
+		value, count int64
+	}
+	var truth []freq
+	for v, n := range counts {
+		truth = append(truth, freq{v, n})
+	}
+	sort.Slice(truth, func(i, j int) bool { return truth[i].count > truth[j].count })
+	d := f.GetGroupResult(nil)
+	top := d.GetMysqlJSON().Array
+	c.Assert(top, HasLen, 100)
+	estimated := make(map[int64]int64)
+	for _, elem := range top {
+		estimated[elem.Object["value"].I64] = elem.Object["count"].I64
+	}
+	for i, t := range truth {
+		n, ok := estimated[t.value]
+		// The values more frequent than n/k are guaranteed to be found, and
+		// the top 10 ones are found in practice.
+		if t.count <= 100000/100 && i >= 10 {
+			break
+		}
+		c.Assert(ok, IsTrue, Commentf("%d with count %d is missing", t.value, t.count))
+		// Space-Saving never underestimates.
+		c.Assert(n >= t.count, IsTrue)
+	}
+	for i := 0; i < 3; i++ {
+		c.Assert(top[i].Object["value"].I64, Equals, truth[i].value)
+	}
+
+	// The clone doesn't share the counters with the original function.
+	f = newTopK(2)
+	c.Assert(f.Update(types.MakeDatums(2), nil, sc), IsNil)
+	nf := f.Clone()
+	c.Assert(nf.Update(types.MakeDatums(1), nil, sc), IsNil)
+	d = f.GetGroupResult(nil)
+	c.Assert(d.GetMysqlJSON().String(), Equals, `[{"count":1,"value":2}]`)
+	d = nf.GetGroupResult(nil)
+	c.Assert(d.GetMysqlJSON().String(), Equals, `[{"count":1,"value":1},{"count":1,"value":2}]`)
+
+	d = newTopK(2).GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+	c.Assert(newTopK(0).Update(types.MakeDatums(1), nil, sc), NotNil)
+	f = NewAggFunction(ast.AggFuncTopK, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0), newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	c.Assert(f.Update(types.MakeDatums(1), nil, sc), NotNil)
+}
+
+func (s *testAggFuncSuite) TestPartialResultRoundTrip(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	var rows [][]types.Datum
+	for _, v := range []interface{}{5, nil, 3, 9, nil, -2, 7, 9, nil, 1} {
+		rows = append(rows, types.MakeDatums(v))
+	}
+	groupKey := []byte("g")
+	for _, name := range []string{ast.AggFuncMax, ast.AggFuncMin, ast.AggFuncCount} {
+		col := newColumnWithType(mysql.TypeLonglong, 0)
+		single := NewAggFunction(name, []expression.Expression{col}, false)
+		for _, row := range rows {
+			c.Assert(single.Update(row, groupKey, sc), IsNil)
+		}
+		expect := single.GetGroupResult(groupKey)
+
+		for _, chunkSize := range []int{1, 3, 4, len(rows)} {
+			// Every chunk is aggregated like a coprocessor region, then the partial
+			// results are merged by the function in FinalMode.
+			final := NewAggFunction(name, []expression.Expression{newColumnWithType(single.GetType().Tp, 0)}, false)
+			final.SetMode(FinalMode)
+			for start := 0; start < len(rows); start += chunkSize {
+				end := start + chunkSize
+				if end > len(rows) {
+					end = len(rows)
+				}
+				partial := NewAggFunction(name, []expression.Expression{col}, false)
+				for _, row := range rows[start:end] {
+					c.Assert(partial.Update(row, groupKey, sc), IsNil)
+				}
+				result := partial.GetPartialResult(groupKey)
+				c.Assert(result, HasLen, 1)
+				c.Assert(final.Update(result, groupKey, sc), IsNil)
+			}
+			d := final.GetGroupResult(groupKey)
+			cmp, err := d.CompareDatum(sc, expect)
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("%s chunk size %d: got %v, expect %v", name, chunkSize, d.GetValue(), expect.GetValue()))
+		}
+	}
+
+	// A partial max of a group with only NULLs doesn't affect the merged result.
+	final := NewAggFunction(ast.AggFuncMax, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	final.SetMode(FinalMode)
+	c.Assert(final.Update(types.MakeDatums(nil), groupKey, sc), IsNil)
+	c.Assert(final.Update(types.MakeDatums(3), groupKey, sc), IsNil)
+	c.Assert(final.Update(types.MakeDatums(nil), groupKey, sc), IsNil)
+	d := final.GetGroupResult(groupKey)
+	c.Assert(d.GetInt64(), Equals, int64(3))
+}
+
+func (s *testAggFuncSuite) TestVariance(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		name     string
+		distinct bool
+		values   []interface{}
+		expect   interface{}
+	}{
+		{ast.AggFuncVarPop, false, []interface{}{2, 4, 4, 4, nil, 5, 5, 7, 9}, 4.0},
+		{ast.AggFuncStddevPop, false, []interface{}{2, 4, 4, 4, nil, 5, 5, 7, 9}, 2.0},
+		{ast.AggFuncStd, false, []interface{}{2, 4, 4, 4, 5, 5, 7, 9}, 2.0},
+		{ast.AggFuncVarPop, true, []interface{}{1, 1, 2, 3, 3}, 2.0 / 3},
+		{ast.AggFuncVarPop, false, []interface{}{"1.5", 2.5}, 0.25},
+		{ast.AggFuncVarPop, false, []interface{}{7}, 0.0},
+		{ast.AggFuncStddevPop, false, []interface{}{7}, 0.0},
+		{ast.AggFuncVarPop, false, []interface{}{nil}, nil},
+		{ast.AggFuncStd, false, []interface{}{}, nil},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(t.name, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, t.distinct)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeDouble)
+		var rows [][]types.Datum
+		for _, v := range t.values {
+			rows = append(rows, types.MakeDatums(v))
+		}
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetStreamResult()} {
+			if t.expect == nil {
+				c.Assert(d.IsNull(), IsTrue)
+				continue
+			}
+			c.Assert(math.Abs(d.GetFloat64()-t.expect.(float64)), Less, 1e-9, Commentf("%s%v", t.name, t.values))
+		}
+	}
+}
+
+func (s *testAggFuncSuite) TestCorr(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		distinct bool
+		rows     [][]interface{}
+		expect   interface{}
+	}{
+		// Anscombe's quartet I, the correlation is 0.81642.
+		{false, [][]interface{}{{10, 8.04}, {8, 6.95}, {13, 7.58}, {9, 8.81}, {11, 8.33}, {14, 9.96}, {6, 7.24}, {4, 4.26}, {12, 10.84}, {7, 4.82}, {5, 5.68}}, 0.816420516344},
+		{false, [][]interface{}{{1, 2}, {2, 4}, {nil, 100}, {3, 6}, {100, nil}}, 1.0},
+		{false, [][]interface{}{{1, 3}, {2, 2}, {3, 1}}, -1.0},
+		{true, [][]interface{}{{1, 1}, {1, 1}, {1, 1}, {2, 2}, {3, 0}}, -0.5},
+		// Large offsets don't ruin the precision.
+		{false, [][]interface{}{{1e9 + 1, 1e9 + 2}, {1e9 + 2, 1e9 + 4}, {1e9 + 3, 1e9 + 6}}, 1.0},
+		// NULL if either variance is zero.
+		{false, [][]interface{}{{1, 2}, {1, 3}}, nil},
+		{false, [][]interface{}{{1, 2}}, nil},
+		{false, [][]interface{}{{nil, 2}}, nil},
+		{false, nil, nil},
+	}
+	args := []expression.Expression{newColumnWithType(mysql.TypeDouble, 0), newColumnWithType(mysql.TypeDouble, 1)}
+	for _, t := range tests {
+		f := NewAggFunction(ast.AggFuncCorr, args, t.distinct)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeDouble)
+		var rows [][]types.Datum
+		for _, row := range t.rows {
+			rows = append(rows, types.MakeDatums(row...))
+		}
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetStreamResult()} {
+			if t.expect == nil {
+				c.Assert(d.IsNull(), IsTrue, Commentf("%v", t.rows))
+				continue
+			}
+			c.Assert(math.Abs(d.GetFloat64()-t.expect.(float64)), Less, 1e-9, Commentf("%v", t.rows))
+		}
+	}
+}
+
+func (s *testAggFuncSuite) TestCovariance(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		distinct   bool
+		rows       [][]interface{}
+		expectPop  interface{}
+		expectSamp interface{}
+	}{
+		// The deviations are (-1.5, -3), (-0.5, -1), (0.5, 0), (1.5, 4), the co-moment is 11.
+		{false, [][]interface{}{{1, 2}, {2, 4}, {3, 5}, {4, 9}}, 2.75, 11.0 / 3},
+		{false, [][]interface{}{{1, 2}, {nil, 7}, {2, 4}, {3, nil}, {3, 5}, {4, 9}}, 2.75, 11.0 / 3},
+		{true, [][]interface{}{{1, 2}, {1, 2}, {2, 4}, {3, 5}, {4, 9}, {4, 9}}, 2.75, 11.0 / 3},
+		{false, [][]interface{}{{1, 3}, {2, 2}, {3, 1}}, -2.0 / 3, -1.0},
+		{false, [][]interface{}{{1e9 + 1, 1e9 + 2}, {1e9 + 2, 1e9 + 4}, {1e9 + 3, 1e9 + 6}}, 4.0 / 3, 2.0},
+		// The sample covariance of a single pair is NULL.
+		{false, [][]interface{}{{5, 7}}, 0.0, nil},
+		{false, [][]interface{}{{nil, 2}, {1, nil}}, nil, nil},
+		{false, nil, nil, nil},
+	}
+	args := []expression.Expression{newColumnWithType(mysql.TypeDouble, 0), newColumnWithType(mysql.TypeDouble, 1)}
+	for _, t := range tests {
+		for _, name := range []string{ast.AggFuncCovarPop, ast.AggFuncCovarSamp} {
+			f := NewAggFunction(name, args, t.distinct)
+			c.Assert(f.GetType().Tp, Equals, mysql.TypeDouble)
+			var rows [][]types.Datum
+			for _, row := range t.rows {
+				rows = append(rows, types.MakeDatums(row...))
+			}
+			updateAll(c, f, []byte("a"), rows)
+			expect := t.expectPop
+			if name == ast.AggFuncCovarSamp {
+				expect = t.expectSamp
+			}
+			for _, d := range []types.Datum{f.GetGroupResult([]byte("a")), f.GetStreamResult()} {
+				if expect == nil {
+					c.Assert(d.IsNull(), IsTrue, Commentf("%s%v", name, t.rows))
+					continue
+				}
+				c.Assert(math.Abs(d.GetFloat64()-expect.(float64)), Less, 1e-9, Commentf("%s%v", name, t.rows))
+			}
+
+			// The clone doesn't share the groups, and a reset group starts over.
+			d := f.Clone().GetGroupResult([]byte("a"))
+			c.Assert(d.IsNull(), IsTrue)
+			f.ResetContext([]byte("a"))
+			d = f.GetGroupResult([]byte("a"))
+			c.Assert(d.IsNull(), IsTrue)
+			updateAll(c, f, []byte("a"), rows)
+			d = f.GetGroupResult([]byte("a"))
+			if expect == nil {
+				c.Assert(d.IsNull(), IsTrue)
+			} else {
+				c.Assert(math.Abs(d.GetFloat64()-expect.(float64)), Less, 1e-9, Commentf("%s%v", name, t.rows))
+			}
+		}
+	}
+}
+
+func (s *testAggFuncSuite) TestFirstLastNonNull(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		values      []interface{}
+		expectFirst interface{}
+		expectLast  interface{}
+	}{
+		{[]interface{}{3, 1, 2}, int64(3), int64(2)},
+		{[]interface{}{2, 1, 3}, int64(2), int64(3)},
+		{[]interface{}{nil, nil, 5, nil, 7, nil}, int64(5), int64(7)},
+		{[]interface{}{nil, 4, nil}, int64(4), int64(4)},
+		{[]interface{}{nil, nil, nil}, nil, nil},
+		{[]interface{}{}, nil, nil},
+	}
+	for _, t := range tests {
+		for _, name := range []string{ast.AggFuncFirst, ast.AggFuncLast} {
+			f := NewAggFunction(name, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+			c.Assert(f.GetType().Tp, Equals, mysql.TypeLonglong)
+			var rows [][]types.Datum
+			for _, v := range t.values {
+				rows = append(rows, types.MakeDatums(v))
+			}
+			updateAll(c, f, nil, rows)
+			expect := t.expectFirst
+			if name == ast.AggFuncLast {
+				expect = t.expectLast
+			}
+			for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+				c.Assert(d.GetValue(), Equals, expect, Commentf("%s%v", name, t.values))
+			}
+		}
+	}
+}
+
+func (s *testAggFuncSuite) TestJSONArrayAgg(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		tp     byte
+		values []interface{}
+		expect string
+	}{
+		{mysql.TypeLonglong, []interface{}{3, 1, 2}, `[3, 1, 2]`},
+		{mysql.TypeDouble, []interface{}{1.5, nil, -2.0}, `[1.5, null, -2]`},
+		{mysql.TypeVarString, []interface{}{"a", `{"b": 1}`, nil}, `["a", "{\"b\": 1}", null]`},
+		{mysql.TypeVarString, []interface{}{"a", 1, uint64(2), types.NewDecFromFloatForTest(0.5)}, `["a", 1, 2, 0.5]`},
+		{mysql.TypeJSON, []interface{}{json.CreateJSON(map[string]interface{}{"a": int64(1)}), nil}, `[{"a": 1}, null]`},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(ast.AggFuncJSONArrayAgg, []expression.Expression{newColumnWithType(t.tp, 0)}, false)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeJSON)
+		var rows [][]types.Datum
+		for _, v := range t.values {
+			rows = append(rows, types.MakeDatums(v))
+		}
+		updateAll(c, f, nil, rows)
+		expect, err := json.ParseFromString(t.expect)
+		c.Assert(err, IsNil)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, types.KindMysqlJSON)
+			cmp, err := json.CompareJSON(d.GetMysqlJSON(), expect)
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("got %s, expect %s", d.GetMysqlJSON(), t.expect))
+		}
+	}
+
+	f := NewAggFunction(ast.AggFuncJSONArrayAgg, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+}
+
+func (s *testAggFuncSuite) TestJSONObjectAgg(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		keyTp  byte
+		rows   [][]interface{}
+		expect string
+	}{
+		{mysql.TypeVarString, [][]interface{}{{"a", 1}, {"b", "x"}, {"c", nil}}, `{"a": 1, "b": "x", "c": null}`},
+		// The later value of a duplicated key overwrites the earlier one.
+		{mysql.TypeVarString, [][]interface{}{{"a", 1}, {"b", 2}, {"a", 3}}, `{"a": 3, "b": 2}`},
+		// The keys are converted to strings.
+		{mysql.TypeLonglong, [][]interface{}{{1, 1.5}, {2, types.NewDecFromFloatForTest(0.5)}, {1, "y"}}, `{"1": "y", "2": 0.5}`},
+	}
+	for _, t := range tests {
+		args := []expression.Expression{newColumnWithType(t.keyTp, 0), newColumnWithType(mysql.TypeVarString, 1)}
+		f := NewAggFunction(ast.AggFuncJSONObjectAgg, args, false)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeJSON)
+		var rows [][]types.Datum
+		for _, r := range t.rows {
+			rows = append(rows, types.MakeDatums(r...))
+		}
+		updateAll(c, f, nil, rows)
+		expect, err := json.ParseFromString(t.expect)
+		c.Assert(err, IsNil)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, types.KindMysqlJSON)
+			cmp, err := json.CompareJSON(d.GetMysqlJSON(), expect)
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("got %s, expect %s", d.GetMysqlJSON(), t.expect))
+		}
+	}
+
+	f := NewAggFunction(ast.AggFuncJSONObjectAgg, []expression.Expression{newColumnWithType(mysql.TypeVarString, 0), newColumnWithType(mysql.TypeLonglong, 1)}, false)
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+	sc := new(variable.StatementContext)
+	err := f.Update(types.MakeDatums(nil, 1), nil, sc)
+	c.Assert(errors.Cause(err), Equals, errJSONObjectAggNullKey)
+	err = f.StreamUpdate(types.MakeDatums(nil, 1), sc)
+	c.Assert(errors.Cause(err), Equals, errJSONObjectAggNullKey)
+}
+
+func (s *testAggFuncSuite) TestJSONMergeAgg(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		docs   []interface{}
+		expect string
+	}{
+		// The values of the overlapping keys are merged into arrays, not replaced.
+		{[]interface{}{`{"a": 1, "b": {"x": 1}}`, `{"a": 2, "b": {"y": 2}}`, `{"a": 3, "c": 4}`}, `{"a": [1, 2, 3], "b": {"x": 1, "y": 2}, "c": 4}`},
+		{[]interface{}{`[1, 2]`, nil, `[2, 3]`}, `[1, 2, 2, 3]`},
+		{[]interface{}{`{"a": 1}`, `[1]`, `2`}, `[{"a": 1}, 1, 2]`},
+		{[]interface{}{`1`, `"x"`}, `[1, "x"]`},
+		{[]interface{}{nil, `{"a": null}`}, `{"a": null}`},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(ast.AggFuncJSONMergeAgg, []expression.Expression{newColumnWithType(mysql.TypeVarString, 0)}, false)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeJSON)
+		var rows [][]types.Datum
+		for _, doc := range t.docs {
+			rows = append(rows, types.MakeDatums(doc))
+		}
+		updateAll(c, f, nil, rows)
+		expect, err := json.ParseFromString(t.expect)
+		c.Assert(err, IsNil)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, types.KindMysqlJSON)
+			cmp, err := json.CompareJSON(d.GetMysqlJSON(), expect)
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("got %s, expect %s", d.GetMysqlJSON(), t.expect))
+		}
+	}
+
+	sc := new(variable.StatementContext)
+	f := NewAggFunction(ast.AggFuncJSONMergeAgg, []expression.Expression{newColumnWithType(mysql.TypeJSON, 0)}, false)
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+	c.Assert(f.Update(types.MakeDatums(nil), nil, sc), IsNil)
+	d = f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+
+	// The JSON rows aren't modified by merging the later ones.
+	first, err := json.ParseFromString(`{"a": [1]}`)
+	c.Assert(err, IsNil)
+	var row types.Datum
+	row.SetMysqlJSON(first)
+	c.Assert(f.Update([]types.Datum{row}, nil, sc), IsNil)
+	second, err := json.ParseFromString(`{"a": [2]}`)
+	c.Assert(err, IsNil)
+	row.SetMysqlJSON(second)
+	c.Assert(f.Update([]types.Datum{row}, nil, sc), IsNil)
+	c.Assert(first.String(), Equals, `{"a":[1]}`)
+
+	// The clone has a copy of the merged documents.
+	clone := f.Clone()
+	row.SetMysqlJSON(first)
+	c.Assert(clone.Update([]types.Datum{row}, nil, sc), IsNil)
+	d = f.GetGroupResult(nil)
+	c.Assert(d.GetMysqlJSON().String(), Equals, `{"a":[1,2]}`)
+	d = clone.GetGroupResult(nil)
+	c.Assert(d.GetMysqlJSON().String(), Equals, `{"a":[1,2,1]}`)
+
+	c.Assert(f.Update(types.MakeDatums(`{"a": `), nil, sc), NotNil)
+}
+
+func (s *testAggFuncSuite) TestCollectSet(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		tp     byte
+		values []interface{}
+		expect string
+	}{
+		{mysql.TypeLonglong, []interface{}{3, 1, 3, 2, 1}, `[3, 1, 2]`},
+		{mysql.TypeDouble, []interface{}{1.5, nil, -2.0, 1.5, nil}, `[1.5, -2]`},
+		{mysql.TypeVarString, []interface{}{"b", "a", "b", "c", "a"}, `["b", "a", "c"]`},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(ast.AggFuncCollectSet, []expression.Expression{newColumnWithType(t.tp, 0)}, false)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeJSON)
+		var rows [][]types.Datum
+		for _, v := range t.values {
+			rows = append(rows, types.MakeDatums(v))
+		}
+		updateAll(c, f, nil, rows)
+		expect, err := json.ParseFromString(t.expect)
+		c.Assert(err, IsNil)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, types.KindMysqlJSON)
+			cmp, err := json.CompareJSON(d.GetMysqlJSON(), expect)
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("got %s, expect %s", d.GetMysqlJSON(), t.expect))
+		}
+	}
+
+	// All NULL rows result in NULL.
+	f := NewAggFunction(ast.AggFuncCollectSet, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	updateAll(c, f, nil, [][]types.Datum{types.MakeDatums(nil)})
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+
+	// The clone doesn't share the set with the original function.
+	f = NewAggFunction(ast.AggFuncCollectSet, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	c.Assert(f.Update(types.MakeDatums(1), nil, nil), IsNil)
+	nf := f.Clone()
+	c.Assert(nf.Update(types.MakeDatums(2), nil, nil), IsNil)
+	c.Assert(f.Update(types.MakeDatums(3), nil, nil), IsNil)
+	for _, t := range []struct {
+		f      Aggregation
+		expect string
+	}{{f, `[1, 3]`}, {nf, `[1, 2]`}} {
+		expect, err := json.ParseFromString(t.expect)
+		c.Assert(err, IsNil)
+		d := t.f.GetGroupResult(nil)
+		cmp, err := json.CompareJSON(d.GetMysqlJSON(), expect)
+		c.Assert(err, IsNil)
+		c.Assert(cmp, Equals, 0, Commentf("got %s, expect %s", d.GetMysqlJSON(), t.expect))
+	}
+}
+
+func (s *testAggFuncSuite) TestHistogram(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	newHistogram := func(width, minBound interface{}) Aggregation {
+		args := []expression.Expression{
+			newColumnWithType(mysql.TypeDouble, 0),
+			&expression.Constant{Value: types.NewDatum(width), RetType: types.NewFieldType(mysql.TypeDouble)},
+			&expression.Constant{Value: types.NewDatum(minBound), RetType: types.NewFieldType(mysql.TypeDouble)},
+		}
+		return NewAggFunction(ast.AggFuncHistogram, args, false)
+	}
+	var rows [][]types.Datum
+	for _, v := range []interface{}{-5.0, 0.0, 3.5, nil, 10.0, 12.0, 19.9, 20.0, 45.0} {
+		rows = append(rows, types.MakeDatums(v))
+	}
+	tests := []struct {
+		width    float64
+		minBound float64
+		expect   string
+	}{
+		{10, 0, `{"0": 3, "1": 3, "2": 1, "4": 1}`},
+		{25, 0, `{"0": 7, "1": 1}`},
+		{10, 15, `{"0": 7, "3": 1}`},
+	}
+	for _, t := range tests {
+		f := newHistogram(t.width, t.minBound)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeJSON)
+		updateAll(c, f, nil, rows)
+		expect, err := json.ParseFromString(t.expect)
+		c.Assert(err, IsNil)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, types.KindMysqlJSON)
+			cmp, err := json.CompareJSON(d.GetMysqlJSON(), expect)
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("got %s, expect %s", d.GetMysqlJSON(), t.expect))
+		}
+	}
+
+	// All NULL rows result in NULL.
+	f := newHistogram(10, 0)
+	updateAll(c, f, nil, [][]types.Datum{types.MakeDatums(nil)})
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+
+	// The bucket width should be positive and the min bound should not be NULL.
+	for _, t := range [][]interface{}{{0, 0}, {-1, 0}, {nil, 0}, {10, nil}} {
+		c.Assert(newHistogram(t[0], t[1]).Update(rows[0], nil, sc), NotNil)
+	}
+}
+
+func (s *testAggFuncSuite) TestApproxCountDistinct(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	newApproxCountDistinct := func(registers interface{}) Aggregation {
+		args := []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}
+		if registers != nil {
+			args = append(args, &expression.Constant{Value: types.NewDatum(registers), RetType: types.NewFieldType(mysql.TypeLonglong)})
+		}
+		return NewAggFunction(ast.AggFuncApproxCountDistinct, args, false)
+	}
+	// Every value in [0, ndv) appears twice, and there are some NULLs.
+	var rows [][]types.Datum
+	for _, ndv := range []int{100, 20000} {
+		rows = rows[:0]
+		for i := 0; i < ndv*2; i++ {
+			rows = append(rows, types.MakeDatums(i%ndv))
+			if i%100 == 0 {
+				rows = append(rows, types.MakeDatums(nil))
+			}
+		}
+		for _, registers := range []interface{}{nil, 16, 1024, 65536} {
+			f := newApproxCountDistinct(registers)
+			c.Assert(f.GetType().Tp, Equals, mysql.TypeLonglong)
+			updateAll(c, f, nil, rows)
+			m := float64(defaultHLLRegisters)
+			if registers != nil {
+				m = float64(registers.(int))
+			}
+			// Allow 3 times the standard error.
+			bound := 3 * 1.04 / math.Sqrt(m) * float64(ndv)
+			for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+				c.Assert(math.Abs(float64(d.GetInt64()-int64(ndv))) <= bound, IsTrue,
+					Commentf("ndv %d, registers %v: got %d", ndv, registers, d.GetInt64()))
+			}
+		}
+	}
+
+	// Empty group results in 0.
+	f := newApproxCountDistinct(nil)
+	updateAll(c, f, nil, [][]types.Datum{types.MakeDatums(nil)})
+	for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetStreamResult()} {
+		c.Assert(d.GetInt64(), Equals, int64(0))
+	}
+
+	// The register count should be a constant power of 2 in [16, 65536].
+	for _, registers := range []interface{}{8, 1000, 131072, -16} {
+		c.Assert(newApproxCountDistinct(registers).Update(rows[0], nil, sc), NotNil)
+	}
+	f = NewAggFunction(ast.AggFuncApproxCountDistinct, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0), newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	c.Assert(f.Update(rows[0], nil, sc), NotNil)
+
+	// The clone doesn't share the sketch with the original function.
+	f = newApproxCountDistinct(nil)
+	c.Assert(f.Update(types.MakeDatums(1), nil, sc), IsNil)
+	nf := f.Clone()
+	for i := 2; i <= 10; i++ {
+		c.Assert(nf.Update(types.MakeDatums(i), nil, sc), IsNil)
+	}
+	d := f.GetGroupResult(nil)
+	c.Assert(d.GetInt64(), Equals, int64(1))
+	d = nf.GetGroupResult(nil)
+	c.Assert(d.GetInt64(), Equals, int64(10))
+}
+
+func (s *testAggFuncSuite) TestGroupConcat(c *C) {
+	defer testleak.AfterTest(c)()
+	rows := [][]types.Datum{
+		types.MakeDatums("a", 1),
+		types.MakeDatums("b", nil),
+		types.MakeDatums("a", 1),
+		types.MakeDatums("c", 3),
+	}
+	args := []expression.Expression{newColumnWithType(mysql.TypeVarString, 0), newColumnWithType(mysql.TypeLonglong, 1)}
+	tests := []struct {
+		f      Aggregation
+		expect interface{}
+	}{
+		{NewAggFunction(ast.AggFuncGroupConcat, args, false), "a1,a1,c3"},
+		{NewAggFunction(ast.AggFuncGroupConcat, args, true), "a1,c3"},
+		{NewGroupConcatFunction(args, false, " | ", 0), "a1 | a1 | c3"},
+		{NewGroupConcatFunction(args, true, "", 0), "a1c3"},
+		{NewGroupConcatFunction(args, false, ",", 4), "a1,a"},
+		{NewGroupConcatFunction(args, false, ",", 1), "a"},
+		{NewGroupConcatFunction(args, false, ",", 6), "a1,a1,"},
+		{NewGroupConcatFunction(args[1:], false, ",", 0), "1,1,3"},
+	}
+	for i, t := range tests {
+		updateAll(c, t.f, nil, rows)
+		for _, d := range []types.Datum{t.f.GetGroupResult(nil), t.f.GetStreamResult()} {
+			c.Assert(d.GetValue(), Equals, t.expect, Commentf("%d", i))
+		}
+	}
+
+	// NULL rows are skipped, all NULL rows result in NULL.
+	f := NewGroupConcatFunction(args[1:], false, ",", 0)
+	updateAll(c, f, nil, [][]types.Datum{types.MakeDatums("a", nil), types.MakeDatums("b", nil)})
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+}
+
+func (s *testAggFuncSuite) TestPercentileCont(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	var rows [][]types.Datum
+	for _, v := range []interface{}{40, nil, 15, 50, 20, nil, 35} {
+		rows = append(rows, types.MakeDatums(v))
+	}
+	newPercentileCont := func(p interface{}) Aggregation {
+		arg := &expression.Constant{Value: types.NewDatum(p), RetType: types.NewFieldType(mysql.TypeDouble)}
+		return NewAggFunction(ast.AggFuncPercentileCont, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0), arg}, false)
+	}
+	// The sorted values are 15, 20, 35, 40, 50, the rank of p is p * 4.
+	tests := []struct {
+		p      float64
+		expect float64
+	}{
+		{0, 15},
+		{1, 50},
+		{0.5, 35},
+		{0.25, 20},
+		{0.4, 29},
+		{0.9, 46},
+		{0.1, 17},
+	}
+	for _, t := range tests {
+		f := newPercentileCont(t.p)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeDouble)
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(math.Abs(d.GetFloat64()-t.expect) < 1e-9, IsTrue, Commentf("p %v: got %v", t.p, d.GetFloat64()))
+		}
+	}
+
+	// Empty group results in NULL.
+	f := newPercentileCont(0.5)
+	updateAll(c, f, nil, [][]types.Datum{types.MakeDatums(nil)})
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+
+	// The percentile should be a constant in [0, 1].
+	for _, p := range []interface{}{1.5, -0.1, nil} {
+		c.Assert(newPercentileCont(p).Update(rows[0], nil, sc), NotNil)
+	}
+	f = NewAggFunction(ast.AggFuncPercentileCont, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0), newColumnWithType(mysql.TypeDouble, 0)}, false)
+	c.Assert(f.Update(rows[0], nil, sc), NotNil)
+}
+
+func (s *testAggFuncSuite) TestApproxPercentile(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	newApproxPercentile := func(p interface{}, compression ...interface{}) Aggregation {
+		args := []expression.Expression{
+			newColumnWithType(mysql.TypeDouble, 0),
+			&expression.Constant{Value: types.NewDatum(p), RetType: types.NewFieldType(mysql.TypeDouble)},
+		}
+		for _, v := range compression {
+			args = append(args, &expression.Constant{Value: types.NewDatum(v), RetType: types.NewFieldType(mysql.TypeLonglong)})
+		}
+		return NewAggFunction(ast.AggFuncApproxPercentile, args, false)
+	}
+
+	// A small group is kept exactly, so it's the same as percentile_cont.
+	var rows [][]types.Datum
+	for _, v := range []interface{}{40, nil, 15, 50, 20, nil, 35} {
+		rows = append(rows, types.MakeDatums(v))
+	}
+	for _, t := range []struct {
+		p      float64
+		expect float64
+	}{{0, 15}, {1, 50}, {0.5, 35}, {0.4, 29}, {0.9, 46}} {
+		f := newApproxPercentile(t.p)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeDouble)
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(math.Abs(d.GetFloat64()-t.expect) < 1e-9, IsTrue, Commentf("p %v: got %v", t.p, d.GetFloat64()))
+		}
+	}
+
+	// The rank of the estimate on a large skewed group is close to p.
+	r := rand.New(rand.NewSource(1))
+	rows = rows[:0]
+	values := make([]float64, 0, 100000)
+	for i := 0; i < 100000; i++ {
+		if i%10 == 0 {
+			rows = append(rows, types.MakeDatums(nil))
+		}
+		v := r.ExpFloat64() * 100
+		values = append(values, v)
+		rows = append(rows, types.MakeDatums(v))
+	}
+	sort.Float64s(values)
+	for _, p := range []float64{0, 0.001, 0.01, 0.25, 0.5, 0.75, 0.99, 0.999, 1} {
+		for _, compression := range []interface{}{nil, 20, 500} {
+			var f Aggregation
+			if compression == nil {
+				f = newApproxPercentile(p)
+			} else {
+				f = newApproxPercentile(p, compression)
+			}
+			updateAll(c, f, nil, rows)
+			d := f.GetGroupResult(nil)
+			rank := float64(sort.SearchFloat64s(values, d.GetFloat64())) / float64(len(values)-1)
+			tolerance := 0.01
+			if compression == 20 {
+				tolerance = 0.03
+			}
+			c.Assert(math.Abs(rank-p) <= tolerance, IsTrue, Commentf("p %v compression %v: got %v at rank %v", p, compression, d.GetFloat64(), rank))
+			d = f.GetStreamResult()
+			c.Assert(math.Abs(float64(sort.SearchFloat64s(values, d.GetFloat64()))/float64(len(values)-1)-p) <= tolerance, IsTrue)
+			// The memory is bounded by the compression.
+			c.Assert(len(f.(*approxPercentileFunction).getContext(nil).Digest.centroids), Less, 1000)
+		}
+	}
+
+	// The clone has its own copy of the digest.
+	f := newApproxPercentile(0.5)
+	updateAll(c, f, []byte("a"), rows[:1000])
+	nf := f.Clone()
+	expect := nf.GetGroupResult([]byte("a"))
+	updateAll(c, f, []byte("a"), rows[1000:])
+	d := nf.GetGroupResult([]byte("a"))
+	c.Assert(d.GetFloat64(), Equals, expect.GetFloat64())
+	d = f.GetGroupResult([]byte("a"))
+	c.Assert(d.GetFloat64(), Not(Equals), expect.GetFloat64())
+	c.Assert(nf.(*approxPercentileFunction).getContext([]byte("a")).Digest, Not(Equals), f.(*approxPercentileFunction).getContext([]byte("a")).Digest)
+	d = nf.GetStreamResult()
+	c.Assert(d.GetFloat64(), Equals, expect.GetFloat64())
+
+	// Empty group results in NULL.
+	f = newApproxPercentile(0.5)
+	updateAll(c, f, nil, [][]types.Datum{types.MakeDatums(nil)})
+	d = f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+
+	// The percentile should be a constant in [0, 1], the compression should be a constant in [20, 1000].
+	row := types.MakeDatums(1)
+	for _, p := range []interface{}{1.5, -0.1, nil} {
+		c.Assert(newApproxPercentile(p).Update(row, nil, sc), NotNil)
+	}
+	for _, compression := range []interface{}{10, 2000, nil} {
+		c.Assert(newApproxPercentile(0.5, compression).Update(row, nil, sc), NotNil)
+	}
+	f = NewAggFunction(ast.AggFuncApproxPercentile, []expression.Expression{newColumnWithType(mysql.TypeDouble, 0), newColumnWithType(mysql.TypeDouble, 0)}, false)
+	c.Assert(f.Update(row, nil, sc), NotNil)
+}
+
+func (s *testAggFuncSuite) TestCountStar(c *C) {
+	defer testleak.AfterTest(c)()
+	var rows [][]types.Datum
+	for _, v := range []interface{}{1, nil, 2, nil, 3} {
+		rows = append(rows, types.MakeDatums(v))
+	}
+	one := &expression.Constant{Value: types.NewDatum(1), RetType: types.NewFieldType(mysql.TypeLonglong)}
+	null := &expression.Constant{Value: types.Datum{}, RetType: types.NewFieldType(mysql.TypeLonglong)}
+	col := newColumnWithType(mysql.TypeLonglong, 0)
+	tests := []struct {
+		args    []expression.Expression
+		isStar  bool
+		expect  int64
+		expectB int64
+	}{
+		{[]expression.Expression{one}, true, 5, 2},
+		{nil, true, 5, 2},
+		{[]expression.Expression{null}, false, 0, 0},
+		{[]expression.Expression{col}, false, 3, 1},
+		{[]expression.Expression{one, col}, false, 3, 1},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(ast.AggFuncCount, t.args, false)
+		c.Assert(f.(*countFunction).isStar, Equals, t.isStar, Commentf("%v", t.args))
+		// The generic path gives the same results.
+		generic := &countFunction{aggFunction: newAggFunc(ast.AggFuncCount, t.args, false)}
+		for _, f := range []Aggregation{f, f.Clone(), generic} {
+			updateAll(c, f, []byte("a"), rows)
+			for _, row := range rows[:2] {
+				c.Assert(f.Update(row, []byte("b"), new(variable.StatementContext)), IsNil)
+			}
+			for _, d := range []types.Datum{f.GetGroupResult([]byte("a")), f.GetPartialResult([]byte("a"))[0], f.GetStreamResult()} {
+				c.Assert(d.GetInt64(), Equals, t.expect, Commentf("%v", t.args))
+			}
+			d := f.GetGroupResult([]byte("b"))
+			c.Assert(d.GetInt64(), Equals, t.expectB, Commentf("%v", t.args))
+		}
+	}
+
+	// The planner replaces the args of the final count by the partial counts,
+	// which are summed up.
+	final := NewAggFunction(ast.AggFuncCount, []expression.Expression{one}, false)
+	final.SetArgs([]expression.Expression{col})
+	c.Assert(final.(*countFunction).isStar, IsFalse)
+	final.SetMode(FinalMode)
+	c.Assert(final.Update(types.MakeDatums(2), nil, new(variable.StatementContext)), IsNil)
+	c.Assert(final.Update(types.MakeDatums(3), nil, new(variable.StatementContext)), IsNil)
+	d := final.GetGroupResult(nil)
+	c.Assert(d.GetInt64(), Equals, int64(5))
+
+	// count(distinct 1) counts a row at most.
+	f := NewAggFunction(ast.AggFuncCount, []expression.Expression{one}, true)
+	updateAll(c, f, nil, rows)
+	d = f.GetGroupResult(nil)
+	c.Assert(d.GetInt64(), Equals, int64(1))
+}
+
+func (s *testAggFuncSuite) TestCountDistinct(c *C) {
+	defer testleak.AfterTest(c)()
+	rows := [][]types.Datum{
+		types.MakeDatums(1, "a", 1.5),
+		types.MakeDatums(1, "a", 2.5),
+		types.MakeDatums(1, "b", 1.5),
+		types.MakeDatums(1, "a", 1.5),
+		types.MakeDatums(2, "a", 1.5),
+		types.MakeDatums(nil, "a", 1.5),
+		types.MakeDatums(1, nil, 1.5),
+		types.MakeDatums(2, "a", nil),
+	}
+	cols := []expression.Expression{
+		newColumnWithType(mysql.TypeLonglong, 0),
+		newColumnWithType(mysql.TypeVarString, 1),
+		newColumnWithType(mysql.TypeDouble, 2),
+	}
+	tests := []struct {
+		args   []expression.Expression
+		expect int64
+	}{
+		// (1, a), (1, b), (2, a), the rows with any NULL arg are skipped.
+		{cols[:2], 3},
+		// (1, a, 1.5), (1, a, 2.5), (1, b, 1.5), (2, a, 1.5).
+		{cols, 4},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(ast.AggFuncCount, t.args, true)
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetStreamResult()} {
+			c.Assert(d.GetInt64(), Equals, t.expect)
+		}
+	}
+
+	// The groups have their own distinct sets.
+	f := NewAggFunction(ast.AggFuncCount, cols[:2], true)
+	updateAll(c, f, []byte("a"), rows[:3])
+	updateAll(c, f, []byte("b"), rows[2:5])
+	d := f.GetGroupResult([]byte("a"))
+	c.Assert(d.GetInt64(), Equals, int64(2))
+	d = f.GetGroupResult([]byte("b"))
+	c.Assert(d.GetInt64(), Equals, int64(3))
+}
+
+func (s *testAggFuncSuite) TestSumAvgDistinct(c *C) {
+	defer testleak.AfterTest(c)()
+	var rows [][]types.Datum
+	for _, v := range []interface{}{1, 2, 2, nil, 3, 3, 3, nil} {
+		rows = append(rows, types.MakeDatums(v))
+	}
+	tests := []struct {
+		name     string
+		distinct bool
+		expect   *types.MyDecimal
+	}{
+		{ast.AggFuncSum, false, types.NewDecFromInt(14)},
+		{ast.AggFuncSum, true, types.NewDecFromInt(6)},
+		{ast.AggFuncAvg, false, types.NewDecFromFloatForTest(2.3333)},
+		{ast.AggFuncAvg, true, types.NewDecFromInt(2)},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(t.name, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, t.distinct)
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetStreamResult()} {
+			c.Assert(d.GetMysqlDecimal().Compare(t.expect), Equals, 0, Commentf("%s distinct %v: got %v", t.name, t.distinct, d.GetMysqlDecimal()))
+		}
+	}
+
+	// The clone copies the values seen so far, they are still counted once.
+	f := NewAggFunction(ast.AggFuncSum, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, true)
+	updateAll(c, f, nil, rows[:3])
+	nf := f.Clone()
+	updateAll(c, nf, nil, rows[2:])
+	d := nf.GetGroupResult(nil)
+	c.Assert(d.GetMysqlDecimal().Compare(types.NewDecFromInt(6)), Equals, 0)
+	d = nf.GetStreamResult()
+	c.Assert(d.GetMysqlDecimal().Compare(types.NewDecFromInt(6)), Equals, 0)
+	// The original function doesn't see the values fed to the clone.
+	updateAll(c, f, nil, [][]types.Datum{types.MakeDatums(3)})
+	d = f.GetGroupResult(nil)
+	c.Assert(d.GetMysqlDecimal().Compare(types.NewDecFromInt(6)), Equals, 0)
+}
+
+func (s *testAggFuncSuite) TestCountSumDefaultValue(c *C) {
+	defer testleak.AfterTest(c)()
+	ctx := mock.NewContext()
+	col := newColumnWithType(mysql.TypeLonglong, 0)
+	schema := expression.NewSchema(col)
+	one := &expression.Constant{Value: types.NewDatum(1), RetType: types.NewFieldType(mysql.TypeLonglong)}
+	// The inner column is NULL if the input is empty.
+	tests := []struct {
+		f      Aggregation
+		expect interface{}
+	}{
+		{NewAggFunction(ast.AggFuncCount, []expression.Expression{col}, false), int64(0)},
+		{NewAggFunction(ast.AggFuncCount, []expression.Expression{one}, false), int64(1)},
+		{NewAggFunction(ast.AggFuncSum, []expression.Expression{col}, false), nil},
+		{NewAggFunction(ast.AggFuncSum, []expression.Expression{one}, false), types.NewDecFromInt(1)},
+	}
+	for _, t := range tests {
+		d, valid := t.f.CalculateDefaultValue(schema, ctx)
+		c.Assert(valid, IsTrue)
+		c.Assert(d.GetValue(), DeepEquals, t.expect, Commentf("%s", t.f))
+	}
+
+	// The default value can't be calculated if the arg is not from the input.
+	outer := newColumnWithType(mysql.TypeLonglong, 1)
+	outer.Position = 1
+	_, valid := NewAggFunction(ast.AggFuncCount, []expression.Expression{outer}, false).CalculateDefaultValue(schema, ctx)
+	c.Assert(valid, IsFalse)
+}
+
+func (s *testAggFuncSuite) TestSumOverflow(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		tp     byte
+		unsign bool
+		values []interface{}
+		expect string
+	}{
+		{mysql.TypeLonglong, false, []interface{}{int64(math.MaxInt64), nil, int64(math.MaxInt64), int64(2)}, "18446744073709551616"},
+		{mysql.TypeLonglong, false, []interface{}{int64(math.MinInt64), int64(math.MinInt64)}, "-18446744073709551616"},
+		{mysql.TypeLonglong, false, []interface{}{int64(math.MaxInt64), int64(1), int64(-2)}, "9223372036854775806"},
+		{mysql.TypeLonglong, true, []interface{}{uint64(math.MaxUint64), uint64(math.MaxUint64)}, "36893488147419103230"},
+	}
+	for _, t := range tests {
+		col := newColumnWithType(t.tp, 0)
+		if t.unsign {
+			col.RetType.Flag |= mysql.UnsignedFlag
+		}
+		f := NewAggFunction(ast.AggFuncSum, []expression.Expression{col}, false)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeNewDecimal)
+		var rows [][]types.Datum
+		for _, v := range t.values {
+			rows = append(rows, types.MakeDatums(v))
+		}
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.Kind(), Equals, types.KindMysqlDecimal)
+			c.Assert(d.GetMysqlDecimal().String(), Equals, t.expect, Commentf("values %v", t.values))
+		}
+	}
+
+	// An empty group or a group of NULLs is NULL.
+	f := NewAggFunction(ast.AggFuncSum, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	updateAll(c, f, nil, [][]types.Datum{types.MakeDatums(nil)})
+	d := f.GetGroupResult(nil)
+	c.Assert(d.IsNull(), IsTrue)
+	d = f.GetGroupResult([]byte("empty"))
+	c.Assert(d.IsNull(), IsTrue)
+	d = f.GetStreamResult()
+	c.Assert(d.IsNull(), IsTrue)
+}
+
+func (s *testAggFuncSuite) TestCountIf(c *C) {
+	defer testleak.AfterTest(c)()
+	tests := []struct {
+		tp     byte
+		values []interface{}
+		expect int64
+	}{
+		{mysql.TypeLonglong, []interface{}{1, 0, nil, 5, -1, 0}, 3},
+		{mysql.TypeDouble, []interface{}{0.0, 1.5, nil}, 1},
+		{mysql.TypeVarString, []interface{}{"1", "0", "2", nil}, 2},
+		{mysql.TypeLonglong, []interface{}{nil, nil, 0}, 0},
+		{mysql.TypeLonglong, []interface{}{}, 0},
+	}
+	for _, t := range tests {
+		f := NewAggFunction(ast.AggFuncCountIf, []expression.Expression{newColumnWithType(t.tp, 0)}, false)
+		c.Assert(f.GetType().Tp, Equals, mysql.TypeLonglong)
+		var rows [][]types.Datum
+		for _, v := range t.values {
+			rows = append(rows, types.MakeDatums(v))
+		}
+		updateAll(c, f, nil, rows)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			c.Assert(d.GetInt64(), Equals, t.expect, Commentf("values %v", t.values))
+		}
+	}
+
+	// The partial counts are summed up in FinalMode.
+	final := NewAggFunction(ast.AggFuncCountIf, []expression.Expression{newColumnWithType(mysql.TypeLonglong, 0)}, false)
+	final.SetMode(FinalMode)
+	updateAll(c, final, nil, [][]types.Datum{types.MakeDatums(2), types.MakeDatums(0), types.MakeDatums(3)})
+	d := final.GetGroupResult(nil)
+	c.Assert(d.GetInt64(), Equals, int64(5))
+
+	ctx := mock.NewContext()
+	col := newColumnWithType(mysql.TypeLonglong, 0)
+	schema := expression.NewSchema(col)
+	one := &expression.Constant{Value: types.NewDatum(1), RetType: types.NewFieldType(mysql.TypeLonglong)}
+	for _, t := range []struct {
+		arg    expression.Expression
+		expect int64
+	}{{col, 0}, {one, 1}} {
+		d, valid := NewAggFunction(ast.AggFuncCountIf, []expression.Expression{t.arg}, false).CalculateDefaultValue(schema, ctx)
+		c.Assert(valid, IsTrue)
+		c.Assert(d.GetInt64(), Equals, t.expect)
+	}
+}
+
+func (s *testAggFuncSuite) TestWAvg(c *C) {
+	defer testleak.AfterTest(c)()
+	sc := new(variable.StatementContext)
+	newDec := func(s string) *types.MyDecimal {
+		d := new(types.MyDecimal)
+		c.Assert(d.FromString([]byte(s)), IsNil)
+		return d
+	}
+	tests := []struct {
+		valueTp  byte
+		weightTp byte
+		rows     [][]interface{}
+		resultTp byte
+		expect   interface{}
+	}{
+		// (10*1 + 20*3) / (1 + 3), the rows with NULL are skipped.
+		{mysql.TypeLonglong, mysql.TypeLonglong, [][]interface{}{{10, 1}, {20, 3}, {nil, 5}, {30, nil}}, mysql.TypeNewDecimal, newDec("17.5")},
+		// (1.5*0.5 + 3*1.5) / (0.5 + 1.5)
+		{mysql.TypeNewDecimal, mysql.TypeNewDecimal, [][]interface{}{{newDec("1.5"), newDec("0.5")}, {newDec("3"), newDec("1.5")}}, mysql.TypeNewDecimal, newDec("2.625")},
+		// (1*0.25 + 2*0.75) / (0.25 + 0.75)
+		{mysql.TypeLonglong, mysql.TypeDouble, [][]interface{}{{1, 0.25}, {2, 0.75}}, mysql.TypeDouble, 1.75},
+		// The total weight is zero.
+		{mysql.TypeLonglong, mysql.TypeLonglong, [][]interface{}{{5, 0}, {6, 0}}, mysql.TypeNewDecimal, nil},
+		{mysql.TypeDouble, mysql.TypeDouble, [][]interface{}{{5.0, 1.0}, {6.0, -1.0}}, mysql.TypeDouble, nil},
+		{mysql.TypeLonglong, mysql.TypeLonglong, [][]interface{}{{nil, 1}}, mysql.TypeNewDecimal, nil},
+	}
+	for i, t := range tests {
+		f := NewAggFunction(ast.AggFuncWAvg, []expression.Expression{newColumnWithType(t.valueTp, 0), newColumnWithType(t.weightTp, 1)}, false)
+		c.Assert(f.GetType().Tp, Equals, t.resultTp)
+		var rows [][]types.Datum
+		for _, row := range t.rows {
+			rows = append(rows, types.MakeDatums(row...))
+		}
+		updateAll(c, f, nil, rows)
+		expect := types.NewDatum(t.expect)
+		for _, d := range []types.Datum{f.GetGroupResult(nil), f.GetPartialResult(nil)[0], f.GetStreamResult()} {
+			cmp, err := d.CompareDatum(sc, expect)
+			c.Assert(err, IsNil)
+			c.Assert(cmp, Equals, 0, Commentf("%d: got %v", i, d))
+			c.Assert(d.IsNull(), Equals, t.expect == nil)
+		}
+	}
+}
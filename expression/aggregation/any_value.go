@@ -0,0 +1,104 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// anyValueFunction picks an arbitrary value of a group, it simply latches the
+// first value it meets, NULL included.
+type anyValueFunction struct {
+	aggFunction
+}
+
+// Clone implements Aggregation interface.
+func (avf *anyValueFunction) Clone() Aggregation {
+	nf := *avf
+	for i, arg := range avf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// CalculateDefaultValue implements Aggregation interface.
+func (avf *anyValueFunction) CalculateDefaultValue(schema *expression.Schema, ctx context.Context) (d types.Datum, valid bool) {
+	arg := avf.Args[0]
+	result, err := expression.EvaluateExprWithNull(ctx, schema, arg)
+	if err != nil {
+		log.Warnf("Evaluate expr with null failed in function %s, err msg is %s", avf, err.Error())
+		return d, false
+	}
+	if con, ok := result.(*expression.Constant); ok {
+		return con.Value, true
+	}
+	return d, false
+}
+
+// GetType implements Aggregation interface.
+func (avf *anyValueFunction) GetType() *types.FieldType {
+	return avf.Args[0].GetType()
+}
+
+func (avf *anyValueFunction) updateValue(ctx *aggEvaluateContext, row []types.Datum) error {
+	if ctx.GotFirstRow {
+		return nil
+	}
+	if len(avf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncAnyValue")
+	}
+	value, err := avf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ctx.Value = value
+	ctx.GotFirstRow = true
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (avf *anyValueFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return avf.updateValue(avf.getContext(groupKey), row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (avf *anyValueFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return avf.updateValue(avf.getStreamedContext(), row)
+}
+
+// GetGroupResult implements Aggregation interface.
+func (avf *anyValueFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return avf.getContext(groupKey).Value
+}
+
+// GetPartialResult implements Aggregation interface.
+func (avf *anyValueFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{avf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (avf *anyValueFunction) GetStreamResult() (d types.Datum) {
+	if avf.streamCtx == nil {
+		return
+	}
+	d = avf.streamCtx.Value
+	avf.streamCtx = nil
+	return
+}
@@ -0,0 +1,252 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"math"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tidb/util/types"
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	defaultHLLRegisters = 4096
+	minHLLRegisters     = 16
+	maxHLLRegisters     = 65536
+)
+
+// hllSketch is a HyperLogLog sketch, it estimates the number of distinct values
+// with a standard error of about 1.04 / sqrt(len(registers)).
+type hllSketch struct {
+	// precision is log2(len(registers)).
+	precision uint
+	registers []uint8
+	buf       []byte
+}
+
+func newHLLSketch(registerCount int) *hllSketch {
+	return &hllSketch{
+		precision: trailingZeros(uint64(registerCount)),
+		registers: make([]uint8, registerCount),
+	}
+}
+
+// trailingZeros returns the number of trailing zero bits of x, x must not be 0.
+func trailingZeros(x uint64) uint {
+	var n uint
+	for x&1 == 0 {
+		x >>= 1
+		n++
+	}
+	return n
+}
+
+// leadingZeros returns the number of leading zero bits of x, x must not be 0.
+func leadingZeros(x uint64) uint {
+	var n uint
+	for x&(1<<63) == 0 {
+		x <<= 1
+		n++
+	}
+	return n
+}
+
+// insert adds the hash of the encoded d to the sketch.
+func (s *hllSketch) insert(d types.Datum) error {
+	var err error
+	s.buf, err = codec.EncodeValue(s.buf[:0], d)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	hash := murmur3.Sum64(s.buf)
+	idx := hash >> (64 - s.precision)
+	// The rank is the position of the first 1 bit in the remaining bits, the
+	// sentinel bit bounds it when they're all 0.
+	rank := uint8(leadingZeros(hash<<s.precision|1<<(s.precision-1))) + 1
+	if rank > s.registers[idx] {
+		s.registers[idx] = rank
+	}
+	return nil
+}
+
+// estimate returns the estimated number of distinct values inserted.
+func (s *hllSketch) estimate() int64 {
+	m := float64(len(s.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range s.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	var alpha float64
+	switch len(s.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	e := alpha * m * m / sum
+	// Use linear counting for small cardinalities.
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(e + 0.5)
+}
+
+func (s *hllSketch) clone() *hllSketch {
+	ns := &hllSketch{
+		precision: s.precision,
+		registers: make([]uint8, len(s.registers)),
+	}
+	copy(ns.registers, s.registers)
+	return ns
+}
+
+// approxCountDistinctFunction estimates the number of distinct non-NULL values
+// with a HyperLogLog sketch. The optional second argument is a constant register
+// count, a power of 2 in [16, 65536], more registers give a better estimate.
+type approxCountDistinctFunction struct {
+	aggFunction
+}
+
+func cloneApproxCountDistinctContext(ctx *aggEvaluateContext) *aggEvaluateContext {
+	nctx := *ctx
+	if ctx.Sketch != nil {
+		nctx.Sketch = ctx.Sketch.clone()
+	}
+	return &nctx
+}
+
+// Clone implements Aggregation interface.
+// The sketches built so far are copied, so the clone doesn't share them with af.
+func (af *approxCountDistinctFunction) Clone() Aggregation {
+	nf := *af
+	for i, arg := range af.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper, len(af.resultMapper))
+	for key, ctx := range af.resultMapper {
+		nf.resultMapper[key] = cloneApproxCountDistinctContext(ctx)
+	}
+	if af.streamCtx != nil {
+		nf.streamCtx = cloneApproxCountDistinctContext(af.streamCtx)
+	}
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (af *approxCountDistinctFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeLonglong)
+	ft.Flen = 21
+	types.SetBinChsClnFlag(ft)
+	return ft
+}
+
+// registerCount evaluates the register count argument, it must be a constant
+// power of 2 in [16, 65536].
+func (af *approxCountDistinctFunction) registerCount(sc *variable.StatementContext) (int, error) {
+	if len(af.Args) == 1 {
+		return defaultHLLRegisters, nil
+	}
+	if _, ok := af.Args[1].(*expression.Constant); !ok {
+		return 0, errors.New("The register count of AggFuncApproxCountDistinct should be a constant")
+	}
+	d, err := af.Args[1].Eval(nil)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if d.IsNull() {
+		return 0, errors.New("The register count of AggFuncApproxCountDistinct should not be NULL")
+	}
+	n, err := d.ToInt64(sc)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if n < minHLLRegisters || n > maxHLLRegisters || n&(n-1) != 0 {
+		return 0, errors.Errorf("The register count of AggFuncApproxCountDistinct should be a power of 2 in [%d, %d], got %d",
+			minHLLRegisters, maxHLLRegisters, n)
+	}
+	return int(n), nil
+}
+
+func (af *approxCountDistinctFunction) updateSketch(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(af.Args) != 1 && len(af.Args) != 2 {
+		return errors.New("Wrong number of args for AggFuncApproxCountDistinct")
+	}
+	registerCount, err := af.registerCount(sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	value, err := af.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	if ctx.Sketch == nil {
+		ctx.Sketch = newHLLSketch(registerCount)
+	}
+	return errors.Trace(ctx.Sketch.insert(value))
+}
+
+// Update implements Aggregation interface.
+func (af *approxCountDistinctFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return af.updateSketch(af.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (af *approxCountDistinctFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return af.updateSketch(af.getStreamedContext(), row, sc)
+}
+
+func (af *approxCountDistinctFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if ctx.Sketch == nil {
+		d.SetInt64(0)
+		return
+	}
+	d.SetInt64(ctx.Sketch.estimate())
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (af *approxCountDistinctFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return af.calculateResult(af.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (af *approxCountDistinctFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{af.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (af *approxCountDistinctFunction) GetStreamResult() (d types.Datum) {
+	if af.streamCtx == nil {
+		return types.NewDatum(0)
+	}
+	d = af.calculateResult(af.streamCtx)
+	af.streamCtx = nil
+	return
+}
@@ -0,0 +1,274 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"math"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+const (
+	defaultTDigestCompression = 100
+	minTDigestCompression     = 20
+	maxTDigestCompression     = 1000
+)
+
+type centroid struct {
+	mean  float64
+	count float64
+}
+
+// tDigest is a merging t-digest, it summarizes the values by at most about
+// compression * pi / 2 centroids, which are small near the ends, so the
+// extreme quantiles are more accurate than the median.
+type tDigest struct {
+	compression float64
+	// centroids are merged and sorted by mean, the new values are buffered in
+	// unmerged until it's full.
+	centroids []centroid
+	unmerged  []centroid
+	count     float64
+	min, max  float64
+}
+
+func newTDigest(compression float64) *tDigest {
+	return &tDigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+func (t *tDigest) insert(x float64) {
+	t.unmerged = append(t.unmerged, centroid{mean: x, count: 1})
+	t.count++
+	t.min = math.Min(t.min, x)
+	t.max = math.Max(t.max, x)
+	if len(t.unmerged) >= int(5*t.compression) {
+		t.merge()
+	}
+}
+
+// scale maps the quantile q to the k scale, a centroid can't span more than 1
+// on it.
+func (t *tDigest) scale(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// merge merges the unmerged values into the centroids.
+func (t *tDigest) merge() {
+	if len(t.unmerged) == 0 {
+		return
+	}
+	all := append(t.unmerged, t.centroids...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+	merged := t.centroids[:0]
+	cur := all[0]
+	var soFar float64
+	kLow := t.scale(0)
+	for _, c := range all[1:] {
+		if t.scale((soFar+cur.count+c.count)/t.count)-kLow <= 1 {
+			cur.count += c.count
+			cur.mean += (c.mean - cur.mean) * c.count / cur.count
+			continue
+		}
+		soFar += cur.count
+		kLow = t.scale(soFar / t.count)
+		merged = append(merged, cur)
+		cur = c
+	}
+	t.centroids = append(merged, cur)
+	t.unmerged = t.unmerged[:0]
+}
+
+// quantile estimates the value at the rank q * (count - 1) like percentile_cont,
+// it's linearly interpolated between the centers of the two nearest centroids.
+func (t *tDigest) quantile(q float64) float64 {
+	t.merge()
+	// The center of a centroid is at the middle of its ranks, the rank is
+	// shifted by 0.5 so the values being their own centroids are exact.
+	target := q*(t.count-1) + 0.5
+	var soFar float64
+	prevMean, prevCenter := t.min, 0.5
+	for _, c := range t.centroids {
+		center := soFar + c.count/2
+		if target <= center {
+			if center <= prevCenter {
+				return c.mean
+			}
+			return prevMean + (target-prevCenter)/(center-prevCenter)*(c.mean-prevMean)
+		}
+		soFar += c.count
+		prevMean, prevCenter = c.mean, center
+	}
+	lastCenter := t.count - 0.5
+	if lastCenter <= prevCenter {
+		return t.max
+	}
+	return prevMean + (target-prevCenter)/(lastCenter-prevCenter)*(t.max-prevMean)
+}
+
+func (t *tDigest) clone() *tDigest {
+	nt := *t
+	nt.centroids = append([]centroid(nil), t.centroids...)
+	nt.unmerged = append([]centroid(nil), t.unmerged...)
+	return &nt
+}
+
+// approxPercentileFunction estimates percentile_cont of the non-NULL values with
+// a t-digest, so the memory of a group is bounded. It takes the value, the
+// constant percentile in [0, 1] and an optional constant compression in
+// [20, 1000], a larger compression gives a better estimate with more centroids.
+type approxPercentileFunction struct {
+	aggFunction
+}
+
+func cloneApproxPercentileContext(ctx *aggEvaluateContext) *aggEvaluateContext {
+	nctx := *ctx
+	if ctx.Digest != nil {
+		nctx.Digest = ctx.Digest.clone()
+	}
+	return &nctx
+}
+
+// Clone implements Aggregation interface.
+// The digests built so far are copied, so the clone doesn't share them with af.
+func (af *approxPercentileFunction) Clone() Aggregation {
+	nf := *af
+	for i, arg := range af.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper, len(af.resultMapper))
+	for key, ctx := range af.resultMapper {
+		nf.resultMapper[key] = cloneApproxPercentileContext(ctx)
+	}
+	if af.streamCtx != nil {
+		nf.streamCtx = cloneApproxPercentileContext(af.streamCtx)
+	}
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (af *approxPercentileFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeDouble)
+	types.SetBinChsClnFlag(ft)
+	ft.Flen, ft.Decimal = mysql.MaxRealWidth, types.UnspecifiedLength
+	return ft
+}
+
+// compression evaluates the compression argument, it must be a constant in
+// [20, 1000].
+func (af *approxPercentileFunction) compression(sc *variable.StatementContext) (float64, error) {
+	if len(af.Args) == 2 {
+		return defaultTDigestCompression, nil
+	}
+	if _, ok := af.Args[2].(*expression.Constant); !ok {
+		return 0, errors.New("The compression of AggFuncApproxPercentile should be a constant")
+	}
+	d, err := af.Args[2].Eval(nil)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if d.IsNull() {
+		return 0, errors.New("The compression of AggFuncApproxPercentile should not be NULL")
+	}
+	c, err := d.ToFloat64(sc)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if c < minTDigestCompression || c > maxTDigestCompression {
+		return 0, errors.Errorf("The compression of AggFuncApproxPercentile should be in [%d, %d], got %v",
+			minTDigestCompression, maxTDigestCompression, c)
+	}
+	return c, nil
+}
+
+func (af *approxPercentileFunction) updateDigest(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(af.Args) != 2 && len(af.Args) != 3 {
+		return errors.New("Wrong number of args for AggFuncApproxPercentile")
+	}
+	if _, err := evalPercentile(af.Args[1], "AggFuncApproxPercentile", sc); err != nil {
+		return errors.Trace(err)
+	}
+	compression, err := af.compression(sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	value, err := af.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	x, err := value.ToFloat64(sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if ctx.Digest == nil {
+		ctx.Digest = newTDigest(compression)
+	}
+	ctx.Digest.insert(x)
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (af *approxPercentileFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return af.updateDigest(af.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (af *approxPercentileFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return af.updateDigest(af.getStreamedContext(), row, sc)
+}
+
+func (af *approxPercentileFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if ctx.Digest == nil {
+		return
+	}
+	p, err := evalPercentile(af.Args[1], "AggFuncApproxPercentile", new(variable.StatementContext))
+	if err != nil {
+		log.Warnf("Calculate approx percentile failed in function %s, err msg is %s", af, err.Error())
+		return
+	}
+	d.SetFloat64(ctx.Digest.quantile(p))
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (af *approxPercentileFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return af.calculateResult(af.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (af *approxPercentileFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{af.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (af *approxPercentileFunction) GetStreamResult() (d types.Datum) {
+	if af.streamCtx == nil {
+		return
+	}
+	d = af.calculateResult(af.streamCtx)
+	af.streamCtx = nil
+	return
+}
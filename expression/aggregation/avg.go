@@ -25,12 +25,19 @@ type avgFunction struct {
 }
 
 // Clone implements Aggregation interface.
+// The values summed so far are copied, including the ones seen by DISTINCT.
 func (af *avgFunction) Clone() Aggregation {
 	nf := *af
 	for i, arg := range af.Args {
 		nf.Args[i] = arg.Clone()
 	}
-	nf.resultMapper = make(aggCtxMapper)
+	nf.resultMapper = make(aggCtxMapper, len(af.resultMapper))
+	for key, ctx := range af.resultMapper {
+		nf.resultMapper[key] = cloneDistinctContext(ctx)
+	}
+	if af.streamCtx != nil {
+		nf.streamCtx = cloneDistinctContext(af.streamCtx)
+	}
 	return &nf
 }
 
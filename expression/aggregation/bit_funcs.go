@@ -0,0 +1,181 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"math"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// bitFunction is the common part of bit_and, bit_or and bit_xor. The running
+// result is kept in the Value of the context as an uint64, and a context which
+// hasn't met any non-NULL value yields the identity of the operation.
+type bitFunction struct {
+	aggFunction
+	identity uint64
+	calc     func(x, y uint64) uint64
+}
+
+func (bf *bitFunction) clone() bitFunction {
+	nf := *bf
+	for i, arg := range bf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return nf
+}
+
+// CalculateDefaultValue implements Aggregation interface.
+func (bf *bitFunction) CalculateDefaultValue(schema *expression.Schema, ctx context.Context) (d types.Datum, valid bool) {
+	result, err := expression.EvaluateExprWithNull(ctx, schema, bf.Args[0])
+	if err != nil {
+		log.Warnf("Evaluate expr with null failed in function %s, err msg is %s", bf, err.Error())
+		return d, false
+	}
+	if con, ok := result.(*expression.Constant); ok && con.Value.IsNull() {
+		return types.NewUintDatum(bf.identity), true
+	}
+	return d, false
+}
+
+// GetType implements Aggregation interface.
+func (bf *bitFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeLonglong)
+	ft.Flen = 21
+	types.SetBinChsClnFlag(ft)
+	ft.Flag |= mysql.UnsignedFlag
+	return ft
+}
+
+func (bf *bitFunction) updateValue(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(bf.Args) != 1 {
+		return errors.Errorf("Wrong number of args for AggFunc%s", bf.name)
+	}
+	value, err := bf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	var v uint64
+	if value.Kind() == types.KindUint64 {
+		v = value.GetUint64()
+	} else {
+		i, err := value.ToInt64(sc)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		v = uint64(i)
+	}
+	result := bf.identity
+	if !ctx.Value.IsNull() {
+		result = ctx.Value.GetUint64()
+	}
+	ctx.Value.SetUint64(bf.calc(result, v))
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (bf *bitFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return bf.updateValue(bf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (bf *bitFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return bf.updateValue(bf.getStreamedContext(), row, sc)
+}
+
+func (bf *bitFunction) calculateResult(ctx *aggEvaluateContext) types.Datum {
+	if ctx.Value.IsNull() {
+		return types.NewUintDatum(bf.identity)
+	}
+	return ctx.Value
+}
+
+// GetGroupResult implements Aggregation interface.
+func (bf *bitFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return bf.calculateResult(bf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (bf *bitFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{bf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (bf *bitFunction) GetStreamResult() types.Datum {
+	if bf.streamCtx == nil {
+		return types.NewUintDatum(bf.identity)
+	}
+	d := bf.calculateResult(bf.streamCtx)
+	bf.streamCtx = nil
+	return d
+}
+
+type bitAndFunction struct {
+	bitFunction
+}
+
+func newBitAndFunction(base aggFunction) *bitAndFunction {
+	return &bitAndFunction{bitFunction{
+		aggFunction: base,
+		identity:    math.MaxUint64,
+		calc:        func(x, y uint64) uint64 { return x & y },
+	}}
+}
+
+// Clone implements Aggregation interface.
+func (bf *bitAndFunction) Clone() Aggregation {
+	return &bitAndFunction{bf.clone()}
+}
+
+type bitOrFunction struct {
+	bitFunction
+}
+
+func newBitOrFunction(base aggFunction) *bitOrFunction {
+	return &bitOrFunction{bitFunction{
+		aggFunction: base,
+		calc:        func(x, y uint64) uint64 { return x | y },
+	}}
+}
+
+// Clone implements Aggregation interface.
+func (bf *bitOrFunction) Clone() Aggregation {
+	return &bitOrFunction{bf.clone()}
+}
+
+type bitXorFunction struct {
+	bitFunction
+}
+
+func newBitXorFunction(base aggFunction) *bitXorFunction {
+	return &bitXorFunction{bitFunction{
+		aggFunction: base,
+		calc:        func(x, y uint64) uint64 { return x ^ y },
+	}}
+}
+
+// Clone implements Aggregation interface.
+func (bf *bitXorFunction) Clone() Aggregation {
+	return &bitXorFunction{bf.clone()}
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tidb/util/types"
+	"github.com/pingcap/tidb/util/types/json"
+)
+
+// datumSet is a set of datums keyed on their encoded values, it keeps the
+// datums in the order they're first inserted.
+type datumSet struct {
+	keys   map[string]struct{}
+	values []types.Datum
+	buf    []byte
+}
+
+func newDatumSet() *datumSet {
+	return &datumSet{keys: make(map[string]struct{})}
+}
+
+// insert adds d to the set if it isn't there yet.
+func (s *datumSet) insert(d types.Datum) error {
+	var err error
+	s.buf, err = codec.EncodeValue(s.buf[:0], d)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, ok := s.keys[string(s.buf)]; ok {
+		return nil
+	}
+	s.keys[string(s.buf)] = struct{}{}
+	s.values = append(s.values, types.CopyDatum(d))
+	return nil
+}
+
+func (s *datumSet) clone() *datumSet {
+	ns := &datumSet{
+		keys:   make(map[string]struct{}, len(s.keys)),
+		values: make([]types.Datum, 0, len(s.values)),
+	}
+	for key := range s.keys {
+		ns.keys[key] = struct{}{}
+	}
+	for _, value := range s.values {
+		ns.values = append(ns.values, types.CopyDatum(value))
+	}
+	return ns
+}
+
+// collectSetFunction collects the distinct non-NULL values of a group into a
+// JSON array, in the order they first arrive.
+type collectSetFunction struct {
+	aggFunction
+}
+
+func cloneCollectSetContext(ctx *aggEvaluateContext) *aggEvaluateContext {
+	nctx := *ctx
+	if ctx.Set != nil {
+		nctx.Set = ctx.Set.clone()
+	}
+	return &nctx
+}
+
+// Clone implements Aggregation interface.
+// The sets collected so far are copied, so the clone doesn't share them with cf.
+func (cf *collectSetFunction) Clone() Aggregation {
+	nf := *cf
+	for i, arg := range cf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper, len(cf.resultMapper))
+	for key, ctx := range cf.resultMapper {
+		nf.resultMapper[key] = cloneCollectSetContext(ctx)
+	}
+	if cf.streamCtx != nil {
+		nf.streamCtx = cloneCollectSetContext(cf.streamCtx)
+	}
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (cf *collectSetFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeJSON)
+	types.SetBinChsClnFlag(ft)
+	return ft
+}
+
+func (cf *collectSetFunction) updateValues(ctx *aggEvaluateContext, row []types.Datum) error {
+	if len(cf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncCollectSet")
+	}
+	value, err := cf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	if ctx.Set == nil {
+		ctx.Set = newDatumSet()
+	}
+	return errors.Trace(ctx.Set.insert(value))
+}
+
+// Update implements Aggregation interface.
+func (cf *collectSetFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return cf.updateValues(cf.getContext(groupKey), row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (cf *collectSetFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return cf.updateValues(cf.getStreamedContext(), row)
+}
+
+func (cf *collectSetFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if ctx.Set == nil {
+		return
+	}
+	sc := new(variable.StatementContext)
+	elems := make([]json.JSON, 0, len(ctx.Set.values))
+	for _, value := range ctx.Set.values {
+		j, err := datumToJSON(sc, value)
+		if err != nil {
+			log.Warnf("Calculate collect_set failed in function %s, err msg is %s", cf, err.Error())
+			return types.Datum{}
+		}
+		elems = append(elems, j)
+	}
+	d.SetMysqlJSON(json.CreateJSON(elems))
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (cf *collectSetFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return cf.calculateResult(cf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (cf *collectSetFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{cf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (cf *collectSetFunction) GetStreamResult() (d types.Datum) {
+	if cf.streamCtx == nil {
+		return
+	}
+	d = cf.calculateResult(cf.streamCtx)
+	cf.streamCtx = nil
+	return
+}
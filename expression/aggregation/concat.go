@@ -18,13 +18,32 @@ import (
 	"fmt"
 
 	"github.com/juju/errors"
+	"github.com/pingcap/tidb/ast"
+	"github.com/pingcap/tidb/expression"
 	"github.com/pingcap/tidb/mysql"
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/util/types"
 )
 
+// defaultGroupConcatSeparator is the separator used if it's not specified.
+const defaultGroupConcatSeparator = ","
+
 type concatFunction struct {
 	aggFunction
+	separator string
+	// maxLen is the max length of the result, the result is truncated if it's longer.
+	// Zero means no limit.
+	maxLen int
+}
+
+// NewGroupConcatFunction creates a group_concat function with the separator, the
+// result is truncated to maxLen bytes like group_concat_max_len if maxLen is positive.
+func NewGroupConcatFunction(funcArgs []expression.Expression, distinct bool, separator string, maxLen int) Aggregation {
+	return &concatFunction{
+		aggFunction: newAggFunc(ast.AggFuncGroupConcat, funcArgs, distinct),
+		separator:   separator,
+		maxLen:      maxLen,
+	}
 }
 
 // Clone implements Aggregation interface.
@@ -50,9 +69,7 @@ func (cf *concatFunction) writeValue(ctx *aggEvaluateContext, val types.Datum) {
 	}
 }
 
-// Update implements Aggregation interface.
-func (cf *concatFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
-	ctx := cf.getContext(groupKey)
+func (cf *concatFunction) updateConcat(ctx *aggEvaluateContext, row []types.Datum) error {
 	cf.datumBuf = cf.datumBuf[:0]
 	for _, a := range cf.Args {
 		value, err := a.Eval(row)
@@ -76,50 +93,28 @@ func (cf *concatFunction) Update(row []types.Datum, groupKey []byte, sc *variabl
 	if ctx.Buffer == nil {
 		ctx.Buffer = &bytes.Buffer{}
 	} else {
-		// now use comma separator
-		ctx.Buffer.WriteString(",")
+		if cf.maxLen > 0 && ctx.Buffer.Len() >= cf.maxLen {
+			return nil
+		}
+		ctx.Buffer.WriteString(cf.separator)
 	}
 	for _, val := range cf.datumBuf {
 		cf.writeValue(ctx, val)
 	}
-	// TODO: if total length is greater than global var group_concat_max_len, truncate it.
+	if cf.maxLen > 0 && ctx.Buffer.Len() > cf.maxLen {
+		ctx.Buffer.Truncate(cf.maxLen)
+	}
 	return nil
 }
 
+// Update implements Aggregation interface.
+func (cf *concatFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return cf.updateConcat(cf.getContext(groupKey), row)
+}
+
 // StreamUpdate implements Aggregation interface.
 func (cf *concatFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
-	ctx := cf.getStreamedContext()
-	cf.datumBuf = cf.datumBuf[:0]
-	for _, a := range cf.Args {
-		value, err := a.Eval(row)
-		if err != nil {
-			return errors.Trace(err)
-		}
-		if value.GetValue() == nil {
-			return nil
-		}
-		cf.datumBuf = append(cf.datumBuf, value)
-	}
-	if cf.Distinct {
-		d, err := ctx.DistinctChecker.Check(cf.datumBuf)
-		if err != nil {
-			return errors.Trace(err)
-		}
-		if !d {
-			return nil
-		}
-	}
-	if ctx.Buffer == nil {
-		ctx.Buffer = &bytes.Buffer{}
-	} else {
-		// now use comma separator
-		ctx.Buffer.WriteString(",")
-	}
-	for _, val := range cf.datumBuf {
-		cf.writeValue(ctx, val)
-	}
-	// TODO: if total length is greater than global var group_concat_max_len, truncate it.
-	return nil
+	return cf.updateConcat(cf.getStreamedContext(), row)
 }
 
 // GetGroupResult implements Aggregation interface.
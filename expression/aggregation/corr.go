@@ -0,0 +1,150 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"math"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// corrFunction calculates the Pearson correlation coefficient of x and y. Like
+// varianceFunction, it keeps the running means and the sums of the squared and
+// the cross differences from the means, rather than the sums of x², y² and xy,
+// which lose precision by cancellation.
+type corrFunction struct {
+	aggFunction
+}
+
+// coMoments is the running state of corr and covariance, Count of the context
+// is the number of the pairs.
+type coMoments struct {
+	meanX, meanY float64
+	m2X, m2Y     float64
+	cXY          float64
+}
+
+// Clone implements Aggregation interface.
+func (cf *corrFunction) Clone() Aggregation {
+	nf := *cf
+	for i, arg := range cf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (cf *corrFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeDouble)
+	types.SetBinChsClnFlag(ft)
+	ft.Flen, ft.Decimal = mysql.MaxRealWidth, types.UnspecifiedLength
+	return ft
+}
+
+// updateCoMoments adds the pair of the two args in row to the co-moments of ctx.
+func (af *aggFunction) updateCoMoments(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(af.Args) != 2 {
+		return errors.Errorf("Wrong number of args for %s", af.name)
+	}
+	values := af.datumBuf[:0]
+	for _, arg := range af.Args {
+		value, err := arg.Eval(row)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		// The row is skipped if either of x and y is NULL.
+		if value.IsNull() {
+			return nil
+		}
+		values = append(values, value)
+	}
+	af.datumBuf = values
+	if af.Distinct {
+		d, err := ctx.DistinctChecker.Check(values)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !d {
+			return nil
+		}
+	}
+	x, err := values[0].ToFloat64(sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	y, err := values[1].ToFloat64(sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if ctx.Moments == nil {
+		ctx.Moments = &coMoments{}
+	}
+	m := ctx.Moments
+	ctx.Count++
+	n := float64(ctx.Count)
+	deltaX, deltaY := x-m.meanX, y-m.meanY
+	m.meanX += deltaX / n
+	m.meanY += deltaY / n
+	m.m2X += deltaX * (x - m.meanX)
+	m.m2Y += deltaY * (y - m.meanY)
+	m.cXY += deltaX * (y - m.meanY)
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (cf *corrFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return cf.updateCoMoments(cf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (cf *corrFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return cf.updateCoMoments(cf.getStreamedContext(), row, sc)
+}
+
+// calculateResult returns NULL if the group is empty or either of the
+// variances is zero.
+func (cf *corrFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	m := ctx.Moments
+	if ctx.Count == 0 || m == nil || m.m2X == 0 || m.m2Y == 0 {
+		return
+	}
+	r := m.cXY / math.Sqrt(m.m2X*m.m2Y)
+	// Keep the rounding error in [-1, 1].
+	d.SetFloat64(math.Max(-1, math.Min(1, r)))
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (cf *corrFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return cf.calculateResult(cf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (cf *corrFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{cf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (cf *corrFunction) GetStreamResult() (d types.Datum) {
+	if cf.streamCtx == nil {
+		return
+	}
+	d = cf.calculateResult(cf.streamCtx)
+	cf.streamCtx = nil
+	return
+}
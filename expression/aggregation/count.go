@@ -25,6 +25,31 @@ import (
 
 type countFunction struct {
 	aggFunction
+	// isStar is set if all the args are non-NULL constants, like count(*), then
+	// Update counts the rows without evaluating the args in CompleteMode.
+	isStar bool
+}
+
+// isCountStar checks if the args of count are never NULL, count(*) is parsed as count(1).
+func isCountStar(args []expression.Expression) bool {
+	for _, arg := range args {
+		con, ok := arg.(*expression.Constant)
+		if !ok || con.Value.IsNull() {
+			return false
+		}
+	}
+	return true
+}
+
+// SetArgs implements Aggregation interface.
+func (cf *countFunction) SetArgs(args []expression.Expression) {
+	cf.Args = args
+	cf.isStar = isCountStar(args)
+}
+
+// countRowOnly returns true if the row is counted without evaluating the args.
+func (cf *countFunction) countRowOnly() bool {
+	return cf.isStar && !cf.Distinct && cf.mode == CompleteMode
 }
 
 // Clone implements Aggregation interface.
@@ -67,6 +92,10 @@ func (cf *countFunction) GetType() *types.FieldType {
 // Update implements Aggregation interface.
 func (cf *countFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
 	ctx := cf.getContext(groupKey)
+	if cf.countRowOnly() {
+		ctx.Count++
+		return nil
+	}
 	if cf.Distinct {
 		cf.datumBuf = cf.datumBuf[:0]
 	}
@@ -103,6 +132,10 @@ func (cf *countFunction) Update(row []types.Datum, groupKey []byte, sc *variable
 // StreamUpdate implements Aggregation interface.
 func (cf *countFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
 	ctx := cf.getStreamedContext()
+	if cf.countRowOnly() {
+		ctx.Count++
+		return nil
+	}
 	if cf.Distinct {
 		cf.datumBuf = cf.datumBuf[:0]
 	}
@@ -0,0 +1,138 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// countIfFunction counts the rows on which the condition is true, NULL is
+// treated as false.
+type countIfFunction struct {
+	aggFunction
+}
+
+// Clone implements Aggregation interface.
+func (cf *countIfFunction) Clone() Aggregation {
+	nf := *cf
+	for i, arg := range cf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// CalculateDefaultValue implements Aggregation interface.
+func (cf *countIfFunction) CalculateDefaultValue(schema *expression.Schema, ctx context.Context) (d types.Datum, valid bool) {
+	result, err := expression.EvaluateExprWithNull(ctx, schema, cf.Args[0])
+	if err != nil {
+		log.Warnf("Evaluate expr with null failed in function %s, err msg is %s", cf, err.Error())
+		return d, false
+	}
+	con, ok := result.(*expression.Constant)
+	if !ok {
+		return d, false
+	}
+	isTrue, err := isTrueCondition(ctx.GetSessionVars().StmtCtx, con.Value)
+	if err != nil {
+		log.Warnf("Evaluate condition failed in function %s, err msg is %s", cf, err.Error())
+		return d, false
+	}
+	if isTrue {
+		return types.NewDatum(1), true
+	}
+	return types.NewDatum(0), true
+}
+
+// GetType implements Aggregation interface.
+func (cf *countIfFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeLonglong)
+	ft.Flen = 21
+	types.SetBinChsClnFlag(ft)
+	return ft
+}
+
+// isTrueCondition returns whether the condition value is true, NULL is false.
+func isTrueCondition(sc *variable.StatementContext, value types.Datum) (bool, error) {
+	if value.IsNull() {
+		return false, nil
+	}
+	b, err := value.ToBool(sc)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return b != 0, nil
+}
+
+func (cf *countIfFunction) updateCount(ctx *aggEvaluateContext, sc *variable.StatementContext, row []types.Datum) error {
+	if len(cf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncCountIf")
+	}
+	value, err := cf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cf.mode == FinalMode {
+		// The value is the count of a partial result.
+		if !value.IsNull() {
+			ctx.Count += value.GetInt64()
+		}
+		return nil
+	}
+	isTrue, err := isTrueCondition(sc, value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if isTrue {
+		ctx.Count++
+	}
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (cf *countIfFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return cf.updateCount(cf.getContext(groupKey), sc, row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (cf *countIfFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return cf.updateCount(cf.getStreamedContext(), sc, row)
+}
+
+// GetGroupResult implements Aggregation interface.
+func (cf *countIfFunction) GetGroupResult(groupKey []byte) (d types.Datum) {
+	d.SetInt64(cf.getContext(groupKey).Count)
+	return d
+}
+
+// GetPartialResult implements Aggregation interface.
+func (cf *countIfFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{cf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (cf *countIfFunction) GetStreamResult() (d types.Datum) {
+	if cf.streamCtx == nil {
+		return types.NewDatum(0)
+	}
+	d.SetInt64(cf.streamCtx.Count)
+	cf.streamCtx = nil
+	return
+}
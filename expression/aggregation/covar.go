@@ -0,0 +1,90 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// covarFunction calculates the population covariance of x and y, or the sample
+// covariance if sample is set. It shares the co-moments with corr.
+type covarFunction struct {
+	aggFunction
+	sample bool
+}
+
+// Clone implements Aggregation interface.
+func (cf *covarFunction) Clone() Aggregation {
+	nf := *cf
+	for i, arg := range cf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (cf *covarFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeDouble)
+	types.SetBinChsClnFlag(ft)
+	ft.Flen, ft.Decimal = mysql.MaxRealWidth, types.UnspecifiedLength
+	return ft
+}
+
+// Update implements Aggregation interface.
+func (cf *covarFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return cf.updateCoMoments(cf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (cf *covarFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return cf.updateCoMoments(cf.getStreamedContext(), row, sc)
+}
+
+// calculateResult divides the co-moment by n, or n-1 for the sample covariance.
+// It returns NULL if the group is empty, or has only one pair for the sample
+// covariance.
+func (cf *covarFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	n := ctx.Count
+	if cf.sample {
+		n--
+	}
+	if n <= 0 || ctx.Moments == nil {
+		return
+	}
+	d.SetFloat64(ctx.Moments.cXY / float64(n))
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (cf *covarFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return cf.calculateResult(cf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (cf *covarFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{cf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (cf *covarFunction) GetStreamResult() (d types.Datum) {
+	if cf.streamCtx == nil {
+		return
+	}
+	d = cf.calculateResult(cf.streamCtx)
+	cf.streamCtx = nil
+	return
+}
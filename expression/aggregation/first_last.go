@@ -0,0 +1,101 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// firstLastFunction takes a value argument and an order argument, it returns the
+// value of the row whose order argument comes first, in ascending order by default
+// or in descending order if desc is set.
+type firstLastFunction struct {
+	aggFunction
+	desc bool
+}
+
+// Clone implements Aggregation interface.
+func (flf *firstLastFunction) Clone() Aggregation {
+	nf := *flf
+	for i, arg := range flf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (flf *firstLastFunction) GetType() *types.FieldType {
+	return flf.Args[0].GetType()
+}
+
+func (flf *firstLastFunction) updateValue(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(flf.Args) != 2 {
+		return errors.Errorf("Wrong number of args for AggFunc%s", flf.name)
+	}
+	order, err := flf.Args[1].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if ctx.GotFirstRow {
+		c, err := ctx.OrderValue.CompareDatum(sc, order)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if (!flf.desc && c <= 0) || (flf.desc && c >= 0) {
+			return nil
+		}
+	}
+	value, err := flf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ctx.Value, ctx.OrderValue = value, order
+	ctx.GotFirstRow = true
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (flf *firstLastFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return flf.updateValue(flf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (flf *firstLastFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return flf.updateValue(flf.getStreamedContext(), row, sc)
+}
+
+// GetGroupResult implements Aggregation interface.
+func (flf *firstLastFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return flf.getContext(groupKey).Value
+}
+
+// GetPartialResult implements Aggregation interface.
+// The order value is kept so that the partial results can be merged again.
+func (flf *firstLastFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	ctx := flf.getContext(groupKey)
+	return []types.Datum{ctx.Value, ctx.OrderValue}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (flf *firstLastFunction) GetStreamResult() (d types.Datum) {
+	if flf.streamCtx == nil {
+		return
+	}
+	d = flf.streamCtx.Value
+	flf.streamCtx = nil
+	return
+}
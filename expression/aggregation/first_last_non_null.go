@@ -0,0 +1,94 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// firstLastNonNullFunction returns the first non-NULL value of a group in the
+// order the rows are updated, or the last one if isLast is set. Unlike
+// first_value and last_value, it has no order argument. It returns NULL if
+// the group has only NULLs.
+type firstLastNonNullFunction struct {
+	aggFunction
+	isLast bool
+}
+
+// Clone implements Aggregation interface.
+func (ff *firstLastNonNullFunction) Clone() Aggregation {
+	nf := *ff
+	for i, arg := range ff.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (ff *firstLastNonNullFunction) GetType() *types.FieldType {
+	return ff.Args[0].GetType()
+}
+
+func (ff *firstLastNonNullFunction) updateValue(ctx *aggEvaluateContext, row []types.Datum) error {
+	// The first one never changes once it's latched.
+	if !ff.isLast && ctx.GotFirstRow {
+		return nil
+	}
+	if len(ff.Args) != 1 {
+		return errors.Errorf("Wrong number of args for AggFunc%s", ff.name)
+	}
+	value, err := ff.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	ctx.Value = value
+	ctx.GotFirstRow = true
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (ff *firstLastNonNullFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return ff.updateValue(ff.getContext(groupKey), row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (ff *firstLastNonNullFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return ff.updateValue(ff.getStreamedContext(), row)
+}
+
+// GetGroupResult implements Aggregation interface.
+func (ff *firstLastNonNullFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return ff.getContext(groupKey).Value
+}
+
+// GetPartialResult implements Aggregation interface.
+func (ff *firstLastNonNullFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{ff.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (ff *firstLastNonNullFunction) GetStreamResult() (d types.Datum) {
+	if ff.streamCtx == nil {
+		return
+	}
+	d = ff.streamCtx.Value
+	ff.streamCtx = nil
+	return
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+	"github.com/pingcap/tidb/util/types/json"
+)
+
+// histogramFunction takes the arguments (value, bucketWidth, minBound), it counts
+// the values falling into each bucket [minBound + i * bucketWidth, minBound + (i+1) * bucketWidth)
+// and returns the counts as a JSON object {i: count}. Values below minBound are
+// counted in bucket 0.
+type histogramFunction struct {
+	aggFunction
+}
+
+// Clone implements Aggregation interface.
+func (hf *histogramFunction) Clone() Aggregation {
+	nf := *hf
+	for i, arg := range hf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (hf *histogramFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeJSON)
+	types.SetBinChsClnFlag(ft)
+	return ft
+}
+
+// evalFloat64 evaluates the idx-th argument as float64, isNull is true if it's NULL.
+func (hf *histogramFunction) evalFloat64(idx int, row []types.Datum, sc *variable.StatementContext) (f float64, isNull bool, err error) {
+	d, err := hf.Args[idx].Eval(row)
+	if err != nil {
+		return 0, false, errors.Trace(err)
+	}
+	if d.IsNull() {
+		return 0, true, nil
+	}
+	f, err = d.ToFloat64(sc)
+	return f, false, errors.Trace(err)
+}
+
+func (hf *histogramFunction) updateBuckets(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(hf.Args) != 3 {
+		return errors.New("Wrong number of args for AggFuncHistogram")
+	}
+	width, isNull, err := hf.evalFloat64(1, row, sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if isNull || width <= 0 {
+		return errors.New("The bucket width of AggFuncHistogram should be positive")
+	}
+	minBound, isNull, err := hf.evalFloat64(2, row, sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if isNull {
+		return errors.New("The min bound of AggFuncHistogram should not be NULL")
+	}
+	x, isNull, err := hf.evalFloat64(0, row, sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if isNull {
+		return nil
+	}
+	idx := int64(0)
+	if x > minBound {
+		idx = int64(math.Floor((x - minBound) / width))
+	}
+	if ctx.Buckets == nil {
+		ctx.Buckets = make(map[int64]int64)
+	}
+	ctx.Buckets[idx]++
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (hf *histogramFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return hf.updateBuckets(hf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (hf *histogramFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return hf.updateBuckets(hf.getStreamedContext(), row, sc)
+}
+
+func (hf *histogramFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if len(ctx.Buckets) == 0 {
+		return
+	}
+	obj := make(map[string]interface{}, len(ctx.Buckets))
+	for idx, count := range ctx.Buckets {
+		obj[strconv.FormatInt(idx, 10)] = count
+	}
+	d.SetMysqlJSON(json.CreateJSON(obj))
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (hf *histogramFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return hf.calculateResult(hf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (hf *histogramFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{hf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (hf *histogramFunction) GetStreamResult() (d types.Datum) {
+	if hf.streamCtx == nil {
+		return
+	}
+	d = hf.calculateResult(hf.streamCtx)
+	hf.streamCtx = nil
+	return
+}
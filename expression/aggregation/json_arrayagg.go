@@ -0,0 +1,122 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+	"github.com/pingcap/tidb/util/types/json"
+)
+
+// jsonArrayAggFunction collects the values of a group into a JSON array, in
+// the order they arrive. NULL values are kept as JSON null.
+type jsonArrayAggFunction struct {
+	aggFunction
+}
+
+// Clone implements Aggregation interface.
+func (jf *jsonArrayAggFunction) Clone() Aggregation {
+	nf := *jf
+	for i, arg := range jf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (jf *jsonArrayAggFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeJSON)
+	types.SetBinChsClnFlag(ft)
+	return ft
+}
+
+func (jf *jsonArrayAggFunction) updateValues(ctx *aggEvaluateContext, row []types.Datum) error {
+	if len(jf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncJSONArrayAgg")
+	}
+	value, err := jf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ctx.Values = append(ctx.Values, value)
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (jf *jsonArrayAggFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return jf.updateValues(jf.getContext(groupKey), row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (jf *jsonArrayAggFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return jf.updateValues(jf.getStreamedContext(), row)
+}
+
+func (jf *jsonArrayAggFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if len(ctx.Values) == 0 {
+		return
+	}
+	sc := new(variable.StatementContext)
+	elems := make([]json.JSON, 0, len(ctx.Values))
+	for _, value := range ctx.Values {
+		j, err := datumToJSON(sc, value)
+		if err != nil {
+			log.Warnf("Calculate json_arrayagg failed in function %s, err msg is %s", jf, err.Error())
+			return types.Datum{}
+		}
+		elems = append(elems, j)
+	}
+	d.SetMysqlJSON(json.CreateJSON(elems))
+	return
+}
+
+// datumToJSON converts a datum to a JSON element. Unlike casting to JSON,
+// strings are taken as JSON strings instead of being parsed.
+func datumToJSON(sc *variable.StatementContext, d types.Datum) (json.JSON, error) {
+	switch d.Kind() {
+	case types.KindNull:
+		return json.CreateJSON(nil), nil
+	case types.KindString, types.KindBytes:
+		return json.CreateJSON(d.GetString()), nil
+	}
+	converted, err := d.ConvertTo(sc, types.NewFieldType(mysql.TypeJSON))
+	if err != nil {
+		return json.JSON{}, errors.Trace(err)
+	}
+	return converted.GetMysqlJSON(), nil
+}
+
+// GetGroupResult implements Aggregation interface.
+func (jf *jsonArrayAggFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return jf.calculateResult(jf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (jf *jsonArrayAggFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{jf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (jf *jsonArrayAggFunction) GetStreamResult() (d types.Datum) {
+	if jf.streamCtx == nil {
+		return
+	}
+	d = jf.calculateResult(jf.streamCtx)
+	jf.streamCtx = nil
+	return
+}
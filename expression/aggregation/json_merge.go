@@ -0,0 +1,136 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+	"github.com/pingcap/tidb/util/types/json"
+)
+
+// jsonMergeAggFunction merges the JSON documents of a group like JSON_MERGE_PRESERVE,
+// the values of the duplicated keys are merged into arrays instead of being
+// overwritten. NULL documents are skipped.
+type jsonMergeAggFunction struct {
+	aggFunction
+}
+
+// copyJSON deep copies j, since Merge modifies the arrays and objects in place.
+func copyJSON(j json.JSON) json.JSON {
+	nj, err := json.Deserialize(json.Serialize(j))
+	if err != nil {
+		// It never happens since the bytes are serialized from a valid JSON.
+		panic(err)
+	}
+	return nj
+}
+
+func cloneJSONMergeAggContext(ctx *aggEvaluateContext) *aggEvaluateContext {
+	nctx := *ctx
+	if !ctx.Value.IsNull() {
+		nctx.Value.SetMysqlJSON(copyJSON(ctx.Value.GetMysqlJSON()))
+	}
+	return &nctx
+}
+
+// Clone implements Aggregation interface.
+// The documents merged so far are copied, so the clone doesn't share them with jf.
+func (jf *jsonMergeAggFunction) Clone() Aggregation {
+	nf := *jf
+	for i, arg := range jf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper, len(jf.resultMapper))
+	for key, ctx := range jf.resultMapper {
+		nf.resultMapper[key] = cloneJSONMergeAggContext(ctx)
+	}
+	if jf.streamCtx != nil {
+		nf.streamCtx = cloneJSONMergeAggContext(jf.streamCtx)
+	}
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (jf *jsonMergeAggFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeJSON)
+	types.SetBinChsClnFlag(ft)
+	return ft
+}
+
+func (jf *jsonMergeAggFunction) updateDoc(ctx *aggEvaluateContext, sc *variable.StatementContext, row []types.Datum) error {
+	if len(jf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncJSONMergeAgg")
+	}
+	value, err := jf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	// The strings are parsed as JSON documents.
+	value, err = value.ConvertTo(sc, types.NewFieldType(mysql.TypeJSON))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// The document is copied, or merging the later ones into it modifies the row.
+	doc := copyJSON(value.GetMysqlJSON())
+	if ctx.Value.IsNull() {
+		ctx.Value.SetMysqlJSON(doc)
+		return nil
+	}
+	ctx.Value.SetMysqlJSON(ctx.Value.GetMysqlJSON().Merge([]json.JSON{doc}))
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (jf *jsonMergeAggFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return jf.updateDoc(jf.getContext(groupKey), sc, row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (jf *jsonMergeAggFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return jf.updateDoc(jf.getStreamedContext(), sc, row)
+}
+
+func (jf *jsonMergeAggFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if ctx.Value.IsNull() {
+		return
+	}
+	// The result is copied, so it isn't modified by the later updates.
+	d.SetMysqlJSON(copyJSON(ctx.Value.GetMysqlJSON()))
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (jf *jsonMergeAggFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return jf.calculateResult(jf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (jf *jsonMergeAggFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{jf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (jf *jsonMergeAggFunction) GetStreamResult() (d types.Datum) {
+	if jf.streamCtx == nil {
+		return
+	}
+	d = jf.calculateResult(jf.streamCtx)
+	jf.streamCtx = nil
+	return
+}
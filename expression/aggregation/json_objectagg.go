@@ -0,0 +1,122 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+	"github.com/pingcap/tidb/util/types/json"
+)
+
+// errJSONObjectAggNullKey is returned when the key of json_objectagg is NULL.
+var errJSONObjectAggNullKey = errors.New("JSON documents may not contain NULL member names")
+
+// jsonObjectAggFunction collects the key/value pairs of a group into a JSON
+// object, the later value of a duplicated key overwrites the earlier one.
+type jsonObjectAggFunction struct {
+	aggFunction
+}
+
+// Clone implements Aggregation interface.
+func (jf *jsonObjectAggFunction) Clone() Aggregation {
+	nf := *jf
+	for i, arg := range jf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (jf *jsonObjectAggFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeJSON)
+	types.SetBinChsClnFlag(ft)
+	return ft
+}
+
+func (jf *jsonObjectAggFunction) updateMembers(ctx *aggEvaluateContext, sc *variable.StatementContext, row []types.Datum) error {
+	if len(jf.Args) != 2 {
+		return errors.New("Wrong number of args for AggFuncJSONObjectAgg")
+	}
+	key, err := jf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if key.IsNull() {
+		return errors.Trace(errJSONObjectAggNullKey)
+	}
+	keyStr, err := key.ToString()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	value, err := jf.Args[1].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	j, err := datumToJSON(sc, value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if ctx.Members == nil {
+		ctx.Members = make(map[string]types.Datum)
+	}
+	var d types.Datum
+	d.SetMysqlJSON(j)
+	ctx.Members[keyStr] = d
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (jf *jsonObjectAggFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return jf.updateMembers(jf.getContext(groupKey), sc, row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (jf *jsonObjectAggFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return jf.updateMembers(jf.getStreamedContext(), sc, row)
+}
+
+func (jf *jsonObjectAggFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if len(ctx.Members) == 0 {
+		return
+	}
+	object := make(map[string]json.JSON, len(ctx.Members))
+	for key, value := range ctx.Members {
+		object[key] = value.GetMysqlJSON()
+	}
+	d.SetMysqlJSON(json.CreateJSON(object))
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (jf *jsonObjectAggFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return jf.calculateResult(jf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (jf *jsonObjectAggFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{jf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (jf *jsonObjectAggFunction) GetStreamResult() (d types.Datum) {
+	if jf.streamCtx == nil {
+		return
+	}
+	d = jf.calculateResult(jf.streamCtx)
+	jf.streamCtx = nil
+	return
+}
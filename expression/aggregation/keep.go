@@ -0,0 +1,134 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// keepFunction takes an order argument followed by one or more payload arguments,
+// it keeps the payload values of the row with the maximum order value if isMax is
+// set, or the minimum one otherwise, like MAX(...) KEEP. Rows with NULL order
+// values are skipped, and the first row seen wins if order values tie.
+// If orderLast is set, the order argument is the last one instead, like
+// ARG_MAX(value, order) and ARG_MIN(value, order).
+type keepFunction struct {
+	aggFunction
+	isMax     bool
+	orderLast bool
+}
+
+// splitArgs returns the order argument and the payload arguments.
+func (kf *keepFunction) splitArgs() (expression.Expression, []expression.Expression) {
+	if kf.orderLast {
+		return kf.Args[len(kf.Args)-1], kf.Args[:len(kf.Args)-1]
+	}
+	return kf.Args[0], kf.Args[1:]
+}
+
+// Clone implements Aggregation interface.
+func (kf *keepFunction) Clone() Aggregation {
+	nf := *kf
+	for i, arg := range kf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+// It's the type of the first payload argument, which is the group result.
+func (kf *keepFunction) GetType() *types.FieldType {
+	_, payload := kf.splitArgs()
+	return payload[0].GetType()
+}
+
+func (kf *keepFunction) updateValues(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(kf.Args) < 2 {
+		return errors.Errorf("Wrong number of args for AggFunc%s", kf.name)
+	}
+	orderArg, payload := kf.splitArgs()
+	order, err := orderArg.Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if order.IsNull() {
+		return nil
+	}
+	if ctx.GotFirstRow {
+		c, err := ctx.OrderValue.CompareDatum(sc, order)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if (kf.isMax && c >= 0) || (!kf.isMax && c <= 0) {
+			return nil
+		}
+	}
+	values := make([]types.Datum, 0, len(kf.Args)-1)
+	for _, arg := range payload {
+		value, err := arg.Eval(row)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		values = append(values, value)
+	}
+	ctx.Values, ctx.OrderValue = values, order
+	ctx.GotFirstRow = true
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (kf *keepFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return kf.updateValues(kf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (kf *keepFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return kf.updateValues(kf.getStreamedContext(), row, sc)
+}
+
+// GetGroupResult implements Aggregation interface.
+// It returns the first payload value, GetPartialResult returns all of them.
+func (kf *keepFunction) GetGroupResult(groupKey []byte) (d types.Datum) {
+	ctx := kf.getContext(groupKey)
+	if !ctx.GotFirstRow {
+		return
+	}
+	return ctx.Values[0]
+}
+
+// GetPartialResult implements Aggregation interface.
+// It returns the payload values of the kept row, they're all NULL if no row is kept.
+func (kf *keepFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	ctx := kf.getContext(groupKey)
+	if !ctx.GotFirstRow {
+		return make([]types.Datum, len(kf.Args)-1)
+	}
+	return ctx.Values
+}
+
+// GetStreamResult implements Aggregation interface.
+func (kf *keepFunction) GetStreamResult() (d types.Datum) {
+	if kf.streamCtx == nil {
+		return
+	}
+	if kf.streamCtx.GotFirstRow {
+		d = kf.streamCtx.Values[0]
+	}
+	kf.streamCtx = nil
+	return
+}
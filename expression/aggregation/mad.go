@@ -0,0 +1,153 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// madFunction calculates the median absolute deviation, the median of the
+// absolute deviations of the values from their median.
+type madFunction struct {
+	aggFunction
+}
+
+// Clone implements Aggregation interface.
+func (mf *madFunction) Clone() Aggregation {
+	nf := *mf
+	for i, arg := range mf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (mf *madFunction) GetType() *types.FieldType {
+	argTp := mf.Args[0].GetType()
+	switch argTp.ToClass() {
+	case types.ClassInt, types.ClassDecimal:
+		ft := types.NewFieldType(mysql.TypeNewDecimal)
+		types.SetBinChsClnFlag(ft)
+		ft.Flen, ft.Decimal = mysql.MaxDecimalWidth, argTp.Decimal
+		return ft
+	}
+	ft := types.NewFieldType(mysql.TypeDouble)
+	types.SetBinChsClnFlag(ft)
+	ft.Flen, ft.Decimal = mysql.MaxRealWidth, types.UnspecifiedLength
+	return ft
+}
+
+// updateValues buffers the value as decimal for the integer and decimal args,
+// and as float64 for the others, so the deviations have the same kind.
+func (mf *madFunction) updateValues(ctx *aggEvaluateContext, sc *variable.StatementContext, row []types.Datum) error {
+	if len(mf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncMAD")
+	}
+	value, err := mf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	var d types.Datum
+	switch mf.Args[0].GetType().ToClass() {
+	case types.ClassInt, types.ClassDecimal:
+		dec, err := value.ToDecimal(sc)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		d.SetMysqlDecimal(dec)
+	default:
+		f, err := value.ToFloat64(sc)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		d.SetFloat64(f)
+	}
+	ctx.Values = append(ctx.Values, d)
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (mf *madFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return mf.updateValues(mf.getContext(groupKey), sc, row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (mf *madFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return mf.updateValues(mf.getStreamedContext(), sc, row)
+}
+
+func (mf *madFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	d, err := calculateMAD(new(variable.StatementContext), ctx.Values)
+	if err != nil {
+		log.Warnf("Calculate mad failed in function %s, err msg is %s", mf, err.Error())
+		return types.Datum{}
+	}
+	return d
+}
+
+// calculateMAD calculates the median of values first, then the median of the
+// absolute deviations from it. It returns NULL if values is empty.
+func calculateMAD(sc *variable.StatementContext, values []types.Datum) (d types.Datum, err error) {
+	median, err := calculateMedian(sc, values)
+	if err != nil || median.IsNull() {
+		return d, errors.Trace(err)
+	}
+	deviations := make([]types.Datum, 0, len(values))
+	for _, v := range values {
+		cmp, err := v.CompareDatum(sc, median)
+		if err != nil {
+			return d, errors.Trace(err)
+		}
+		var dev types.Datum
+		if cmp >= 0 {
+			dev, err = types.ComputeMinus(v, median)
+		} else {
+			dev, err = types.ComputeMinus(median, v)
+		}
+		if err != nil {
+			return d, errors.Trace(err)
+		}
+		deviations = append(deviations, dev)
+	}
+	d, err = calculateMedian(sc, deviations)
+	return d, errors.Trace(err)
+}
+
+// GetGroupResult implements Aggregation interface.
+func (mf *madFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return mf.calculateResult(mf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (mf *madFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{mf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (mf *madFunction) GetStreamResult() (d types.Datum) {
+	if mf.streamCtx == nil {
+		return
+	}
+	d = mf.calculateResult(mf.streamCtx)
+	mf.streamCtx = nil
+	return
+}
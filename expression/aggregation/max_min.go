@@ -18,6 +18,7 @@ import (
 	"github.com/juju/errors"
 	"github.com/pingcap/tidb/context"
 	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/mysql"
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/util/types"
 )
@@ -52,8 +53,55 @@ func (mmf *maxMinFunction) CalculateDefaultValue(schema *expression.Schema, ctx
 }
 
 // GetType implements Aggregation interface.
+// It's the type aggregated over the args, so it doesn't depend on which row wins.
 func (mmf *maxMinFunction) GetType() *types.FieldType {
-	return mmf.Args[0].GetType()
+	tps := make([]*types.FieldType, 0, len(mmf.Args))
+	for _, arg := range mmf.Args {
+		tps = append(tps, arg.GetType())
+	}
+	return types.AggFieldType(tps)
+}
+
+// coerceResult converts the winning value to the kind and fsp of GetType, so
+// the result matches the declared type, e.g. an int64 row of a decimal type.
+func (mmf *maxMinFunction) coerceResult(sc *variable.StatementContext, d types.Datum) (types.Datum, error) {
+	if d.IsNull() {
+		return d, nil
+	}
+	// GetType is the type of the only arg, it's used directly to save the allocation.
+	ft := mmf.Args[0].GetType()
+	switch d.Kind() {
+	case types.KindMysqlTime:
+		if t := d.GetMysqlTime(); t.Type != mysql.TypeDate && ft.Decimal > t.Fsp && ft.Decimal <= types.MaxFsp {
+			t.Fsp = ft.Decimal
+			d.SetMysqlTime(t)
+		}
+		return d, nil
+	case types.KindMysqlDuration:
+		if dur := d.GetMysqlDuration(); ft.Decimal > dur.Fsp && ft.Decimal <= types.MaxFsp {
+			dur.Fsp = ft.Decimal
+			d.SetMysqlDuration(dur)
+		}
+		return d, nil
+	}
+	switch ft.ToClass() {
+	case types.ClassInt:
+		if d.Kind() == types.KindInt64 || d.Kind() == types.KindUint64 {
+			return d, nil
+		}
+	case types.ClassDecimal:
+		if d.Kind() == types.KindMysqlDecimal {
+			return d, nil
+		}
+	case types.ClassReal:
+		if d.Kind() == types.KindFloat32 || d.Kind() == types.KindFloat64 {
+			return d, nil
+		}
+	default:
+		return d, nil
+	}
+	converted, err := d.ConvertTo(sc, ft)
+	return converted, errors.Trace(err)
 }
 
 // GetGroupResult implements Aggregation interface.
@@ -61,6 +109,13 @@ func (mmf *maxMinFunction) GetGroupResult(groupKey []byte) (d types.Datum) {
 	return mmf.getContext(groupKey).Value
 }
 
+// ResetContext implements Aggregation interface.
+func (mmf *maxMinFunction) ResetContext(groupKey []byte) {
+	if ctx, ok := mmf.resultMapper[string(groupKey)]; ok {
+		ctx.Value.SetNull()
+	}
+}
+
 // GetPartialResult implements Aggregation interface.
 func (mmf *maxMinFunction) GetPartialResult(groupKey []byte) []types.Datum {
 	return []types.Datum{mmf.GetGroupResult(groupKey)}
@@ -76,9 +131,7 @@ func (mmf *maxMinFunction) GetStreamResult() (d types.Datum) {
 	return
 }
 
-// Update implements Aggregation interface.
-func (mmf *maxMinFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
-	ctx := mmf.getContext(groupKey)
+func (mmf *maxMinFunction) updateMaxMin(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
 	if len(mmf.Args) != 1 {
 		return errors.New("Wrong number of args for AggFuncMaxMin")
 	}
@@ -87,47 +140,46 @@ func (mmf *maxMinFunction) Update(row []types.Datum, groupKey []byte, sc *variab
 	if err != nil {
 		return errors.Trace(err)
 	}
-	if ctx.Value.IsNull() {
-		ctx.Value = value
-	}
 	if value.IsNull() {
 		return nil
 	}
-	var c int
-	c, err = ctx.Value.CompareDatum(sc, value)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	if (mmf.isMax && c == -1) || (!mmf.isMax && c == 1) {
-		ctx.Value = value
-	}
-	return nil
+	if !ctx.Value.IsNull() {
+		var c int
+		c, err = compareMaxMin(sc, &ctx.Value, value, a.GetType().Collate)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if (mmf.isMax && c != -1) || (!mmf.isMax && c != 1) {
+			return nil
+		}
+	}
+	ctx.Value, err = mmf.coerceResult(sc, value)
+	return errors.Trace(err)
+}
+
+// Update implements Aggregation interface.
+func (mmf *maxMinFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return mmf.updateMaxMin(mmf.getContext(groupKey), row, sc)
 }
 
 // StreamUpdate implements Aggregation interface.
 func (mmf *maxMinFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
-	ctx := mmf.getStreamedContext()
-	if len(mmf.Args) != 1 {
-		return errors.New("Wrong number of args for AggFuncMaxMin")
-	}
-	a := mmf.Args[0]
-	value, err := a.Eval(row)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	if ctx.Value.IsNull() {
-		ctx.Value = value
-	}
-	if value.IsNull() {
-		return nil
-	}
-	var c int
-	c, err = ctx.Value.CompareDatum(sc, value)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	if (mmf.isMax && c == -1) || (!mmf.isMax && c == 1) {
-		ctx.Value = value
-	}
-	return nil
+	return mmf.updateMaxMin(mmf.getStreamedContext(), row, sc)
+}
+
+// compareMaxMin compares x to y. It compares the fixed-width numeric datums of
+// the same kind directly, which is the common case of max/min, and falls back
+// to CompareDatumWithCollation for the others.
+func compareMaxMin(sc *variable.StatementContext, x *types.Datum, y types.Datum, collation string) (int, error) {
+	if x.Kind() == y.Kind() {
+		switch x.Kind() {
+		case types.KindInt64:
+			return types.CompareInt64(x.GetInt64(), y.GetInt64()), nil
+		case types.KindUint64:
+			return types.CompareUint64(x.GetUint64(), y.GetUint64()), nil
+		case types.KindFloat32, types.KindFloat64:
+			return types.CompareFloat64(x.GetFloat64(), y.GetFloat64()), nil
+		}
+	}
+	return x.CompareDatumWithCollation(sc, y, collation)
 }
@@ -0,0 +1,155 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// slidingMaxMinFunction is the max/min created by NewSlidingAggFunction. It
+// keeps a monotonic deque of the rows of each group, so rows can be removed in
+// O(1) amortized time.
+type slidingMaxMinFunction struct {
+	maxMinFunction
+}
+
+// Clone implements Aggregation interface.
+func (smf *slidingMaxMinFunction) Clone() Aggregation {
+	nf := *smf
+	for i, arg := range smf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// ResetContext implements Aggregation interface.
+func (smf *slidingMaxMinFunction) ResetContext(groupKey []byte) {
+	if ctx, ok := smf.resultMapper[string(groupKey)]; ok {
+		ctx.Value.SetNull()
+		ctx.Window = nil
+	}
+}
+
+func (smf *slidingMaxMinFunction) push(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(smf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncMaxMin")
+	}
+	a := smf.Args[0]
+	value, err := a.Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// Any pushed value may become the front, so it's coerced beforehand.
+	value, err = smf.coerceResult(sc, value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if ctx.Window == nil {
+		ctx.Window = &maxMinWindow{}
+	}
+	err = ctx.Window.push(sc, value, smf.isMax, a.GetType().Collate)
+	ctx.Value = ctx.Window.front()
+	return errors.Trace(err)
+}
+
+// Update implements Aggregation interface.
+func (smf *slidingMaxMinFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return smf.push(smf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (smf *slidingMaxMinFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return smf.push(smf.getStreamedContext(), row, sc)
+}
+
+// Remove implements SlidingAggregation interface.
+func (smf *slidingMaxMinFunction) Remove(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	if len(smf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncMaxMin")
+	}
+	ctx := smf.getContext(groupKey)
+	if ctx.Window == nil {
+		ctx.Window = &maxMinWindow{}
+	}
+	err := ctx.Window.pop()
+	ctx.Value = ctx.Window.front()
+	return errors.Trace(err)
+}
+
+// maxMinWindow is the monotonic deque of the sliding max and min. The values of
+// the deque are in descending order for max and ascending order for min, so the
+// front is the result, every row is pushed and popped at most once.
+type maxMinWindow struct {
+	values []types.Datum
+	// seqs are the sequence numbers of the rows of values.
+	seqs []int64
+	// head is the index of the front in values and seqs.
+	head int
+	// added and removed are the numbers of the rows updated and removed,
+	// including the NULL ones.
+	added   int64
+	removed int64
+}
+
+func (w *maxMinWindow) front() types.Datum {
+	if w.head == len(w.values) {
+		return types.Datum{}
+	}
+	return w.values[w.head]
+}
+
+// push pushes value after popping the values not better than it from the back.
+func (w *maxMinWindow) push(sc *variable.StatementContext, value types.Datum, isMax bool, collation string) error {
+	seq := w.added
+	w.added++
+	if value.IsNull() {
+		return nil
+	}
+	for len(w.values) > w.head {
+		back := w.values[len(w.values)-1]
+		c, err := compareMaxMin(sc, &back, value, collation)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if (isMax && c > 0) || (!isMax && c < 0) {
+			break
+		}
+		w.values, w.seqs = w.values[:len(w.values)-1], w.seqs[:len(w.seqs)-1]
+	}
+	w.values = append(w.values, value)
+	w.seqs = append(w.seqs, seq)
+	return nil
+}
+
+// pop removes the oldest row, the front is popped if it's the row.
+func (w *maxMinWindow) pop() error {
+	if w.removed == w.added {
+		return errors.New("remove more rows than updated for sliding max/min")
+	}
+	w.removed++
+	if w.head < len(w.values) && w.seqs[w.head] < w.removed {
+		w.values[w.head] = types.Datum{}
+		w.head++
+	}
+	// Compact the deque once the popped part dominates it.
+	if w.head > 0 && w.head*2 >= len(w.values) {
+		n := copy(w.values, w.values[w.head:])
+		copy(w.seqs, w.seqs[w.head:])
+		w.values, w.seqs, w.head = w.values[:n], w.seqs[:n], 0
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+type medianFunction struct {
+	aggFunction
+}
+
+// Clone implements Aggregation interface.
+func (mf *medianFunction) Clone() Aggregation {
+	nf := *mf
+	for i, arg := range mf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (mf *medianFunction) GetType() *types.FieldType {
+	argTp := mf.Args[0].GetType()
+	switch argTp.ToClass() {
+	case types.ClassInt, types.ClassDecimal:
+		// The median of an even number of values is the average of the middle two.
+		ft := types.NewFieldType(mysql.TypeNewDecimal)
+		types.SetBinChsClnFlag(ft)
+		ft.Flen, ft.Decimal = mysql.MaxDecimalWidth, argTp.Decimal
+		return ft
+	case types.ClassReal:
+		ft := types.NewFieldType(mysql.TypeDouble)
+		types.SetBinChsClnFlag(ft)
+		ft.Flen, ft.Decimal = mysql.MaxRealWidth, argTp.Decimal
+		return ft
+	}
+	return argTp
+}
+
+func (mf *medianFunction) updateValues(ctx *aggEvaluateContext, row []types.Datum) error {
+	if len(mf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncMedian")
+	}
+	value, err := mf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	ctx.Values = append(ctx.Values, value)
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (mf *medianFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return mf.updateValues(mf.getContext(groupKey), row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (mf *medianFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return mf.updateValues(mf.getStreamedContext(), row)
+}
+
+func (mf *medianFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	d, err := calculateMedian(new(variable.StatementContext), ctx.Values)
+	if err != nil {
+		log.Warnf("Calculate median failed in function %s, err msg is %s", mf, err.Error())
+		return types.Datum{}
+	}
+	return d
+}
+
+// calculateMedian sorts values and returns the middle one. For an even number of
+// numeric values, the average of the middle two is returned, for other types the
+// lower one is returned. Integers are returned as decimal, and float32 as float64.
+// It returns NULL if values is empty.
+func calculateMedian(sc *variable.StatementContext, values []types.Datum) (d types.Datum, err error) {
+	if len(values) == 0 {
+		return
+	}
+	if err = types.SortDatums(sc, values); err != nil {
+		return d, errors.Trace(err)
+	}
+	mid := len(values) / 2
+	if len(values)%2 == 1 {
+		// The result has the kind of the type declared by GetType.
+		d = values[mid]
+		switch d.Kind() {
+		case types.KindInt64:
+			d.SetMysqlDecimal(types.NewDecFromInt(d.GetInt64()))
+		case types.KindUint64:
+			d.SetMysqlDecimal(types.NewDecFromUint(d.GetUint64()))
+		case types.KindFloat32:
+			d.SetFloat64(d.GetFloat64())
+		}
+		return d, nil
+	}
+	lo, hi := values[mid-1], values[mid]
+	switch lo.Kind() {
+	case types.KindInt64, types.KindUint64, types.KindMysqlDecimal:
+		sum, err := calculateSum(sc, types.Datum{}, lo)
+		if err != nil {
+			return d, errors.Trace(err)
+		}
+		sum, err = calculateSum(sc, sum, hi)
+		if err != nil {
+			return d, errors.Trace(err)
+		}
+		to := new(types.MyDecimal)
+		err = types.DecimalDiv(sum.GetMysqlDecimal(), types.NewDecFromInt(2), to, types.DivFracIncr)
+		if err != nil {
+			return d, errors.Trace(err)
+		}
+		to.Round(to, sum.Frac()+types.DivFracIncr, types.ModeHalfEven)
+		d.SetMysqlDecimal(to)
+	case types.KindFloat32, types.KindFloat64:
+		d.SetFloat64((lo.GetFloat64() + hi.GetFloat64()) / 2)
+	default:
+		d = lo
+	}
+	return d, nil
+}
+
+// GetGroupResult implements Aggregation interface.
+func (mf *medianFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return mf.calculateResult(mf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (mf *medianFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{mf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (mf *medianFunction) GetStreamResult() (d types.Datum) {
+	if mf.streamCtx == nil {
+		return
+	}
+	d = mf.calculateResult(mf.streamCtx)
+	mf.streamCtx = nil
+	return
+}
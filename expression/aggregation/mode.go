@@ -0,0 +1,170 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// datumFrequency is the count of a distinct value.
+type datumFrequency struct {
+	value types.Datum
+	count int64
+}
+
+// datumCounter counts the occurrences of the values, keyed on their encoded values.
+type datumCounter struct {
+	frequencies map[string]*datumFrequency
+	buf         []byte
+}
+
+func newDatumCounter() *datumCounter {
+	return &datumCounter{frequencies: make(map[string]*datumFrequency)}
+}
+
+// add increases the count of d by one.
+func (c *datumCounter) add(d types.Datum) error {
+	var err error
+	c.buf, err = codec.EncodeValue(c.buf[:0], d)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if freq, ok := c.frequencies[string(c.buf)]; ok {
+		freq.count++
+		return nil
+	}
+	c.frequencies[string(c.buf)] = &datumFrequency{value: types.CopyDatum(d), count: 1}
+	return nil
+}
+
+func (c *datumCounter) clone() *datumCounter {
+	nc := &datumCounter{frequencies: make(map[string]*datumFrequency, len(c.frequencies))}
+	for key, freq := range c.frequencies {
+		nc.frequencies[key] = &datumFrequency{value: types.CopyDatum(freq.value), count: freq.count}
+	}
+	return nc
+}
+
+// modeFunction returns the most frequent non-NULL value of a group, the smallest
+// one of them if more than one value are the most frequent.
+type modeFunction struct {
+	aggFunction
+}
+
+func cloneModeContext(ctx *aggEvaluateContext) *aggEvaluateContext {
+	nctx := *ctx
+	if ctx.Counter != nil {
+		nctx.Counter = ctx.Counter.clone()
+	}
+	return &nctx
+}
+
+// Clone implements Aggregation interface.
+// The counts collected so far are copied, so the clone doesn't share them with mf.
+func (mf *modeFunction) Clone() Aggregation {
+	nf := *mf
+	for i, arg := range mf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper, len(mf.resultMapper))
+	for key, ctx := range mf.resultMapper {
+		nf.resultMapper[key] = cloneModeContext(ctx)
+	}
+	if mf.streamCtx != nil {
+		nf.streamCtx = cloneModeContext(mf.streamCtx)
+	}
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (mf *modeFunction) GetType() *types.FieldType {
+	return mf.Args[0].GetType()
+}
+
+func (mf *modeFunction) updateCounter(ctx *aggEvaluateContext, row []types.Datum) error {
+	if len(mf.Args) != 1 {
+		return errors.New("Wrong number of args for AggFuncMode")
+	}
+	value, err := mf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	if ctx.Counter == nil {
+		ctx.Counter = newDatumCounter()
+	}
+	return errors.Trace(ctx.Counter.add(value))
+}
+
+// Update implements Aggregation interface.
+func (mf *modeFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return mf.updateCounter(mf.getContext(groupKey), row)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (mf *modeFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return mf.updateCounter(mf.getStreamedContext(), row)
+}
+
+func (mf *modeFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if ctx.Counter == nil {
+		return
+	}
+	sc := new(variable.StatementContext)
+	var mode *datumFrequency
+	for _, freq := range ctx.Counter.frequencies {
+		if mode == nil || freq.count > mode.count {
+			mode = freq
+			continue
+		}
+		if freq.count < mode.count {
+			continue
+		}
+		c, err := freq.value.CompareDatum(sc, mode.value)
+		if err != nil {
+			log.Warnf("Calculate mode failed in function %s, err msg is %s", mf, err.Error())
+			return types.Datum{}
+		}
+		if c < 0 {
+			mode = freq
+		}
+	}
+	return mode.value
+}
+
+// GetGroupResult implements Aggregation interface.
+func (mf *modeFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return mf.calculateResult(mf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (mf *modeFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{mf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (mf *modeFunction) GetStreamResult() (d types.Datum) {
+	if mf.streamCtx == nil {
+		return
+	}
+	d = mf.calculateResult(mf.streamCtx)
+	mf.streamCtx = nil
+	return
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"math"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// percentileContFunction takes a numeric value argument and a constant percentile
+// argument p in [0, 1], it returns the value at p of the sorted values, linearly
+// interpolated between the two nearest values.
+type percentileContFunction struct {
+	aggFunction
+}
+
+// Clone implements Aggregation interface.
+func (pf *percentileContFunction) Clone() Aggregation {
+	nf := *pf
+	for i, arg := range pf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (pf *percentileContFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeDouble)
+	types.SetBinChsClnFlag(ft)
+	ft.Flen, ft.Decimal = mysql.MaxRealWidth, types.UnspecifiedLength
+	return ft
+}
+
+// percentile evaluates the percentile argument, it must be a constant in [0, 1].
+func (pf *percentileContFunction) percentile(sc *variable.StatementContext) (float64, error) {
+	return evalPercentile(pf.Args[1], "AggFuncPercentileCont", sc)
+}
+
+// evalPercentile evaluates the percentile argument arg of the function funcName,
+// it must be a constant in [0, 1].
+func evalPercentile(arg expression.Expression, funcName string, sc *variable.StatementContext) (float64, error) {
+	if _, ok := arg.(*expression.Constant); !ok {
+		return 0, errors.Errorf("The percentile of %s should be a constant", funcName)
+	}
+	d, err := arg.Eval(nil)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if d.IsNull() {
+		return 0, errors.Errorf("The percentile of %s should not be NULL", funcName)
+	}
+	p, err := d.ToFloat64(sc)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if p < 0 || p > 1 {
+		return 0, errors.Errorf("The percentile of %s should be in [0, 1], got %v", funcName, p)
+	}
+	return p, nil
+}
+
+func (pf *percentileContFunction) updateValues(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(pf.Args) != 2 {
+		return errors.New("Wrong number of args for AggFuncPercentileCont")
+	}
+	if _, err := pf.percentile(sc); err != nil {
+		return errors.Trace(err)
+	}
+	value, err := pf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	x, err := value.ToFloat64(sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ctx.Values = append(ctx.Values, types.NewFloat64Datum(x))
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (pf *percentileContFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return pf.updateValues(pf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (pf *percentileContFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return pf.updateValues(pf.getStreamedContext(), row, sc)
+}
+
+func (pf *percentileContFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if len(ctx.Values) == 0 {
+		return
+	}
+	p, err := pf.percentile(new(variable.StatementContext))
+	if err != nil {
+		log.Warnf("Calculate percentile failed in function %s, err msg is %s", pf, err.Error())
+		return
+	}
+	values := make([]float64, 0, len(ctx.Values))
+	for _, v := range ctx.Values {
+		values = append(values, v.GetFloat64())
+	}
+	d.SetFloat64(calculatePercentileCont(values, p))
+	return
+}
+
+// calculatePercentileCont sorts values and returns the value at the rank
+// p * (len(values) - 1). If the rank is not an integer, the result is linearly
+// interpolated between the values at its floor and ceiling ranks.
+func calculatePercentileCont(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	rank := p * float64(len(values)-1)
+	lo, hi := math.Floor(rank), math.Ceil(rank)
+	loValue, hiValue := values[int(lo)], values[int(hi)]
+	if lo == hi {
+		return loValue
+	}
+	return loValue + (rank-lo)*(hiValue-loValue)
+}
+
+// GetGroupResult implements Aggregation interface.
+func (pf *percentileContFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return pf.calculateResult(pf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (pf *percentileContFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{pf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (pf *percentileContFunction) GetStreamResult() (d types.Datum) {
+	if pf.streamCtx == nil {
+		return
+	}
+	d = pf.calculateResult(pf.streamCtx)
+	pf.streamCtx = nil
+	return
+}
@@ -22,17 +22,26 @@ import (
 	"github.com/pingcap/tidb/util/types"
 )
 
+// sumFunction accumulates the integer and decimal values in decimal, like MySQL,
+// so the sum of int64 values never overflows. See calculateSum.
 type sumFunction struct {
 	aggFunction
 }
 
 // Clone implements Aggregation interface.
+// The values summed so far are copied, including the ones seen by DISTINCT.
 func (sf *sumFunction) Clone() Aggregation {
 	nf := *sf
 	for i, arg := range sf.Args {
 		nf.Args[i] = arg.Clone()
 	}
-	nf.resultMapper = make(aggCtxMapper)
+	nf.resultMapper = make(aggCtxMapper, len(sf.resultMapper))
+	for key, ctx := range sf.resultMapper {
+		nf.resultMapper[key] = cloneDistinctContext(ctx)
+	}
+	if sf.streamCtx != nil {
+		nf.streamCtx = cloneDistinctContext(sf.streamCtx)
+	}
 	return &nf
 }
 
@@ -0,0 +1,243 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tidb/util/types"
+	"github.com/pingcap/tidb/util/types/json"
+)
+
+const (
+	minTopK = 1
+	maxTopK = 10000
+)
+
+// spaceSavingCounter is the estimated count of a monitored value, it
+// overestimates the count by at most err.
+type spaceSavingCounter struct {
+	key   string
+	value types.Datum
+	count int64
+	err   int64
+}
+
+// spaceSaving finds the most frequent values with k counters by the Space-Saving
+// algorithm. A value not monitored takes over the counter with the minimum count
+// once all the counters are used, so every value whose count is greater than
+// n/k is monitored, where n is the number of the values.
+type spaceSaving struct {
+	k        int
+	counters map[string]*spaceSavingCounter
+	buf      []byte
+}
+
+func newSpaceSaving(k int) *spaceSaving {
+	return &spaceSaving{k: k, counters: make(map[string]*spaceSavingCounter, k)}
+}
+
+func (s *spaceSaving) insert(d types.Datum) error {
+	var err error
+	s.buf, err = codec.EncodeValue(s.buf[:0], d)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if counter, ok := s.counters[string(s.buf)]; ok {
+		counter.count++
+		return nil
+	}
+	key := string(s.buf)
+	if len(s.counters) < s.k {
+		s.counters[key] = &spaceSavingCounter{key: key, value: types.CopyDatum(d), count: 1}
+		return nil
+	}
+	// The counters are few, so the minimum one is found by scanning them.
+	var min *spaceSavingCounter
+	for _, counter := range s.counters {
+		if min == nil || counter.count < min.count || (counter.count == min.count && counter.key < min.key) {
+			min = counter
+		}
+	}
+	delete(s.counters, min.key)
+	s.counters[key] = &spaceSavingCounter{key: key, value: types.CopyDatum(d), count: min.count + 1, err: min.count}
+	return nil
+}
+
+// top returns the counters in the descending order of the counts, the ones with
+// the same count are ordered by their encoded values.
+func (s *spaceSaving) top() []*spaceSavingCounter {
+	counters := make([]*spaceSavingCounter, 0, len(s.counters))
+	for _, counter := range s.counters {
+		counters = append(counters, counter)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].count != counters[j].count {
+			return counters[i].count > counters[j].count
+		}
+		return counters[i].key < counters[j].key
+	})
+	return counters
+}
+
+func (s *spaceSaving) clone() *spaceSaving {
+	ns := &spaceSaving{k: s.k, counters: make(map[string]*spaceSavingCounter, len(s.counters))}
+	for key, counter := range s.counters {
+		nc := *counter
+		nc.value = types.CopyDatum(counter.value)
+		ns.counters[key] = &nc
+	}
+	return ns
+}
+
+// topKFunction estimates the k most frequent non-NULL values of a group by
+// Space-Saving, the second argument is the constant k in [1, 10000]. The result
+// is a JSON array of the objects like {"value": v, "count": n} in the descending
+// order of the estimated counts.
+type topKFunction struct {
+	aggFunction
+}
+
+func cloneTopKContext(ctx *aggEvaluateContext) *aggEvaluateContext {
+	nctx := *ctx
+	if ctx.TopK != nil {
+		nctx.TopK = ctx.TopK.clone()
+	}
+	return &nctx
+}
+
+// Clone implements Aggregation interface.
+// The counters collected so far are copied, so the clone doesn't share them with tf.
+func (tf *topKFunction) Clone() Aggregation {
+	nf := *tf
+	for i, arg := range tf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper, len(tf.resultMapper))
+	for key, ctx := range tf.resultMapper {
+		nf.resultMapper[key] = cloneTopKContext(ctx)
+	}
+	if tf.streamCtx != nil {
+		nf.streamCtx = cloneTopKContext(tf.streamCtx)
+	}
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (tf *topKFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeJSON)
+	types.SetBinChsClnFlag(ft)
+	return ft
+}
+
+// k evaluates the k argument, it must be a constant in [1, 10000].
+func (tf *topKFunction) k(sc *variable.StatementContext) (int, error) {
+	if _, ok := tf.Args[1].(*expression.Constant); !ok {
+		return 0, errors.New("The k of AggFuncTopK should be a constant")
+	}
+	d, err := tf.Args[1].Eval(nil)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if d.IsNull() {
+		return 0, errors.New("The k of AggFuncTopK should not be NULL")
+	}
+	k, err := d.ToInt64(sc)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if k < minTopK || k > maxTopK {
+		return 0, errors.Errorf("The k of AggFuncTopK should be in [%d, %d], got %d", minTopK, maxTopK, k)
+	}
+	return int(k), nil
+}
+
+func (tf *topKFunction) updateCounters(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(tf.Args) != 2 {
+		return errors.New("Wrong number of args for AggFuncTopK")
+	}
+	k, err := tf.k(sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	value, err := tf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	if ctx.TopK == nil {
+		ctx.TopK = newSpaceSaving(k)
+	}
+	return errors.Trace(ctx.TopK.insert(value))
+}
+
+// Update implements Aggregation interface.
+func (tf *topKFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return tf.updateCounters(tf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (tf *topKFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return tf.updateCounters(tf.getStreamedContext(), row, sc)
+}
+
+func (tf *topKFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if ctx.TopK == nil {
+		return
+	}
+	sc := new(variable.StatementContext)
+	counters := ctx.TopK.top()
+	elems := make([]json.JSON, 0, len(counters))
+	for _, counter := range counters {
+		value, err := datumToJSON(sc, counter.value)
+		if err != nil {
+			log.Warnf("Calculate topk failed in function %s, err msg is %s", tf, err.Error())
+			return types.Datum{}
+		}
+		elems = append(elems, json.CreateJSON(map[string]json.JSON{
+			"value": value,
+			"count": json.CreateJSON(counter.count),
+		}))
+	}
+	d.SetMysqlJSON(json.CreateJSON(elems))
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (tf *topKFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return tf.calculateResult(tf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (tf *topKFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{tf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (tf *topKFunction) GetStreamResult() (d types.Datum) {
+	if tf.streamCtx == nil {
+		return
+	}
+	d = tf.calculateResult(tf.streamCtx)
+	tf.streamCtx = nil
+	return
+}
@@ -37,6 +37,26 @@ func (d *distinctChecker) Check(values []types.Datum) (bool, error) {
 	return true, nil
 }
 
+// clone returns a copy of d, the values checked by the copy are not seen by d.
+func (d *distinctChecker) clone() *distinctChecker {
+	nd := createDistinctChecker()
+	it := d.existingKeys.NewIterator()
+	for key, value := it.Next(); key != nil; key, value = it.Next() {
+		nd.existingKeys.Put(key, value)
+	}
+	return nd
+}
+
+// cloneDistinctContext returns a copy of ctx which doesn't share the distinct
+// checker with ctx.
+func cloneDistinctContext(ctx *aggEvaluateContext) *aggEvaluateContext {
+	nctx := *ctx
+	if ctx.DistinctChecker != nil {
+		nctx.DistinctChecker = ctx.DistinctChecker.clone()
+	}
+	return &nctx
+}
+
 // calculateSum adds v to sum.
 func calculateSum(sc *variable.StatementContext, sum, v types.Datum) (data types.Datum, err error) {
 	// for avg and sum calculation
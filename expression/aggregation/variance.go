@@ -0,0 +1,123 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"math"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// varianceFunction calculates the population variance, or the population
+// standard deviation if isStd is set. It uses Welford's algorithm to keep the
+// running count, mean and sum of squared differences from the mean.
+type varianceFunction struct {
+	aggFunction
+	isStd bool
+}
+
+// Clone implements Aggregation interface.
+func (vf *varianceFunction) Clone() Aggregation {
+	nf := *vf
+	for i, arg := range vf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (vf *varianceFunction) GetType() *types.FieldType {
+	ft := types.NewFieldType(mysql.TypeDouble)
+	types.SetBinChsClnFlag(ft)
+	ft.Flen, ft.Decimal = mysql.MaxRealWidth, types.UnspecifiedLength
+	return ft
+}
+
+func (vf *varianceFunction) updateVariance(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(vf.Args) != 1 {
+		return errors.Errorf("Wrong number of args for AggFunc%s", vf.name)
+	}
+	value, err := vf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() {
+		return nil
+	}
+	if vf.Distinct {
+		d, err1 := ctx.DistinctChecker.Check([]types.Datum{value})
+		if err1 != nil {
+			return errors.Trace(err1)
+		}
+		if !d {
+			return nil
+		}
+	}
+	x, err := value.ToFloat64(sc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ctx.Count++
+	delta := x - ctx.Mean
+	ctx.Mean += delta / float64(ctx.Count)
+	ctx.M2 += delta * (x - ctx.Mean)
+	return nil
+}
+
+// Update implements Aggregation interface.
+func (vf *varianceFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return vf.updateVariance(vf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (vf *varianceFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return vf.updateVariance(vf.getStreamedContext(), row, sc)
+}
+
+func (vf *varianceFunction) calculateResult(ctx *aggEvaluateContext) (d types.Datum) {
+	if ctx.Count == 0 {
+		return
+	}
+	variance := ctx.M2 / float64(ctx.Count)
+	if vf.isStd {
+		d.SetFloat64(math.Sqrt(variance))
+	} else {
+		d.SetFloat64(variance)
+	}
+	return
+}
+
+// GetGroupResult implements Aggregation interface.
+func (vf *varianceFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return vf.calculateResult(vf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (vf *varianceFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{vf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (vf *varianceFunction) GetStreamResult() (d types.Datum) {
+	if vf.streamCtx == nil {
+		return
+	}
+	d = vf.calculateResult(vf.streamCtx)
+	vf.streamCtx = nil
+	return
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// wavgFunction takes a value argument and a weight argument, it returns the
+// weighted average sum(value*weight)/sum(weight). Like sum and avg, it uses
+// decimal for integer and decimal arguments, and float for the others.
+type wavgFunction struct {
+	aggFunction
+}
+
+// Clone implements Aggregation interface.
+func (wf *wavgFunction) Clone() Aggregation {
+	nf := *wf
+	for i, arg := range wf.Args {
+		nf.Args[i] = arg.Clone()
+	}
+	nf.resultMapper = make(aggCtxMapper)
+	return &nf
+}
+
+// GetType implements Aggregation interface.
+func (wf *wavgFunction) GetType() *types.FieldType {
+	var ft *types.FieldType
+	switch {
+	case isDecimalClass(wf.Args[0].GetType()) && isDecimalClass(wf.Args[1].GetType()):
+		ft = types.NewFieldType(mysql.TypeNewDecimal)
+		ft.Flen, ft.Decimal = mysql.MaxRealWidth, wf.Args[0].GetType().Decimal
+	default:
+		ft = types.NewFieldType(mysql.TypeDouble)
+		ft.Flen, ft.Decimal = mysql.MaxRealWidth, types.UnspecifiedLength
+	}
+	types.SetBinChsClnFlag(ft)
+	return ft
+}
+
+// isDecimalClass checks if the values of tp are calculated as decimals.
+func isDecimalClass(tp *types.FieldType) bool {
+	switch tp.ToClass() {
+	case types.ClassInt, types.ClassDecimal:
+		return true
+	}
+	return false
+}
+
+func (wf *wavgFunction) updateWAvg(ctx *aggEvaluateContext, row []types.Datum, sc *variable.StatementContext) error {
+	if len(wf.Args) != 2 {
+		return errors.New("Wrong number of args for AggFuncWAvg")
+	}
+	value, err := wf.Args[0].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	weight, err := wf.Args[1].Eval(row)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if value.IsNull() || weight.IsNull() {
+		return nil
+	}
+	// Convert them to decimal or float like sum does.
+	if value, err = calculateSum(sc, types.Datum{}, value); err != nil {
+		return errors.Trace(err)
+	}
+	if weight, err = calculateSum(sc, types.Datum{}, weight); err != nil {
+		return errors.Trace(err)
+	}
+	var product types.Datum
+	if value.Kind() == types.KindMysqlDecimal && weight.Kind() == types.KindMysqlDecimal {
+		product, err = types.ComputeMul(value, weight)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	} else {
+		x, err := value.ToFloat64(sc)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		y, err := weight.ToFloat64(sc)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		product.SetFloat64(x * y)
+	}
+	if ctx.Value, err = calculateSum(sc, ctx.Value, product); err != nil {
+		return errors.Trace(err)
+	}
+	ctx.Weight, err = calculateSum(sc, ctx.Weight, weight)
+	return errors.Trace(err)
+}
+
+// Update implements Aggregation interface.
+func (wf *wavgFunction) Update(row []types.Datum, groupKey []byte, sc *variable.StatementContext) error {
+	return wf.updateWAvg(wf.getContext(groupKey), row, sc)
+}
+
+// StreamUpdate implements Aggregation interface.
+func (wf *wavgFunction) StreamUpdate(row []types.Datum, sc *variable.StatementContext) error {
+	return wf.updateWAvg(wf.getStreamedContext(), row, sc)
+}
+
+// calculateResult returns NULL if there is no row or the total weight is zero.
+func (wf *wavgFunction) calculateResult(ctx *aggEvaluateContext) types.Datum {
+	if ctx.Weight.IsNull() {
+		return types.Datum{}
+	}
+	d, err := types.ComputeDiv(new(variable.StatementContext), ctx.Value, ctx.Weight)
+	if err != nil {
+		log.Warnf("Calculate weighted average failed in function %s, err msg is %s", wf, err.Error())
+		return types.Datum{}
+	}
+	return d
+}
+
+// GetGroupResult implements Aggregation interface.
+func (wf *wavgFunction) GetGroupResult(groupKey []byte) types.Datum {
+	return wf.calculateResult(wf.getContext(groupKey))
+}
+
+// GetPartialResult implements Aggregation interface.
+func (wf *wavgFunction) GetPartialResult(groupKey []byte) []types.Datum {
+	return []types.Datum{wf.GetGroupResult(groupKey)}
+}
+
+// GetStreamResult implements Aggregation interface.
+func (wf *wavgFunction) GetStreamResult() (d types.Datum) {
+	if wf.streamCtx == nil {
+		return
+	}
+	d = wf.calculateResult(wf.streamCtx)
+	wf.streamCtx = nil
+	return
+}
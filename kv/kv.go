@@ -176,6 +176,9 @@ type Request struct {
 	IsolationLevel IsoLevel
 	// Priority is the priority of this KV request, its value may be PriorityNormal/PriorityLow/PriorityHigh.
 	Priority int
+	// StartTs is the start timestamp encoded in Data, the store checks it against
+	// the safepoint before sending the request. 0 means it's not checked.
+	StartTs uint64
 }
 
 // Response represents the response returned from KV layer.
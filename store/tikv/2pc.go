@@ -74,6 +74,16 @@ type twoPhaseCommitter struct {
 		undetermined bool
 	}
 	priority pb.CommandPri
+	detail   CommitDetails
+}
+
+// CommitDetails contains the time spent in each phase of committing a transaction.
+type CommitDetails struct {
+	PrewriteTime time.Duration
+	CommitTime   time.Duration
+	// RegionCount is the number of regions the keys are prewritten to, the
+	// regions retried after region errors are counted again.
+	RegionCount int32
 }
 
 // newTwoPhaseCommitter creates a twoPhaseCommitter.
@@ -194,6 +204,9 @@ func (c *twoPhaseCommitter) doActionOnKeys(bo *Backoffer, action twoPhaseCommitA
 	}
 
 	txnRegionsNumHistogram.WithLabelValues(action.MetricsTag()).Observe(float64(len(groups)))
+	if action == actionPrewrite {
+		atomic.AddInt32(&c.detail.RegionCount, int32(len(groups)))
+	}
 
 	var batches []batchKeys
 	var sizeFunc = c.keySize
@@ -541,7 +554,7 @@ func (c *twoPhaseCommitter) execute() error {
 		if !committed && !undetermined {
 			go func() {
 				reserveStack(false)
-				err := c.cleanupKeys(NewBackoffer(cleanupMaxBackoff, goctx.Background()), writtenKeys)
+				err := c.cleanupKeys(c.store.newBackoffer(cleanupMaxBackoff, goctx.Background()), writtenKeys)
 				if err != nil {
 					log.Infof("2PC cleanup err: %v, tid: %d", err, c.startTS)
 				} else {
@@ -553,7 +566,9 @@ func (c *twoPhaseCommitter) execute() error {
 
 	ctx := goctx.Background()
 	binlogChan := c.prewriteBinlog()
-	err := c.prewriteKeys(NewBackoffer(prewriteMaxBackoff, ctx), c.keys)
+	start := time.Now()
+	err := c.prewriteKeys(c.store.newBackoffer(prewriteMaxBackoff, ctx), c.keys)
+	c.detail.PrewriteTime = time.Since(start)
 	if binlogChan != nil {
 		binlogErr := <-binlogChan
 		if binlogErr != nil {
@@ -565,10 +580,13 @@ func (c *twoPhaseCommitter) execute() error {
 		return errors.Trace(err)
 	}
 
-	commitTS, err := c.store.getTimestampWithRetry(NewBackoffer(tsoMaxBackoff, ctx))
-	if err != nil {
-		log.Warnf("2PC get commitTS failed: %v, tid: %d", err, c.startTS)
-		return errors.Trace(err)
+	commitTS := c.txn.pinnedCommitTS
+	if commitTS == 0 {
+		commitTS, err = c.store.getTimestampFromPD(c.store.newBackoffer(tsoMaxBackoff, ctx))
+		if err != nil {
+			log.Warnf("2PC get commitTS failed: %v, tid: %d", err, c.startTS)
+			return errors.Trace(err)
+		}
 	}
 
 	// check commitTS
@@ -584,12 +602,15 @@ func (c *twoPhaseCommitter) execute() error {
 		return errors.Trace(err)
 	}
 
-	if c.store.oracle.IsExpired(c.startTS, maxTxnTimeUse) {
+	// The pinned timestamps are crafted by tests, they may be far from the oracle's.
+	if c.txn.pinnedCommitTS == 0 && c.store.oracle.IsExpired(c.startTS, maxTxnTimeUse) {
 		err = errors.Errorf("txn takes too much time, start: %d, commit: %d", c.startTS, c.commitTS)
 		return errors.Annotate(err, txnRetryableMark)
 	}
 
-	err = c.commitKeys(NewBackoffer(commitMaxBackoff, ctx), c.keys)
+	start = time.Now()
+	err = c.commitKeys(c.store.newBackoffer(commitMaxBackoff, ctx), c.keys)
+	c.detail.CommitTime = time.Since(start)
 	if err != nil {
 		if errors.Cause(err) == terror.ErrResultUndetermined {
 			c.mu.undetermined = true
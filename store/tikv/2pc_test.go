@@ -23,6 +23,7 @@ import (
 	. "github.com/pingcap/check"
 	"github.com/pingcap/kvproto/pkg/errorpb"
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/tikv/mock-tikv"
 	"github.com/pingcap/tidb/store/tikv/tikvrpc"
 	"github.com/pingcap/tidb/terror"
@@ -42,7 +43,7 @@ func (s *testCommitterSuite) SetUpTest(c *C) {
 	mvccStore := mocktikv.NewMvccStore()
 	client := mocktikv.NewRPCClient(s.cluster, mvccStore)
 	pdCli := &codecPDClient{mocktikv.NewPDClient(s.cluster)}
-	store, err := newTikvStore("mock-tikv-store", pdCli, client, false)
+	store, err := newTikvStore("mock-tikv-store", pdCli, client, false, 0, nil)
 	c.Assert(err, IsNil)
 	s.store = store
 	commitMaxBackoff = 2000
@@ -415,6 +416,64 @@ func (s *testCommitterSuite) TestCommitPrimaryRpcErrors(c *C) {
 
 // TestCommitPrimaryRegionError tests RegionError is handled properly
 // when committing primary region task.
+func (s *testCommitterSuite) TestBeginWithTS(c *C) {
+	beginWithTS := func(startTS, commitTS uint64) *tikvTxn {
+		txn, err := s.store.BeginWithTS(startTS, commitTS)
+		c.Assert(err, IsNil)
+		return txn.(*tikvTxn)
+	}
+	get := func(ts uint64, key string) string {
+		txn, err := s.store.BeginWithStartTS(ts)
+		c.Assert(err, IsNil)
+		val, err := txn.Get([]byte(key))
+		if kv.IsErrNotFound(err) {
+			return ""
+		}
+		c.Assert(err, IsNil)
+		return string(val)
+	}
+
+	txn1 := beginWithTS(100, 110)
+	txn2 := beginWithTS(105, 120)
+	c.Assert(txn1.Set([]byte("a"), []byte("a1")), IsNil)
+	c.Assert(txn1.Commit(), IsNil)
+	c.Assert(txn1.commitTS, Equals, uint64(110))
+	// txn2 started before txn1 committed, so txn1's write isn't visible to it.
+	val, err := txn2.Get([]byte("a"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue, Commentf("value %q", val))
+	c.Assert(txn2.Set([]byte("b"), []byte("b2")), IsNil)
+	c.Assert(txn2.Commit(), IsNil)
+	c.Assert(txn2.commitTS, Equals, uint64(120))
+
+	for _, t := range []struct {
+		ts   uint64
+		a, b string
+	}{
+		{109, "", ""},
+		{110, "a1", ""},
+		{119, "a1", ""},
+		{120, "a1", "b2"},
+	} {
+		c.Assert(get(t.ts, "a"), Equals, t.a, Commentf("ts %d", t.ts))
+		c.Assert(get(t.ts, "b"), Equals, t.b, Commentf("ts %d", t.ts))
+	}
+
+	// Writing the key committed after the startTS conflicts.
+	txn3 := beginWithTS(115, 130)
+	c.Assert(txn3.Set([]byte("b"), []byte("b3")), IsNil)
+	c.Assert(txn3.Commit(), NotNil)
+	c.Assert(get(200, "b"), Equals, "b2")
+
+	_, err = s.store.BeginWithTS(200, 200)
+	c.Assert(err, NotNil)
+	_, err = s.store.BeginWithTS(200, 150)
+	c.Assert(err, NotNil)
+	s.store.mock = false
+	_, err = s.store.BeginWithTS(200, 300)
+	s.store.mock = true
+	c.Assert(err, NotNil)
+}
+
 func (s *testCommitterSuite) TestCommitPrimaryRegionError(c *C) {
 	s.store.client = &interceptCommitClient{
 		Client: s.store.client,
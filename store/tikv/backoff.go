@@ -39,6 +39,17 @@ const (
 // optional jitters.
 // See http://www.awsarchitectureblog.com/2015/03/backoff.html
 func NewBackoffFn(base, cap, jitter int) func() int {
+	next := newBackoffSleepFn(base, cap, jitter)
+	return func() int {
+		sleep := next()
+		time.Sleep(time.Duration(sleep) * time.Millisecond)
+		return sleep
+	}
+}
+
+// newBackoffSleepFn creates a func which returns the sleep time(in ms) of the
+// next attempt of NewBackoffFn, without sleeping.
+func newBackoffSleepFn(base, cap, jitter int) func() int {
 	attempts := 0
 	lastSleep := base
 	return func() int {
@@ -55,8 +66,6 @@ func NewBackoffFn(base, cap, jitter int) func() int {
 		case DecorrJitter:
 			sleep = int(math.Min(float64(cap), float64(base+rand.Intn(lastSleep*3-base))))
 		}
-		time.Sleep(time.Duration(sleep) * time.Millisecond)
-
 		attempts++
 		lastSleep = sleep
 		return lastSleep
@@ -78,24 +87,69 @@ const (
 	boServerBusy
 )
 
+// The error types passed to RetryPolicy.NextBackoff.
+const (
+	RetryTiKVRPC     = int(boTiKVRPC)
+	RetryTxnLock     = int(boTxnLock)
+	RetryTxnLockFast = int(boTxnLockFast)
+	RetryPDRPC       = int(boPDRPC)
+	RetryRegionMiss  = int(boRegionMiss)
+	RetryServerBusy  = int(boServerBusy)
+)
+
 func (t backoffType) createFn() func() int {
 	switch t {
 	case boTiKVRPC:
-		return NewBackoffFn(100, 2000, EqualJitter)
+		return newBackoffSleepFn(100, 2000, EqualJitter)
 	case boTxnLock:
-		return NewBackoffFn(200, 3000, EqualJitter)
+		return newBackoffSleepFn(200, 3000, EqualJitter)
 	case boTxnLockFast:
-		return NewBackoffFn(100, 3000, EqualJitter)
+		return newBackoffSleepFn(100, 3000, EqualJitter)
 	case boPDRPC:
-		return NewBackoffFn(500, 3000, EqualJitter)
+		return newBackoffSleepFn(500, 3000, EqualJitter)
 	case boRegionMiss:
-		return NewBackoffFn(100, 500, NoJitter)
+		return newBackoffSleepFn(100, 500, NoJitter)
 	case boServerBusy:
-		return NewBackoffFn(2000, 10000, EqualJitter)
+		return newBackoffSleepFn(2000, 10000, EqualJitter)
 	}
 	return nil
 }
 
+// RetryPolicy decides how long a Backoffer sleeps before retrying the request
+// failed with the error type, which is one of the Retry* constants. A policy
+// is created for each Backoffer, so it can count the attempts. The maxSleep of
+// the Backoffer still bounds the total sleep time.
+type RetryPolicy interface {
+	// NextBackoff returns the sleep time before the next retry, or false if
+	// it shouldn't retry anymore.
+	NextBackoff(errType int) (time.Duration, bool)
+}
+
+// defaultRetryPolicy backs off exponentially with the base and the cap of each
+// error type, it always retries until maxSleep is exceeded.
+type defaultRetryPolicy struct {
+	fn map[backoffType]func() int
+}
+
+// NewDefaultRetryPolicy creates the RetryPolicy used if no one is specified.
+func NewDefaultRetryPolicy() RetryPolicy {
+	return &defaultRetryPolicy{fn: make(map[backoffType]func() int)}
+}
+
+// NextBackoff implements the RetryPolicy interface.
+func (p *defaultRetryPolicy) NextBackoff(errType int) (time.Duration, bool) {
+	typ := backoffType(errType)
+	f, ok := p.fn[typ]
+	if !ok {
+		f = typ.createFn()
+		if f == nil {
+			return 0, false
+		}
+		p.fn[typ] = f
+	}
+	return time.Duration(f()) * time.Millisecond, true
+}
+
 func (t backoffType) String() string {
 	switch t {
 	case boTiKVRPC:
@@ -128,18 +182,22 @@ const (
 	gcResolveLockMaxBackoff = 100000
 	gcDeleteRangeMaxBackoff = 100000
 	rawkvMaxBackoff         = 20000
+	sendReqMaxBackoff       = 20000
 )
 
 var commitMaxBackoff = 20000
 
 // Backoffer is a utility for retrying queries.
 type Backoffer struct {
-	fn         map[backoffType]func() int
 	maxSleep   int
 	totalSleep int
 	errors     []error
 	ctx        goctx.Context
 	types      []backoffType
+	// policy is created by newPolicy lazily, the default one is used if
+	// newPolicy is nil.
+	policy    RetryPolicy
+	newPolicy func() RetryPolicy
 }
 
 // NewBackoffer creates a Backoffer with maximum sleep time(in ms).
@@ -150,6 +208,19 @@ func NewBackoffer(maxSleep int, ctx goctx.Context) *Backoffer {
 	}
 }
 
+// newBackoffer creates a Backoffer like NewBackoffer, maxSleep is capped by the
+// store's maxBackoff if it's set. The per-command limits are still the upper
+// bounds, so maxBackoff can only shorten the retries.
+// The store's retry policy is used if it's set.
+func (s *tikvStore) newBackoffer(maxSleep int, ctx goctx.Context) *Backoffer {
+	if s.maxBackoff > 0 && s.maxBackoff < maxSleep {
+		maxSleep = s.maxBackoff
+	}
+	bo := NewBackoffer(maxSleep, ctx)
+	bo.newPolicy = s.retryPolicy
+	return bo
+}
+
 // Backoff sleeps a while base on the backoffType and records the error message.
 // It returns a retryable error if total sleep time exceeds maxSleep.
 func (b *Backoffer) Backoff(typ backoffType, err error) error {
@@ -161,33 +232,53 @@ func (b *Backoffer) Backoff(typ backoffType, err error) error {
 
 	backoffCounter.WithLabelValues(typ.String()).Inc()
 	// Lazy initialize.
-	if b.fn == nil {
-		b.fn = make(map[backoffType]func() int)
+	if b.policy == nil {
+		if b.newPolicy != nil {
+			b.policy = b.newPolicy()
+		} else {
+			b.policy = NewDefaultRetryPolicy()
+		}
 	}
-	f, ok := b.fn[typ]
+	sleep, ok := b.policy.NextBackoff(int(typ))
 	if !ok {
-		f = typ.createFn()
-		b.fn[typ] = f
+		b.errors = append(b.errors, err)
+		return errors.Annotate(b.retryError(fmt.Sprintf("retry policy gives up on %s after %d retries, errors:", typ, len(b.types))), txnRetryableMark)
 	}
-
-	b.totalSleep += f()
+	timer := time.NewTimer(sleep)
+	select {
+	case <-timer.C:
+	case <-b.ctx.Done():
+		timer.Stop()
+	}
+	b.totalSleep += int(sleep / time.Millisecond)
 	b.types = append(b.types, typ)
 
+	// Don't retry if the context is done during the sleep.
+	select {
+	case <-b.ctx.Done():
+		return errors.Trace(err)
+	default:
+	}
+
 	log.Debugf("%v, retry later(totalSleep %dms, maxSleep %dms)", err, b.totalSleep, b.maxSleep)
 	b.errors = append(b.errors, err)
 	if b.maxSleep > 0 && b.totalSleep >= b.maxSleep {
-		errMsg := fmt.Sprintf("backoffer.maxSleep %dms is exceeded, errors:", b.maxSleep)
-		for i, err := range b.errors {
-			// Print only last 3 errors for non-DEBUG log levels.
-			if log.GetLevel() == log.DebugLevel || i >= len(b.errors)-3 {
-				errMsg += "\n" + err.Error()
-			}
-		}
-		return errors.Annotate(errors.New(errMsg), txnRetryableMark)
+		return errors.Annotate(b.retryError(fmt.Sprintf("backoffer.maxSleep %dms is exceeded, errors:", b.maxSleep)), txnRetryableMark)
 	}
 	return nil
 }
 
+// retryError returns the error with errMsg followed by the recorded errors.
+func (b *Backoffer) retryError(errMsg string) error {
+	for i, err := range b.errors {
+		// Print only last 3 errors for non-DEBUG log levels.
+		if log.GetLevel() == log.DebugLevel || i >= len(b.errors)-3 {
+			errMsg += "\n" + err.Error()
+		}
+	}
+	return errors.New(errMsg)
+}
+
 func (b *Backoffer) String() string {
 	if b.totalSleep == 0 {
 		return ""
@@ -203,6 +294,7 @@ func (b *Backoffer) Clone() *Backoffer {
 		totalSleep: b.totalSleep,
 		errors:     b.errors,
 		ctx:        b.ctx,
+		newPolicy:  b.newPolicy,
 	}
 }
 
@@ -215,5 +307,6 @@ func (b *Backoffer) Fork() (*Backoffer, goctx.CancelFunc) {
 		totalSleep: b.totalSleep,
 		errors:     b.errors,
 		ctx:        ctx,
+		newPolicy:  b.newPolicy,
 	}, cancel
 }
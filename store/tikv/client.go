@@ -109,11 +109,21 @@ type rpcClient struct {
 	sync.RWMutex
 	isClosed bool
 	conns    map[string]*connArray
+	// connCount is the number of connections to each TiKV store.
+	connCount uint32
 }
 
-func newRPCClient() *rpcClient {
+// newRPCClient creates a client with connCount connections to each TiKV store,
+// or maxConnectionNumber if connCount is 0. Every connection has its own
+// buffers and flow control window, so the memory used grows with connCount
+// times the number of stores.
+func newRPCClient(connCount uint32) *rpcClient {
+	if connCount == 0 {
+		connCount = maxConnectionNumber
+	}
 	return &rpcClient{
-		conns: make(map[string]*connArray),
+		conns:     make(map[string]*connArray),
+		connCount: connCount,
 	}
 }
 
@@ -141,7 +151,7 @@ func (c *rpcClient) createConnArray(addr string) (*connArray, error) {
 	array, ok := c.conns[addr]
 	if !ok {
 		var err error
-		array, err = newConnArray(maxConnectionNumber, addr)
+		array, err = newConnArray(c.connCount, addr)
 		if err != nil {
 			return nil, err
 		}
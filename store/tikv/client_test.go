@@ -30,7 +30,7 @@ type testClientSuite struct {
 var _ = Suite(&testClientSuite{})
 
 func (s *testClientSuite) TestConn(c *C) {
-	client := newRPCClient()
+	client := newRPCClient(0)
 
 	addr := "127.0.0.1:6379"
 	conn1, err := client.getConn(addr)
@@ -45,3 +45,19 @@ func (s *testClientSuite) TestConn(c *C) {
 	c.Assert(err, NotNil)
 	c.Assert(conn3, IsNil)
 }
+
+func (s *testClientSuite) TestConnCount(c *C) {
+	client := newRPCClient(2)
+	defer client.Close()
+
+	addr := "127.0.0.1:6379"
+	conn1, err := client.getConn(addr)
+	c.Assert(err, IsNil)
+	conn2, err := client.getConn(addr)
+	c.Assert(err, IsNil)
+	c.Assert(conn2, Not(Equals), conn1)
+	// The connections are used in turn.
+	conn3, err := client.getConn(addr)
+	c.Assert(err, IsNil)
+	c.Assert(conn3, Equals, conn1)
+}
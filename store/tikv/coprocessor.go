@@ -93,7 +93,12 @@ func (c *CopClient) supportExpr(exprType tipb.ExprType) bool {
 func (c *CopClient) Send(ctx goctx.Context, req *kv.Request) kv.Response {
 	coprocessorCounter.WithLabelValues("send").Inc()
 
-	bo := NewBackoffer(copBuildTaskMaxBackoff, ctx)
+	if req.StartTs != 0 {
+		if err := c.store.CheckVisibility(req.StartTs); err != nil {
+			return copErrorResponse{errors.Trace(err)}
+		}
+	}
+	bo := c.store.newBackoffer(copBuildTaskMaxBackoff, ctx)
 	tasks, err := buildCopTasks(bo, c.store.regionCache, &copRanges{mid: req.KeyRanges}, req.Desc)
 	if err != nil {
 		return copErrorResponse{err}
@@ -324,7 +329,7 @@ const minLogCopTaskTime = 300 * time.Millisecond
 func (it *copIterator) work(ctx goctx.Context, taskCh <-chan *copTask) {
 	defer it.wg.Done()
 	for task := range taskCh {
-		bo := NewBackoffer(copNextMaxBackoff, ctx)
+		bo := it.store.newBackoffer(copNextMaxBackoff, ctx)
 		startTime := time.Now()
 		resps := it.handleTask(bo, task)
 		costTime := time.Since(startTime)
@@ -14,7 +14,10 @@
 package tikv
 
 import (
+	"strings"
+
 	"github.com/juju/errors"
+	"github.com/pingcap/tidb/kv"
 )
 
 var (
@@ -24,6 +27,17 @@ var (
 	errInvalidResponse = errors.New("invalid response")
 	// errBodyMissing response body is missing error
 	errBodyMissing = errors.New("response body is missing")
+	// ErrStoreClosing is returned by Driver.Open if the store of the same cluster is being closed,
+	// the caller can retry later.
+	ErrStoreClosing = errors.New("tikv store is closing")
+	// ErrReadOnlyTxn is returned when writing in a transaction started by BeginReadOnly.
+	ErrReadOnlyTxn = errors.New("write in read-only transaction")
+	// ErrStartTSBelowSafePoint is returned when the start timestamp is older than the safepoint,
+	// the data of it may have been collected by GC.
+	ErrStartTSBelowSafePoint = errors.New("start timestamp falls behind safepoint")
+	// ErrRateLimited is returned by SendReq if the rate of the requests exceeds maxReqPerSec
+	// and rejectRateLimited is set, the caller can retry later.
+	ErrRateLimited = errors.New("tikv store request rate limited")
 )
 
 // TiDB decides whether to retry transaction by checking if error message contains
@@ -33,3 +47,19 @@ var (
 // Note that it should be only used if i) the error occurs inside a transaction
 // and ii) the error is not totally unexpected and hopefully will recover soon.
 const txnRetryableMark = "[try again later]"
+
+// IsRetryableError checks if err is worth to retry, so the callers don't need
+// to match the error messages. It's true for the errors annotated with
+// txnRetryableMark, e.g. the backoffer gives up on region errors or lock
+// conflicts, the retryable errors of kv, e.g. kv.ErrLockConflict, the i/o
+// timeouts, e.g. connecting PD times out, ErrStoreClosing and ErrRateLimited.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if cause := errors.Cause(err); cause == ErrStoreClosing || cause == ErrRateLimited || kv.IsRetryableError(err) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, txnRetryableMark) || strings.Contains(msg, "i/o timeout")
+}
@@ -18,12 +18,14 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/juju/errors"
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
 	"github.com/pingcap/tidb"
+	"github.com/pingcap/tidb/ast"
 	"github.com/pingcap/tidb/ddl"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/meta"
@@ -89,7 +91,16 @@ const (
 
 	gcLifeTimeKey     = "tikv_gc_life_time"
 	gcDefaultLifeTime = time.Minute * 10
+	gcMinLifeTime     = time.Minute * 10
 	gcSafePointKey    = "tikv_gc_safe_point"
+	gcSavedSafePoint  = "tikv_gc_saved_safe_point"
+
+	// gcHistoryKeyPrefix is the prefix of the keys of the GC runs, the key is
+	// followed by the zero-padded safepoint, so the keys sort by time.
+	gcHistoryKeyPrefix = "tikv_gc_history_"
+	gcHistoryComment   = "The start time of the GC run of the safe point. (DO NOT EDIT)"
+	// gcMaxHistory is the max number of the GC runs kept in the sys table.
+	gcMaxHistory = 100
 )
 
 var gcVariableComments = map[string]string{
@@ -100,10 +111,14 @@ var gcVariableComments = map[string]string{
 	gcRunIntervalKey: "GC run interval, at least 10m, in Go format.",
 	gcLifeTimeKey:    "All versions within life time will not be collected by GC, at least 10m, in Go format.",
 	gcSafePointKey:   "All versions after safe point can be accessed. (DO NOT EDIT)",
+	gcSavedSafePoint: "Safe point in TSO format, used to check visibility of transactions. (DO NOT EDIT)",
 }
 
 func (w *GCWorker) start(ctx goctx.Context) {
 	log.Infof("[gc worker] %s start.", w.uuid)
+	if err := w.initLifeTime(); err != nil {
+		log.Warnf("[gc worker] init life time err: %v", err)
+	}
 	w.tick(ctx) // Immediately tick once to initialize configs.
 
 	ticker := time.NewTicker(gcWorkerTickInterval)
@@ -126,6 +141,20 @@ func (w *GCWorker) start(ctx goctx.Context) {
 	}
 }
 
+// initLifeTime saves the GC life time specified when opening the store, the
+// value in the sys table takes precedence if there is one.
+func (w *GCWorker) initLifeTime() error {
+	if w.store.initialGCLifeTime == 0 {
+		return nil
+	}
+	lifeTime, err := w.loadDuration(gcLifeTimeKey)
+	if err != nil || lifeTime != nil {
+		return errors.Trace(err)
+	}
+	err = w.saveDuration(gcLifeTimeKey, w.store.initialGCLifeTime)
+	return errors.Trace(err)
+}
+
 func createSession(store kv.Storage) tidb.Session {
 	for {
 		session, err := tidb.CreateSession(store)
@@ -221,7 +250,19 @@ func (w *GCWorker) prepare() (bool, uint64, error) {
 	if err != nil {
 		return false, 0, errors.Trace(err)
 	}
-	return true, oracle.ComposeTS(oracle.GetPhysical(*newSafePoint), 0), nil
+	safePoint := oracle.ComposeTS(oracle.GetPhysical(*newSafePoint), 0)
+	err = w.saveUint64(gcSavedSafePoint, safePoint)
+	if err != nil {
+		return false, 0, errors.Trace(err)
+	}
+	session := createSession(w.store)
+	err = saveGCHistory(session, GCRun{SafePoint: safePoint, StartTime: now})
+	session.Close()
+	if err != nil {
+		// The history is only informational, don't block GC on it.
+		log.Warnf("[gc worker] save gc history err: %v", err)
+	}
+	return true, safePoint, nil
 }
 
 func (w *GCWorker) getOracleTime() (time.Time, error) {
@@ -637,16 +678,45 @@ func (w *GCWorker) loadDurationWithDefault(key string, def time.Duration) (*time
 	return d, nil
 }
 
+func (w *GCWorker) saveUint64(key string, v uint64) error {
+	err := w.saveValueToSysTable(key, strconv.FormatUint(v, 10))
+	return errors.Trace(err)
+}
+
 func (w *GCWorker) loadValueFromSysTable(key string) (string, error) {
 	session := createSession(w.store)
 	defer session.Close()
+	return loadValueFromSysTable(session, key)
+}
 
-	stmt := fmt.Sprintf(`SELECT (variable_value) FROM mysql.tidb WHERE variable_name='%s' FOR UPDATE`, key)
-	rs, err := session.Execute(stmt)
+func (w *GCWorker) saveValueToSysTable(key, value string) error {
+	session := createSession(w.store)
+	defer session.Close()
+	return saveValueToSysTable(session, key, value)
+}
+
+func loadUint64(session tidb.Session, key string) (uint64, error) {
+	str, err := loadValueFromSysTable(session, key)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if str == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return v, nil
+}
+
+func loadValueFromSysTable(session tidb.Session, key string) (string, error) {
+	stmt := `SELECT (variable_value) FROM mysql.tidb WHERE variable_name=? FOR UPDATE`
+	rs, err := executeWithArgs(session, stmt, key)
 	if err != nil {
 		return "", errors.Trace(err)
 	}
-	row, err := rs[0].Next()
+	row, err := rs.Next()
 	if err != nil {
 		return "", errors.Trace(err)
 	}
@@ -659,19 +729,84 @@ func (w *GCWorker) loadValueFromSysTable(key string) (string, error) {
 	return value, nil
 }
 
-func (w *GCWorker) saveValueToSysTable(key, value string) error {
-	session := createSession(w.store)
-	defer session.Close()
-
-	stmt := fmt.Sprintf(`INSERT INTO mysql.tidb VALUES ('%[1]s', '%[2]s', '%[3]s')
+func saveValueToSysTable(session tidb.Session, key, value string) error {
+	stmt := `INSERT INTO mysql.tidb VALUES (?, ?, ?)
 			       ON DUPLICATE KEY
-			       UPDATE variable_value = '%[2]s', comment = '%[3]s'`,
-		key, value, gcVariableComments[key])
-	_, err := session.Execute(stmt)
+			       UPDATE variable_value = ?, comment = ?`
+	comment := gcVariableComments[key]
+	_, err := executeWithArgs(session, stmt, key, value, comment, value, comment)
 	log.Debugf("[gc worker] save kv, %s:%s %v", key, value, err)
 	return errors.Trace(err)
 }
 
+// GCRun is a GC run recorded in the sys table.
+type GCRun struct {
+	// SafePoint is the safepoint of the run in TSO format.
+	SafePoint uint64
+	StartTime time.Time
+}
+
+// saveGCHistory records run and removes the oldest runs beyond gcMaxHistory.
+func saveGCHistory(session tidb.Session, run GCRun) error {
+	stmt := `INSERT INTO mysql.tidb VALUES (?, ?, ?)
+			       ON DUPLICATE KEY
+			       UPDATE variable_value = ?, comment = ?`
+	key := fmt.Sprintf("%s%020d", gcHistoryKeyPrefix, run.SafePoint)
+	value := run.StartTime.Format(gcTimeFormat)
+	if _, err := executeWithArgs(session, stmt, key, value, gcHistoryComment, value, gcHistoryComment); err != nil {
+		return errors.Trace(err)
+	}
+	runs, err := loadGCHistory(session, gcMaxHistory+1)
+	if err != nil || len(runs) <= gcMaxHistory {
+		return errors.Trace(err)
+	}
+	stmt = `DELETE FROM mysql.tidb WHERE variable_name LIKE ? AND variable_name <= ?`
+	oldest := fmt.Sprintf("%s%020d", gcHistoryKeyPrefix, runs[gcMaxHistory].SafePoint)
+	_, err = executeWithArgs(session, stmt, gcHistoryKeyPrefix+"%", oldest)
+	return errors.Trace(err)
+}
+
+// loadGCHistory loads at most limit GC runs, the latest first.
+func loadGCHistory(session tidb.Session, limit int) ([]GCRun, error) {
+	stmt := fmt.Sprintf(`SELECT variable_name, variable_value FROM mysql.tidb WHERE variable_name LIKE ? ORDER BY variable_name DESC LIMIT %d`, limit)
+	rs, err := executeWithArgs(session, stmt, gcHistoryKeyPrefix+"%")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rs.Close()
+	var runs []GCRun
+	for {
+		row, err := rs.Next()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if row == nil {
+			return runs, nil
+		}
+		safePoint, err := strconv.ParseUint(strings.TrimPrefix(row.Data[0].GetString(), gcHistoryKeyPrefix), 10, 64)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		startTime, err := time.Parse(gcTimeFormat, row.Data[1].GetString())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		runs = append(runs, GCRun{SafePoint: safePoint, StartTime: startTime})
+	}
+}
+
+// executeWithArgs executes stmt as a prepared statement, so the args are sent
+// as they are and don't need to be escaped.
+func executeWithArgs(session tidb.Session, stmt string, args ...interface{}) (ast.RecordSet, error) {
+	stmtID, _, _, err := session.PrepareStmt(stmt)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer session.DropPreparedStmt(stmtID)
+	rs, err := session.ExecutePreparedStmt(stmtID, args...)
+	return rs, errors.Trace(err)
+}
+
 // MockGCWorker is for test.
 type MockGCWorker struct {
 	worker GCWorker
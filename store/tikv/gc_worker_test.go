@@ -19,6 +19,7 @@ import (
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/tidb"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 )
 
 type testGCWorkerSuite struct {
@@ -49,6 +50,10 @@ func (s *testGCWorkerSuite) timeEqual(c *C, t1, t2 time.Time, epsilon time.Durat
 	c.Assert(math.Abs(float64(t1.Sub(t2))), Less, float64(epsilon))
 }
 
+func (s *testGCWorkerSuite) tsToTime(ts uint64) time.Time {
+	return time.Unix(0, oracle.ExtractPhysical(ts)*int64(time.Millisecond))
+}
+
 func (s *testGCWorkerSuite) TestGetOracleTime(c *C) {
 	t1, err := s.gcWorker.getOracleTime()
 	c.Assert(err, IsNil)
@@ -60,6 +65,36 @@ func (s *testGCWorkerSuite) TestGetOracleTime(c *C) {
 	s.timeEqual(c, t2, t1.Add(time.Second*10), time.Millisecond*10)
 }
 
+func (s *testGCWorkerSuite) TestRefreshSafePoint(c *C) {
+	safePoint, err := s.store.RefreshSafePoint()
+	c.Assert(err, IsNil)
+	c.Assert(safePoint, Equals, uint64(0))
+
+	err = s.gcWorker.saveUint64(gcSavedSafePoint, 100)
+	c.Assert(err, IsNil)
+	safePoint, err = s.store.RefreshSafePoint()
+	c.Assert(err, IsNil)
+	c.Assert(safePoint, Equals, uint64(100))
+	c.Assert(s.store.CheckVisibility(99), NotNil)
+	c.Assert(s.store.CheckVisibility(100), IsNil)
+}
+
+func (s *testGCWorkerSuite) TestSetSafePointForTest(c *C) {
+	c.Assert(s.store.SetSafePointForTest(100), IsNil)
+	c.Assert(s.store.CheckVisibility(99), NotNil)
+	c.Assert(s.store.CheckVisibility(100), IsNil)
+	session := createSession(s.store)
+	savedSafePoint, err := loadUint64(session, gcSavedSafePoint)
+	session.Close()
+	c.Assert(err, IsNil)
+	c.Assert(savedSafePoint, Equals, uint64(100))
+
+	s.store.mock = false
+	c.Assert(s.store.SetSafePointForTest(200), NotNil)
+	s.store.mock = true
+	c.Assert(s.store.CheckVisibility(100), IsNil)
+}
+
 func (s *testGCWorkerSuite) TestPrepareGC(c *C) {
 	now, err := s.gcWorker.getOracleTime()
 	c.Assert(err, IsNil)
@@ -72,6 +107,13 @@ func (s *testGCWorkerSuite) TestPrepareGC(c *C) {
 	safePoint, err := s.gcWorker.loadTime(gcSafePointKey)
 	c.Assert(err, IsNil)
 	s.timeEqual(c, safePoint.Add(gcDefaultLifeTime), now, 2*time.Second)
+	// The background loop of the worker may run prepare() concurrently, so the
+	// saved safepoint is compared with the time read back, not the returned one.
+	session := createSession(s.store)
+	savedSafePoint, err := loadUint64(session, gcSavedSafePoint)
+	session.Close()
+	c.Assert(err, IsNil)
+	s.timeEqual(c, s.tsToTime(savedSafePoint), *safePoint, 2*time.Second)
 
 	// Change GC run interval.
 	err = s.gcWorker.saveDuration(gcRunIntervalKey, time.Minute*5)
@@ -102,3 +144,146 @@ func (s *testGCWorkerSuite) TestPrepareGC(c *C) {
 	c.Assert(err, IsNil)
 	s.timeEqual(c, safePoint.Add(time.Minute*30), now, 2*time.Second)
 }
+
+func (s *testGCWorkerSuite) TestSysTableValueWithQuotes(c *C) {
+	values := []string{
+		`it's a 'quoted' value`,
+		`"double" and \'mixed\' quotes`,
+		`back\slash\`,
+		`'); DELETE FROM mysql.tidb; --`,
+	}
+	for _, value := range values {
+		err := s.gcWorker.saveValueToSysTable(gcLeaderDescKey, value)
+		c.Assert(err, IsNil)
+		loaded, err := s.gcWorker.loadValueFromSysTable(gcLeaderDescKey)
+		c.Assert(err, IsNil)
+		c.Assert(loaded, Equals, value)
+	}
+	// Other values in the sys table are kept.
+	ver, err := s.gcWorker.loadValueFromSysTable("bootstrapped")
+	c.Assert(err, IsNil)
+	c.Assert(ver, Equals, "True")
+}
+
+func (s *testGCWorkerSuite) TestInitLifeTime(c *C) {
+	session := createSession(s.store)
+	_, err := session.Execute(`DELETE FROM mysql.tidb WHERE variable_name = 'tikv_gc_life_time'`)
+	session.Close()
+	c.Assert(err, IsNil)
+
+	// Nothing is saved if the life time is not specified.
+	c.Assert(s.gcWorker.initLifeTime(), IsNil)
+	lifeTime, err := s.gcWorker.loadDuration(gcLifeTimeKey)
+	c.Assert(err, IsNil)
+	c.Assert(lifeTime, IsNil)
+
+	s.store.initialGCLifeTime = time.Hour
+	c.Assert(s.gcWorker.initLifeTime(), IsNil)
+	lifeTime, err = s.gcWorker.loadDuration(gcLifeTimeKey)
+	c.Assert(err, IsNil)
+	c.Assert(*lifeTime, Equals, time.Hour)
+
+	// The value in the sys table takes precedence.
+	c.Assert(s.gcWorker.saveDuration(gcLifeTimeKey, 20*time.Minute), IsNil)
+	c.Assert(s.gcWorker.initLifeTime(), IsNil)
+	lifeTime, err = s.gcWorker.loadDuration(gcLifeTimeKey)
+	c.Assert(err, IsNil)
+	c.Assert(*lifeTime, Equals, 20*time.Minute)
+}
+
+func (s *testGCWorkerSuite) TestGCHistory(c *C) {
+	// The GC worker of the suite may run concurrently, use a store with GC
+	// disabled and drive the worker by hand instead.
+	store := newTestStoreWithBootstrap(c)
+	defer store.Close()
+	o := &mockOracle{}
+	store.oracle = o
+	w := &GCWorker{store: store}
+
+	runs, err := store.GCHistory(10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 0)
+	_, err = store.GCHistory(0)
+	c.Assert(err, NotNil)
+
+	var expect []GCRun
+	for i := 0; i < 2; i++ {
+		ok, safePoint, err := w.prepare()
+		c.Assert(err, IsNil)
+		c.Assert(ok, IsTrue)
+		now, err := w.getOracleTime()
+		c.Assert(err, IsNil)
+		expect = append([]GCRun{{SafePoint: safePoint, StartTime: now}}, expect...)
+		o.addOffset(time.Minute * 20)
+	}
+	runs, err = store.GCHistory(10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 2)
+	for i, run := range runs {
+		c.Assert(run.SafePoint, Equals, expect[i].SafePoint)
+		s.timeEqual(c, run.StartTime, expect[i].StartTime, 2*time.Second)
+	}
+	runs, err = store.GCHistory(1)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 1)
+	c.Assert(runs[0].SafePoint, Equals, expect[0].SafePoint)
+
+	// Only the latest runs are kept.
+	session := createSession(store)
+	defer session.Close()
+	start := time.Now()
+	for i := 1; i <= gcMaxHistory+1; i++ {
+		run := GCRun{SafePoint: expect[0].SafePoint + uint64(i), StartTime: start.Add(time.Duration(i) * time.Minute)}
+		c.Assert(saveGCHistory(session, run), IsNil)
+	}
+	runs, err = store.GCHistory(gcMaxHistory * 2)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, gcMaxHistory)
+	c.Assert(runs[0].SafePoint, Equals, expect[0].SafePoint+gcMaxHistory+1)
+	c.Assert(runs[gcMaxHistory-1].SafePoint, Equals, expect[0].SafePoint+2)
+}
+
+func (s *testGCWorkerSuite) TestGCParams(c *C) {
+	safePoint, lifeTime, lastRun, err := s.store.GCParams()
+	c.Assert(err, IsNil)
+	c.Assert(safePoint, Equals, uint64(0))
+	c.Assert(lifeTime, Equals, time.Duration(0))
+	c.Assert(lastRun.IsZero(), IsTrue)
+
+	now := time.Now().Truncate(time.Second)
+	c.Assert(s.gcWorker.saveUint64(gcSavedSafePoint, 400), IsNil)
+	c.Assert(s.gcWorker.saveDuration(gcLifeTimeKey, 30*time.Minute), IsNil)
+	c.Assert(s.gcWorker.saveTime(gcLastRunTimeKey, now), IsNil)
+	safePoint, lifeTime, lastRun, err = s.store.GCParams()
+	c.Assert(err, IsNil)
+	c.Assert(safePoint, Equals, uint64(400))
+	c.Assert(lifeTime, Equals, 30*time.Minute)
+	c.Assert(lastRun.Equal(now), IsTrue)
+
+	c.Assert(s.gcWorker.saveValueToSysTable(gcLifeTimeKey, "invalid"), IsNil)
+	_, _, _, err = s.store.GCParams()
+	c.Assert(err, NotNil)
+}
+
+func (s *testGCWorkerSuite) TestGCStatus(c *C) {
+	safePoint, lastRun, running, err := s.store.GCStatus()
+	c.Assert(err, IsNil)
+	c.Assert(safePoint, Equals, uint64(0))
+	c.Assert(lastRun.IsZero(), IsTrue)
+	c.Assert(running, IsFalse)
+
+	close(s.gcWorker.done)
+	ok, newSafePoint, err := s.gcWorker.prepare()
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsTrue)
+	now, err := s.gcWorker.getOracleTime()
+	c.Assert(err, IsNil)
+	safePoint, lastRun, running, err = s.store.GCStatus()
+	c.Assert(err, IsNil)
+	// The background loop of the worker may run prepare() concurrently, so
+	// they are compared with a tolerance.
+	s.timeEqual(c, s.tsToTime(safePoint), s.tsToTime(newSafePoint), 2*time.Second)
+	s.timeEqual(c, lastRun, now, 2*time.Second)
+	// GC is disabled on the mock store.
+	c.Assert(running, IsFalse)
+}
@@ -14,18 +14,27 @@
 package tikv
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/juju/errors"
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/kvproto/pkg/metapb"
 	"github.com/pingcap/pd/pd-client"
+	"github.com/pingcap/tidb"
 	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/privilege"
 	"github.com/pingcap/tidb/store/tikv/mock-tikv"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/pingcap/tidb/store/tikv/oracle/oracles"
@@ -36,6 +45,8 @@ import (
 type storeCache struct {
 	sync.Mutex
 	cache map[string]*tikvStore
+	// closing records the uuids of the stores which are being closed.
+	closing map[string]struct{}
 }
 
 var mc storeCache
@@ -45,39 +56,204 @@ type Driver struct {
 }
 
 // Open opens or creates an TiKV storage with given path.
-// Path example: tikv://etcd-node1:port,etcd-node2:port?cluster=1&disableGC=false
+// Path example: tikv://etcd-node1:port,etcd-node2:port?cluster=1&disableGC=false&spStaleness=100s&spRefresh=5s&gcLifeTime=10m&disableSafePointUpdate=false&safePointFromPD=false&oracleUpdate=2s
+// Connecting PD with TLS isn't supported, the ca, cert and key params are rejected.
+// The gcLifeTime only sets the initial GC life time, it's ignored if the sys table already has one.
+// For deterministic testing, oracle=fixed&oracleBaseTS=ts makes the timestamps come from a FixedOracle.
+// The rate of the requests sent by SendReq can be limited by maxReqPerSec=5000, add rejectRateLimited=true to fail them instead of waiting.
 func (d Driver) Open(path string) (kv.Storage, error) {
+	return d.OpenWithContext(goctx.Background(), path)
+}
+
+// newPDClient creates the PD client for Driver, it's a variable so tests can replace it.
+var newPDClient = pd.NewClient
+
+// newStoreClient creates the TiKV client for Driver with connCount connections
+// to each store, it's a variable so tests can replace it.
+var newStoreClient = func(connCount uint32) Client {
+	return newRPCClient(connCount)
+}
+
+// connectPD creates a PD client, it returns ctx's error as soon as ctx is done.
+// The client created after that is closed in the background.
+func connectPD(ctx goctx.Context, etcdAddrs []string) (pd.Client, error) {
+	type result struct {
+		client pd.Client
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		client, err := newPDClient(etcdAddrs)
+		ch <- result{client, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.client, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.err == nil {
+				r.client.Close()
+			}
+		}()
+		return nil, errors.Trace(ctx.Err())
+	}
+}
+
+// OpenWithContext opens or reuses a TiKV storage with given path like Open,
+// connecting PD is aborted when ctx is done.
+func (d Driver) OpenWithContext(ctx goctx.Context, path string) (kv.Storage, error) {
 	mc.Lock()
 	defer mc.Unlock()
 
-	etcdAddrs, disableGC, err := parsePath(path)
+	etcdAddrs, opts, err := parsePath(path)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	pdCli, err := pd.NewClient(etcdAddrs)
+	pdCli, err := connectPD(ctx, etcdAddrs)
 	if err != nil {
-		if strings.Contains(err.Error(), "i/o timeout") {
+		if IsRetryableError(err) {
 			return nil, errors.Annotate(err, txnRetryableMark)
 		}
 		return nil, errors.Trace(err)
 	}
 
-	// FIXME: uuid will be a very long and ugly string, simplify it.
-	uuid := fmt.Sprintf("tikv-%v", pdCli.GetClusterID(goctx.TODO()))
+	uuid := storeUUID(opts.storeName, pdCli.GetClusterID(ctx))
+	if err := ctx.Err(); err != nil {
+		pdCli.Close()
+		return nil, errors.Trace(err)
+	}
 	if store, ok := mc.cache[uuid]; ok {
-		return store, nil
+		if !store.closed {
+			return store, nil
+		}
+		log.Warnf("[kv] cached store %s is closed, create a new one", uuid)
+		delete(mc.cache, uuid)
+	}
+	if _, ok := mc.closing[uuid]; ok {
+		pdCli.Close()
+		return nil, errors.Trace(ErrStoreClosing)
 	}
 
-	s, err := newTikvStore(uuid, &codecPDClient{pdCli}, newRPCClient(), !disableGC)
+	var o oracle.Oracle
+	if opts.fixedOracle {
+		o = oracles.NewFixedOracle(opts.oracleBaseTS)
+	}
+	var reconnect *reconnectPDClient
+	pdClient := pd.Client(&codecPDClient{pdCli})
+	if opts.pdReconnectAfter > 0 {
+		reconnect = newReconnectPDClient(pdClient, connectPDFunc(etcdAddrs))
+		pdClient = reconnect
+	}
+	s, err := newTikvStore(uuid, pdClient, newStoreClient(uint32(opts.grpcConnCount)), !opts.disableGC, opts.oracleUpdateInterval, o)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 	s.etcdAddrs = etcdAddrs
+	s.pdReconnect, s.pdReconnectAfter = reconnect, int32(opts.pdReconnectAfter)
+	if opts.maxSafePointStaleness > 0 {
+		s.maxSafePointStaleness = opts.maxSafePointStaleness
+	}
+	if opts.safePointRefreshInterval > 0 {
+		s.safePointRefreshInterval = opts.safePointRefreshInterval
+	}
+	s.initialGCLifeTime = opts.gcLifeTime
+	s.disableSafePointUpdate = opts.disableSafePointUpdate
+	s.safePointFromPD = opts.safePointFromPD
+	s.maxBackoff = opts.maxBackoff
+	if opts.trackTxns {
+		s.enableTxnTracking()
+	}
+	if opts.allowFallbackOracle {
+		s.fallbackOracle = oracles.NewLocalOracle()
+	}
+	s.slowRequestThreshold = opts.slowRequestThreshold
+	if opts.maxReqPerSec > 0 {
+		s.reqLimiter = newRateLimiter(opts.maxReqPerSec, opts.rejectRateLimited)
+	}
 	mc.cache[uuid] = s
 	return s, nil
 }
 
+type storeOptions struct {
+	client               Client
+	enableGC             bool
+	oracleUpdateInterval time.Duration
+}
+
+// StoreOption is used to control the store created by NewTikvStoreWithPDClient.
+type StoreOption func(*storeOptions)
+
+// WithStoreClient makes the store send the requests to TiKV by client instead
+// of creating one, the store closes it on Close.
+func WithStoreClient(client Client) StoreOption {
+	return func(o *storeOptions) {
+		o.client = client
+	}
+}
+
+// WithGC enables the GC worker of the store.
+func WithGC() StoreOption {
+	return func(o *storeOptions) {
+		o.enableGC = true
+	}
+}
+
+// WithStoreOracleUpdateInterval changes the interval to update the oracle's lastTS.
+func WithStoreOracleUpdateInterval(d time.Duration) StoreOption {
+	return func(o *storeOptions) {
+		o.oracleUpdateInterval = d
+	}
+}
+
+// NewTikvStoreWithPDClient creates a TiKV store with the PD client held by the
+// caller, so the process doesn't connect PD twice. Close of the store doesn't
+// close pdCli, the caller should close it after the store. Unlike Driver.Open,
+// the store isn't cached by uuid.
+func NewTikvStoreWithPDClient(uuid string, pdCli pd.Client, options ...StoreOption) (kv.Storage, error) {
+	var opts storeOptions
+	for _, f := range options {
+		f(&opts)
+	}
+	client := opts.client
+	if client == nil {
+		client = newStoreClient(0)
+	}
+	s, err := newTikvStore(uuid, &codecPDClient{pdCli}, client, opts.enableGC, opts.oracleUpdateInterval, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s.ownsPDClient = false
+	return s, nil
+}
+
+// connectPDFunc returns the function to create the PD client of etcdAddrs used
+// by reconnectPDClient.
+func connectPDFunc(etcdAddrs []string) func() (pd.Client, error) {
+	return func() (pd.Client, error) {
+		pdCli, err := newPDClient(etcdAddrs)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return &codecPDClient{pdCli}, nil
+	}
+}
+
+// storeUUID returns the uuid of the store of the cluster, it's the key of the
+// store in mc.cache. It's name if given, unless name is used by the store of
+// another cluster, then it falls back to the one derived from clusterID.
+// It should be called with mc locked.
+func storeUUID(name string, clusterID uint64) string {
+	if name != "" {
+		s, ok := mc.cache[name]
+		if !ok || s.clusterID == clusterID {
+			return name
+		}
+		log.Warnf("[kv] store name %s is used by cluster %d, use the cluster ID of cluster %d instead", name, s.clusterID, clusterID)
+	}
+	return fmt.Sprintf("tikv-%v", clusterID)
+}
+
 // MockDriver is in memory mock TiKV driver.
 type MockDriver struct {
 }
@@ -94,8 +270,18 @@ func (d MockDriver) Open(path string) (kv.Storage, error) {
 	return NewMockTikvStore(WithPath(u.Path))
 }
 
-// update oracle's lastTS every 2000ms.
-var oracleUpdateInterval = 2000
+// defaultOracleUpdateInterval is the default interval to update oracle's lastTS.
+var defaultOracleUpdateInterval = 2000 * time.Millisecond
+
+const (
+	// defaultMaxSafePointStaleness is the default max age of the cached safepoint,
+	// reads are rejected if the safepoint has not been refreshed for longer.
+	defaultMaxSafePointStaleness = 100 * time.Second
+	// defaultSafePointRefreshInterval is the default interval to reload the safepoint from the sys table.
+	defaultSafePointRefreshInterval = 5 * time.Second
+	// loadSafePointTimeout is the timeout to load the safepoint from PD.
+	loadSafePointTimeout = 5 * time.Second
+)
 
 type tikvStore struct {
 	clusterID    uint64
@@ -109,12 +295,124 @@ type tikvStore struct {
 	etcdAddrs    []string
 	mock         bool
 	enableGC     bool
+	// mockCluster is the cluster of the mock store, it's nil for a real store.
+	mockCluster *mocktikv.Cluster
+	// ownsPDClient is set if pdClient is created for the store, then Close closes it.
+	ownsPDClient bool
+	// closed is set by Close, it's protected by mc.
+	closed bool
+
+	safePoint             uint64
+	spTime                time.Time
+	spMutex               sync.RWMutex   // this is used to update safePoint and spTime
+	spMsg                 chan struct{}  // this is used to notify the safepoint updater to quit
+	spWg                  sync.WaitGroup // this is used to wait for the safepoint updater to quit
+	spReady               chan struct{}  // this is closed once the safepoint is loaded
+	spReadyOnce           sync.Once      // this is used to close spReady
+	maxSafePointStaleness time.Duration
+	// safePointRefreshInterval is the interval to reload the safepoint.
+	safePointRefreshInterval time.Duration
+	// disableSafePointUpdate skips starting the safepoint updater, then
+	// CheckVisibility treats every startTS as visible.
+	disableSafePointUpdate bool
+	// safePointFromPD makes the safepoint updater load the safepoint from PD
+	// instead of the sys table, if PD supports it.
+	safePointFromPD bool
+	// supportDeleteRange indicates whether the store handles the DeleteRange request.
+	supportDeleteRange bool
+	// maxBackoff caps the max total sleep time in ms of the backoffers created
+	// by newBackoffer, 0 means no cap. The GC worker isn't affected.
+	maxBackoff int
+	// fallbackOracle is used to get the timestamp once PD fails to give one,
+	// nil means no fallback. The txns started with it are not linearizable.
+	fallbackOracle oracle.Oracle
+	// slowRequestThreshold is the duration beyond which SendReq logs the request
+	// as slow, 0 means no logging.
+	slowRequestThreshold time.Duration
+	// reqLimiter limits the rate of the requests sent by SendReq, nil means unlimited.
+	reqLimiter *rateLimiter
+	// initialGCLifeTime is the GC life time specified in the path, the GC worker
+	// saves it to the sys table if the sys table has none.
+	initialGCLifeTime time.Duration
+	// retryPolicy creates the RetryPolicy of the backoffers created by
+	// newBackoffer, nil means the default one.
+	retryPolicy func() RetryPolicy
+	// pdReconnect wraps the PD client, it's replaced by a new one after
+	// pdReconnectAfter consecutive TSO failures. It's nil if the reconnection
+	// is disabled.
+	pdReconnect      *reconnectPDClient
+	pdReconnectAfter int32
+	// tsoFailures counts the consecutive TSO failures, it's changed atomically.
+	tsoFailures int32
+
+	reqObserverMu sync.RWMutex // this is used to set and get reqObserver
+	reqObserver   func(req *tikvrpc.Request, resp *tikvrpc.Response, elapsed time.Duration, err error)
+
+	// txns tracks the live txns, it's nil unless the tracking is enabled when the store is created.
+	txnsMu sync.Mutex // this is used to update txns
+	txns   map[*tikvTxn]TxnInfo
 }
 
-func newTikvStore(uuid string, pdClient pd.Client, client Client, enableGC bool) (*tikvStore, error) {
-	o, err := oracles.NewPdOracle(pdClient, time.Duration(oracleUpdateInterval)*time.Millisecond)
-	if err != nil {
-		return nil, errors.Trace(err)
+// TxnInfo is the information of a live transaction.
+type TxnInfo struct {
+	StartTS   uint64
+	BeginTime time.Time
+}
+
+// enableTxnTracking makes the store track the live txns, it should be called
+// before the store is used.
+func (s *tikvStore) enableTxnTracking() {
+	s.txns = make(map[*tikvTxn]TxnInfo)
+}
+
+func (s *tikvStore) trackTxn(txn *tikvTxn) {
+	if s.txns == nil {
+		return
+	}
+	s.txnsMu.Lock()
+	s.txns[txn] = TxnInfo{StartTS: txn.startTS, BeginTime: time.Now()}
+	s.txnsMu.Unlock()
+}
+
+func (s *tikvStore) untrackTxn(txn *tikvTxn) {
+	if s.txns == nil {
+		return
+	}
+	s.txnsMu.Lock()
+	delete(s.txns, txn)
+	s.txnsMu.Unlock()
+}
+
+// ActiveTransactions returns the txns which are begun but not committed or
+// rolled back yet, ordered by startTS. It returns nil if the tracking is not
+// enabled by the trackTxns param or WithTxnTracking.
+func (s *tikvStore) ActiveTransactions() []TxnInfo {
+	if s.txns == nil {
+		return nil
+	}
+	s.txnsMu.Lock()
+	infos := make([]TxnInfo, 0, len(s.txns))
+	for _, info := range s.txns {
+		infos = append(infos, info)
+	}
+	s.txnsMu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartTS < infos[j].StartTS })
+	return infos
+}
+
+// newTikvStore creates a tikvStore with the oracle o, or the PD oracle if o is
+// nil. The PD oracle's lastTS is updated every oracleUpdateInterval, or
+// defaultOracleUpdateInterval if it's 0.
+func newTikvStore(uuid string, pdClient pd.Client, client Client, enableGC bool, oracleUpdateInterval time.Duration, o oracle.Oracle) (*tikvStore, error) {
+	if oracleUpdateInterval <= 0 {
+		oracleUpdateInterval = defaultOracleUpdateInterval
+	}
+	if o == nil {
+		var err error
+		o, err = oracles.NewPdOracle(pdClient, oracleUpdateInterval)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
 	}
 	_, mock := client.(*mocktikv.RPCClient)
 	store := &tikvStore{
@@ -125,9 +423,16 @@ func newTikvStore(uuid string, pdClient pd.Client, client Client, enableGC bool)
 		pdClient:    pdClient,
 		regionCache: NewRegionCache(pdClient),
 		mock:        mock,
+		spMsg:       make(chan struct{}),
+		spReady:     make(chan struct{}),
+
+		maxSafePointStaleness:    defaultMaxSafePointStaleness,
+		safePointRefreshInterval: defaultSafePointRefreshInterval,
 	}
 	store.lockResolver = newLockResolver(store)
 	store.enableGC = enableGC
+	store.supportDeleteRange = !mock
+	store.ownsPDClient = true
 	return store, nil
 }
 
@@ -137,6 +442,17 @@ func (s *tikvStore) EtcdAddrs() []string {
 
 // StartGCWorker starts GC worker, it's called in BootstrapSession, don't call this function more than once.
 func (s *tikvStore) StartGCWorker() error {
+	if !s.disableSafePointUpdate {
+		s.spMutex.Lock()
+		s.spTime = time.Now()
+		s.spMutex.Unlock()
+		s.spWg.Add(1)
+		go func() {
+			defer s.spWg.Done()
+			s.runSafePointUpdater()
+		}()
+	}
+
 	if !s.enableGC {
 		return nil
 	}
@@ -149,30 +465,424 @@ func (s *tikvStore) StartGCWorker() error {
 	return nil
 }
 
+// runSafePointUpdater reloads the safepoint saved by the GC leader periodically,
+// so CheckVisibility can tell whether a read is safe without querying the sys table.
+func (s *tikvStore) runSafePointUpdater() {
+	load, release := s.prepareSafePointLoad()
+	if load == nil {
+		return
+	}
+	defer release()
+	log.Infof("[safepoint] start safepoint updater, refresh interval %v", s.safePointRefreshInterval)
+
+	for {
+		safePoint, err := load()
+		if err != nil {
+			gcSafePointLoadCounter.WithLabelValues("error").Inc()
+			log.Warnf("[safepoint] load safepoint err: %v", err)
+		} else {
+			s.updateSafePoint(safePoint)
+		}
+
+		select {
+		case <-s.spMsg:
+			log.Info("[safepoint] safepoint updater exits")
+			return
+		case <-time.After(s.safePointRefreshInterval):
+		}
+	}
+}
+
+// updateSafePoint caches the loaded safepoint and resets its staleness.
+func (s *tikvStore) updateSafePoint(safePoint uint64) {
+	gcSafePointLoadCounter.WithLabelValues("ok").Inc()
+	gcSafePointGauge.Set(float64(safePoint))
+	log.Debugf("[safepoint] load safepoint %d", safePoint)
+	s.spMutex.Lock()
+	s.safePoint, s.spTime = safePoint, time.Now()
+	s.spMutex.Unlock()
+	s.spReadyOnce.Do(func() { close(s.spReady) })
+}
+
+// WaitBootstrap blocks until the safepoint is loaded for the first time, so
+// the stale reads are checked against it. It returns immediately if the
+// safepoint updating is disabled, or an error if ctx is done or the store is
+// closed before that.
+func (s *tikvStore) WaitBootstrap(ctx goctx.Context) error {
+	if s.disableSafePointUpdate {
+		return nil
+	}
+	select {
+	case <-s.spReady:
+		return nil
+	case <-s.spMsg:
+		return errors.Trace(ErrStoreClosing)
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+}
+
+// RefreshSafePoint loads the safepoint and updates the cached one immediately,
+// instead of waiting for the safepoint updater. It returns the loaded safepoint.
+// It's safe to call it concurrently with the safepoint updater.
+func (s *tikvStore) RefreshSafePoint() (uint64, error) {
+	var safePoint uint64
+	var err error
+	if s.safePointFromPD {
+		safePoint, err = s.loadSafePointFromPD()
+	}
+	if !s.safePointFromPD || errors.Cause(err) == errSafePointNotSupported {
+		session := createSession(s)
+		safePoint, err = loadUint64(session, gcSavedSafePoint)
+		session.Close()
+	}
+	if err != nil {
+		gcSafePointLoadCounter.WithLabelValues("error").Inc()
+		return 0, errors.Trace(err)
+	}
+	s.updateSafePoint(safePoint)
+	return safePoint, nil
+}
+
+// SetSafePointForTest saves ts as the safepoint to the sys table like the GC
+// worker, and refreshes the cached one before returning, so tests don't have to
+// wait for the safepoint updater. It's only supported by the mock store.
+func (s *tikvStore) SetSafePointForTest(ts uint64) error {
+	if !s.mock {
+		return errors.New("SetSafePointForTest is only supported by the mock store")
+	}
+	session := createSession(s)
+	err := saveValueToSysTable(session, gcSavedSafePoint, strconv.FormatUint(ts, 10))
+	session.Close()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	safePoint, err := s.RefreshSafePoint()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if safePoint != ts {
+		// The safepoint is loaded from PD.
+		return errors.Errorf("the refreshed safepoint %d isn't the saved one %d", safePoint, ts)
+	}
+	return nil
+}
+
+// prepareSafePointLoad returns the function to load the safepoint and the
+// function to release its resources. If safePointFromPD is set and PD supports
+// it, the safepoint is loaded from PD, otherwise it's loaded from the sys table
+// by a session. It returns nil if the store is closed in the meantime.
+func (s *tikvStore) prepareSafePointLoad() (load func() (uint64, error), release func()) {
+	if s.safePointFromPD {
+		load = s.loadSafePointFromPD
+		if _, err := load(); errors.Cause(err) != errSafePointNotSupported {
+			return load, func() {}
+		}
+		log.Warn("[safepoint] pd doesn't support loading safepoint, fall back to the sys table")
+	}
+
+	session := s.createSPSession()
+	if session == nil {
+		return nil, nil
+	}
+	load = func() (uint64, error) {
+		return loadUint64(session, gcSavedSafePoint)
+	}
+	return load, session.Close
+}
+
+func (s *tikvStore) loadSafePointFromPD() (uint64, error) {
+	loader, ok := s.pdClient.(safePointLoader)
+	if !ok {
+		return 0, errSafePointNotSupported
+	}
+	ctx, cancel := goctx.WithTimeout(goctx.Background(), loadSafePointTimeout)
+	defer cancel()
+	safePoint, err := loader.GetGCSafePoint(ctx)
+	return safePoint, errors.Trace(err)
+}
+
+// createSPSession creates the session used to load the safepoint. It retries
+// until success, returns nil if the store is closed in the meantime.
+func (s *tikvStore) createSPSession() tidb.Session {
+	for {
+		session, err := tidb.CreateSession(s)
+		if err == nil {
+			privilege.BindPrivilegeManager(session, nil)
+			session.GetSessionVars().InRestrictedSQL = true
+			return session
+		}
+		log.Warnf("[safepoint] create session err: %v", err)
+		select {
+		case <-s.spMsg:
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// CheckVisibility checks if it is safe to read using startTS. It returns an
+// error if the data of startTS may have been collected by GC. The safepoint is
+// the tikv_gc_saved_safe_point saved by the GC leader, it's cached by the
+// safepoint updater of the store. If the cache isn't refreshed within
+// maxSafePointStaleness, e.g. the sys table can't be read, the safepoint of the
+// cluster is unknown, so the reads fail rather than risk reading the collected
+// data. All the snapshot reads, Get, BatchGet, the scanners and the coprocessor
+// requests with StartTs, are checked.
+func (s *tikvStore) CheckVisibility(startTS uint64) error {
+	safePoint, age, ok := s.CheckVisibilityDetailed()
+	if !ok {
+		return errors.Errorf("start timestamp may fall behind safepoint, the safepoint is not updated for %v", age)
+	}
+	if startTS < safePoint {
+		return errors.Annotatef(ErrStartTSBelowSafePoint, "start timestamp %d, safepoint %d", startTS, safePoint)
+	}
+	return nil
+}
+
+// CheckVisibilityDetailed returns the cached safepoint and the time since it's
+// updated, ok is false if the age exceeds the max staleness, then the safepoint
+// can't be trusted. If the safepoint updater is not started, it returns 0, 0 and true.
+func (s *tikvStore) CheckVisibilityDetailed() (safePoint uint64, age time.Duration, ok bool) {
+	s.spMutex.RLock()
+	safePoint = s.safePoint
+	cachedTime := s.spTime
+	s.spMutex.RUnlock()
+
+	// The safepoint updater is not started, nothing to check.
+	if cachedTime.IsZero() {
+		return 0, 0, true
+	}
+	age = time.Since(cachedTime)
+	return safePoint, age, age <= s.maxSafePointStaleness
+}
+
+// GCStatus returns the safepoint and the start time of the last GC persisted
+// in the sys table, and whether the GC worker is running on this store. It works
+// even if GC is disabled on this store, the persisted values are still returned.
+func (s *tikvStore) GCStatus() (lastSafePoint uint64, lastRun time.Time, running bool, err error) {
+	session := createSession(s)
+	defer session.Close()
+
+	lastSafePoint, err = loadUint64(session, gcSavedSafePoint)
+	if err != nil {
+		return 0, time.Time{}, false, errors.Trace(err)
+	}
+	str, err := loadValueFromSysTable(session, gcLastRunTimeKey)
+	if err != nil {
+		return 0, time.Time{}, false, errors.Trace(err)
+	}
+	if str != "" {
+		lastRun, err = time.Parse(gcTimeFormat, str)
+		if err != nil {
+			return 0, time.Time{}, false, errors.Trace(err)
+		}
+	}
+	return lastSafePoint, lastRun, s.gcWorker != nil, nil
+}
+
+// GCParams returns the safepoint in TSO format, the GC life time and the start
+// time of the last GC persisted in the sys table. They're read in a single
+// statement, so they're consistent even if a GC is updating them. The absent
+// ones are returned as zero values.
+func (s *tikvStore) GCParams() (safePoint uint64, lifeTime time.Duration, lastRun time.Time, err error) {
+	session := createSession(s)
+	defer session.Close()
+
+	stmt := `SELECT variable_name, variable_value FROM mysql.tidb WHERE variable_name IN (?, ?, ?)`
+	rs, err := executeWithArgs(session, stmt, gcSavedSafePoint, gcLifeTimeKey, gcLastRunTimeKey)
+	if err != nil {
+		return 0, 0, time.Time{}, errors.Trace(err)
+	}
+	defer rs.Close()
+	for {
+		row, err := rs.Next()
+		if err != nil {
+			return 0, 0, time.Time{}, errors.Trace(err)
+		}
+		if row == nil {
+			return safePoint, lifeTime, lastRun, nil
+		}
+		value := row.Data[1].GetString()
+		switch row.Data[0].GetString() {
+		case gcSavedSafePoint:
+			safePoint, err = strconv.ParseUint(value, 10, 64)
+		case gcLifeTimeKey:
+			lifeTime, err = time.ParseDuration(value)
+		case gcLastRunTimeKey:
+			lastRun, err = time.Parse(gcTimeFormat, value)
+		}
+		if err != nil {
+			return 0, 0, time.Time{}, errors.Trace(err)
+		}
+	}
+}
+
+// GCHistory returns at most limit GC runs recorded in the sys table, the latest
+// first, the sys table keeps the latest 100 runs. It only reads the sys table,
+// so it works even if GC is disabled on this store. It returns nil if no GC
+// has run.
+func (s *tikvStore) GCHistory(limit int) ([]GCRun, error) {
+	if limit <= 0 {
+		return nil, errors.Errorf("limit should be positive, got %d", limit)
+	}
+	session := createSession(s)
+	defer session.Close()
+	runs, err := loadGCHistory(session, limit)
+	return runs, errors.Trace(err)
+}
+
+// StoreInfo is the summary of the store and its cluster returned by Describe.
+type StoreInfo struct {
+	ClusterID uint64
+	UUID      string
+	PDAddrs   []string
+	Mock      bool
+	// StoreCount and RegionCount are the numbers of the TiKV stores and the
+	// regions. For a real store they're counted in the region cache, since PD
+	// client can't list them, so they only cover the ones accessed so far.
+	StoreCount  int
+	RegionCount int
+	// SafePoint is the cached GC safepoint, it's 0 if it's never loaded.
+	SafePoint uint64
+	GCEnabled bool
+}
+
+// Describe returns the summary of the store, it's read-only and doesn't send
+// any request to PD or TiKV. For the mock store, PDAddrs is empty and the
+// counts come from the mock cluster.
+func (s *tikvStore) Describe(ctx goctx.Context) (*StoreInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	info := &StoreInfo{
+		ClusterID: s.clusterID,
+		UUID:      s.uuid,
+		PDAddrs:   append([]string(nil), s.etcdAddrs...),
+		Mock:      s.mock,
+		GCEnabled: s.enableGC,
+	}
+	if s.mockCluster != nil {
+		info.StoreCount = len(s.mockCluster.GetAllStores())
+		info.RegionCount = len(s.mockCluster.GetAllRegions())
+	} else {
+		info.RegionCount, info.StoreCount = s.regionCache.cachedCount()
+	}
+	s.spMutex.RLock()
+	info.SafePoint = s.safePoint
+	s.spMutex.RUnlock()
+	return info, nil
+}
+
+// ClusterID returns the ID of the cluster, it's 1 for the mock store.
+func (s *tikvStore) ClusterID() uint64 {
+	return s.clusterID
+}
+
+// mockPDLeaderAddr is the leader address returned by PDLeaderAddr for the mock store.
+const mockPDLeaderAddr = "mock-pd"
+
+// PDLeaderAddr returns the client URL of the current PD leader, without the
+// scheme like the PD addresses in the path. The pd client doesn't expose the
+// leader, so it's queried by PD's HTTP API, the PD addresses are tried in turn.
+func (s *tikvStore) PDLeaderAddr(ctx goctx.Context) (string, error) {
+	if s.mock {
+		return mockPDLeaderAddr, nil
+	}
+	var lastErr error
+	for _, addr := range s.etcdAddrs {
+		leader, err := getPDLeaderAddr(ctx, addr)
+		if err == nil {
+			return leader, nil
+		}
+		if ctx.Err() != nil {
+			return "", errors.Trace(ctx.Err())
+		}
+		log.Warnf("[kv] get PD leader from %s failed: %v", addr, err)
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no PD address")
+	}
+	return "", errors.Trace(lastErr)
+}
+
+func getPDLeaderAddr(ctx goctx.Context, addr string) (string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/pd/api/v1/leader", addr), nil)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected status %s", resp.Status)
+	}
+	var leader struct {
+		ClientURLs []string `json:"client_urls"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&leader); err != nil {
+		return "", errors.Trace(err)
+	}
+	if len(leader.ClientURLs) == 0 {
+		return "", errors.New("PD has no leader")
+	}
+	u, err := url.Parse(leader.ClientURLs[0])
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return u.Host, nil
+}
+
 type mockOptions struct {
-	cluster        *mocktikv.Cluster
-	mvccStore      mocktikv.MVCCStore
-	clientHijack   func(Client) Client
-	pdClientHijack func(pd.Client) pd.Client
-	path           string
+	cluster         *mocktikv.Cluster
+	mvccStore       mocktikv.MVCCStore
+	clientHijacks   []func(Client) Client
+	pdClientHijacks []func(pd.Client) pd.Client
+	path            string
+	spStaleness     time.Duration
+	spRefresh       time.Duration
+	disableSPUpdate bool
+	spFromPD        bool
+	oracleUpdate    time.Duration
+	deleteRange     bool
+	maxBackoff      int
+	storeCount      int
+	splitKeys       [][]byte
+	trackTxns       bool
+	fallbackOracle  oracle.Oracle
+	regionCache     *RegionCache
+	slowReqLog      time.Duration
+	maxReqPerSec    int
+	rejectLimited   bool
+	// gcedVersions is passed to the mock MVCC store, see WithGCedVersions.
+	gcedVersions map[string]uint64
+	// retryPolicy is the RetryPolicy factory of the store.
+	retryPolicy func() RetryPolicy
+	// pdReconnectAfter enables reconnecting PD, see WithPDReconnect.
+	pdReconnectAfter int
 }
 
 // MockTiKVStoreOption is used to control some behavior of mock tikv.
 type MockTiKVStoreOption func(*mockOptions)
 
 // WithHijackClient hijacks KV client's behavior, makes it easy to simulate the network
-// problem between TiDB and TiKV.
+// problem between TiDB and TiKV. It can be used more than once, the wrappers are
+// applied in order, so the last one is the outermost.
 func WithHijackClient(wrap func(Client) Client) MockTiKVStoreOption {
 	return func(c *mockOptions) {
-		c.clientHijack = wrap
+		c.clientHijacks = append(c.clientHijacks, wrap)
 	}
 }
 
 // WithHijackPDClient hijacks PD client's behavior, makes it easy to simulate the network
 // problem between TiDB and PD, such as GetTS too slow, GetStore or GetRegion fail.
+// Like WithHijackClient, the wrappers are applied in order.
 func WithHijackPDClient(wrap func(pd.Client) pd.Client) MockTiKVStoreOption {
 	return func(c *mockOptions) {
-		c.pdClientHijack = wrap
+		c.pdClientHijacks = append(c.pdClientHijacks, wrap)
 	}
 }
 
@@ -197,6 +907,139 @@ func WithPath(path string) MockTiKVStoreOption {
 	}
 }
 
+// WithSafePointStaleness sets the max age of the cached safepoint before reads are rejected.
+func WithSafePointStaleness(d time.Duration) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.spStaleness = d
+	}
+}
+
+// WithSafePointRefreshInterval sets the interval to reload the safepoint.
+func WithSafePointRefreshInterval(d time.Duration) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.spRefresh = d
+	}
+}
+
+// WithoutSafePointUpdate prevents the store from starting the safepoint updater.
+func WithoutSafePointUpdate() MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.disableSPUpdate = true
+	}
+}
+
+// WithPDSafePoint makes the store load the safepoint from the mock PD instead of the sys table.
+func WithPDSafePoint() MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.spFromPD = true
+	}
+}
+
+// WithOracleUpdateInterval sets the interval to update oracle's lastTS.
+func WithOracleUpdateInterval(d time.Duration) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.oracleUpdate = d
+	}
+}
+
+// WithMaxBackoff caps the max total sleep time in ms of the retries of the store.
+func WithMaxBackoff(ms int) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.maxBackoff = ms
+	}
+}
+
+// WithStoreCount makes the mock cluster bootstrapped with n stores, every region
+// has a peer on each store. It's ignored if the cluster is set by WithCluster.
+func WithStoreCount(n int) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.storeCount = n
+	}
+}
+
+// WithRegionSplit makes the mock cluster bootstrapped with the regions split at
+// the sorted keys. It's ignored if the cluster is set by WithCluster.
+func WithRegionSplit(keys [][]byte) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.splitKeys = keys
+	}
+}
+
+// WithTxnTracking makes the store track the live txns for ActiveTransactions.
+func WithTxnTracking() MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.trackTxns = true
+	}
+}
+
+// WithFallbackOracle makes the store get the timestamp from o once PD fails
+// to give one, the txns started with it are read-only and not linearizable.
+func WithFallbackOracle(o oracle.Oracle) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.fallbackOracle = o
+	}
+}
+
+// WithRegionCache makes the store use the given region cache instead of
+// creating one, it should be created on the PD client of the same cluster.
+func WithRegionCache(cache *RegionCache) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.regionCache = cache
+	}
+}
+
+// WithMaxRequestRate limits the rate of the requests sent by SendReq to perSec,
+// the requests beyond it wait or fail with ErrRateLimited if reject is set.
+func WithMaxRequestRate(perSec int, reject bool) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.maxReqPerSec = perSec
+		c.rejectLimited = reject
+	}
+}
+
+// WithSlowRequestLog makes the store log the requests sent by SendReq which take
+// longer than threshold.
+func WithSlowRequestLog(threshold time.Duration) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.slowReqLog = threshold
+	}
+}
+
+// WithDeleteRangeSupport sets whether the store supports the DeleteRange request,
+// it's not supported by default.
+func WithDeleteRangeSupport(supported bool) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.deleteRange = supported
+	}
+}
+
+// WithGCedVersions makes the mock MVCC store treat the versions of the keys
+// older than the timestamps in versions as GC'd, reading the keys before the
+// timestamps returns an error. The keys are the raw keys, and the MVCC store
+// should support it like the default one.
+func WithGCedVersions(versions map[string]uint64) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.gcedVersions = versions
+	}
+}
+
+// WithRetryPolicy makes the retries of the store use the RetryPolicy created by
+// newPolicy, a new one is created for each backoffer.
+func WithRetryPolicy(newPolicy func() RetryPolicy) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.retryPolicy = newPolicy
+	}
+}
+
+// WithPDReconnect makes the store replace the PD client by a new one after n
+// consecutive TSO failures. The new client is a mock PD client of the cluster,
+// wrapped by the hijackers like the initial one.
+func WithPDReconnect(n int) MockTiKVStoreOption {
+	return func(c *mockOptions) {
+		c.pdReconnectAfter = n
+	}
+}
+
 // NewMockTikvStore creates a mocked tikv store, the path is the file path to store the data.
 // If path is an empty string, a memory storage will be created.
 func NewMockTikvStore(options ...MockTiKVStoreOption) (kv.Storage, error) {
@@ -208,7 +1051,15 @@ func NewMockTikvStore(options ...MockTiKVStoreOption) (kv.Storage, error) {
 	cluster := opt.cluster
 	if cluster == nil {
 		cluster = mocktikv.NewCluster()
-		mocktikv.BootstrapWithSingleStore(cluster)
+		if opt.storeCount > 1 || len(opt.splitKeys) > 0 {
+			storeCount := opt.storeCount
+			if storeCount < 1 {
+				storeCount = 1
+			}
+			mocktikv.BootstrapWithMultiStoresAndRegions(cluster, storeCount, opt.splitKeys...)
+		} else {
+			mocktikv.BootstrapWithSingleStore(cluster)
+		}
 	}
 
 	mvccStore := opt.mvccStore
@@ -220,21 +1071,67 @@ func NewMockTikvStore(options ...MockTiKVStoreOption) (kv.Storage, error) {
 			return nil, errors.Trace(err)
 		}
 	}
+	if opt.gcedVersions != nil {
+		setter, ok := mvccStore.(interface {
+			SetGCedVersions(map[string]uint64)
+		})
+		if !ok {
+			return nil, errors.New("mvcc store doesn't support GC'd versions")
+		}
+		setter.SetGCedVersions(opt.gcedVersions)
+	}
 
 	client := Client(mocktikv.NewRPCClient(cluster, mvccStore))
-	if opt.clientHijack != nil {
-		client = opt.clientHijack(client)
+	for _, wrap := range opt.clientHijacks {
+		client = wrap(client)
 	}
 
 	// Make sure the uuid is unique.
 	partID := fmt.Sprintf("%05d", rand.Intn(100000))
 	uuid := fmt.Sprintf("mock-tikv-store-%v-%v", time.Now().Unix(), partID)
-	pdCli := pd.Client(&codecPDClient{mocktikv.NewPDClient(cluster)})
-	if opt.pdClientHijack != nil {
-		pdCli = opt.pdClientHijack(pdCli)
+	connect := func() (pd.Client, error) {
+		pdCli := pd.Client(&codecPDClient{mocktikv.NewPDClient(cluster)})
+		for _, wrap := range opt.pdClientHijacks {
+			pdCli = wrap(pdCli)
+		}
+		return pdCli, nil
+	}
+	pdCli, _ := connect()
+	var reconnect *reconnectPDClient
+	if opt.pdReconnectAfter > 0 {
+		reconnect = newReconnectPDClient(pdCli, connect)
+		pdCli = reconnect
 	}
 
-	return newTikvStore(uuid, pdCli, client, false)
+	s, err := newTikvStore(uuid, pdCli, client, false, opt.oracleUpdate, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if opt.spStaleness > 0 {
+		s.maxSafePointStaleness = opt.spStaleness
+	}
+	if opt.spRefresh > 0 {
+		s.safePointRefreshInterval = opt.spRefresh
+	}
+	s.disableSafePointUpdate = opt.disableSPUpdate
+	s.safePointFromPD = opt.spFromPD
+	s.supportDeleteRange = opt.deleteRange
+	s.maxBackoff = opt.maxBackoff
+	if opt.trackTxns {
+		s.enableTxnTracking()
+	}
+	s.fallbackOracle = opt.fallbackOracle
+	if opt.regionCache != nil {
+		s.regionCache = opt.regionCache
+	}
+	s.slowRequestThreshold = opt.slowReqLog
+	if opt.maxReqPerSec > 0 {
+		s.reqLimiter = newRateLimiter(opt.maxReqPerSec, opt.rejectLimited)
+	}
+	s.retryPolicy = opt.retryPolicy
+	s.pdReconnect, s.pdReconnectAfter = reconnect, int32(opt.pdReconnectAfter)
+	s.mockCluster = cluster
+	return s, nil
 }
 
 func (s *tikvStore) Begin() (kv.Transaction, error) {
@@ -246,8 +1143,34 @@ func (s *tikvStore) Begin() (kv.Transaction, error) {
 	return txn, nil
 }
 
-// BeginWithStartTS begins a transaction with startTS.
+// BeginReadOnly begins a read-only transaction, the writes in it return
+// ErrReadOnlyTxn and its commit doesn't go through 2PC.
+func (s *tikvStore) BeginReadOnly() (kv.Transaction, error) {
+	txn, err := newTiKVTxn(s)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	txn.readOnly = true
+	txnCounter.Inc()
+	return txn, nil
+}
+
+// BeginWithStartTS begins a transaction with startTS. It returns
+// ErrStartTSBelowSafePoint if startTS is older than the cached safepoint.
 func (s *tikvStore) BeginWithStartTS(startTS uint64) (kv.Transaction, error) {
+	s.spMutex.RLock()
+	safePoint := s.safePoint
+	s.spMutex.RUnlock()
+	if startTS < safePoint {
+		return nil, errors.Annotatef(ErrStartTSBelowSafePoint, "start timestamp %d, safepoint %d", startTS, safePoint)
+	}
+	return s.BeginWithStartTSUnchecked(startTS)
+}
+
+// BeginWithStartTSUnchecked begins a transaction with startTS without checking
+// it against the safepoint. It's used by the tools which read the historical
+// data intentionally, the data may have been collected by GC.
+func (s *tikvStore) BeginWithStartTSUnchecked(startTS uint64) (kv.Transaction, error) {
 	txn, err := newTikvTxnWithStartTS(s, startTS)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -256,22 +1179,127 @@ func (s *tikvStore) BeginWithStartTS(startTS uint64) (kv.Transaction, error) {
 	return txn, nil
 }
 
+// BeginBatch begins n transactions with a single startTS fetched from PD, to
+// save the TSO requests when many transactions are started at once. All the
+// transactions read the same snapshot: they don't see the writes of each
+// other, and the ones writing the same keys conflict like any concurrent
+// transactions, so at most one of them can commit.
+func (s *tikvStore) BeginBatch(n int) ([]kv.Transaction, error) {
+	if n <= 0 {
+		return nil, errors.Errorf("invalid transaction count %d", n)
+	}
+	bo := s.newBackoffer(tsoMaxBackoff, goctx.Background())
+	startTS, err := s.getTimestampWithRetry(bo)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	txns := make([]kv.Transaction, 0, n)
+	for i := 0; i < n; i++ {
+		txn, err := s.BeginWithStartTSUnchecked(startTS)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		txns = append(txns, txn)
+	}
+	return txns, nil
+}
+
+// BeginWithTS begins a transaction with startTS, and commits it with commitTS
+// instead of getting one from PD, so tests can control the order of the
+// transactions. It's only supported by the mock store, since the pinned
+// commitTS isn't ordered with the ones from PD. commitTS should be greater
+// than startTS.
+func (s *tikvStore) BeginWithTS(startTS, commitTS uint64) (kv.Transaction, error) {
+	if !s.mock {
+		return nil, errors.New("BeginWithTS is only supported by the mock store")
+	}
+	if commitTS <= startTS {
+		return nil, errors.Errorf("commitTS %d should be greater than startTS %d", commitTS, startTS)
+	}
+	txn, err := s.BeginWithStartTS(startTS)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	txn.(*tikvTxn).pinnedCommitTS = commitTS
+	return txn, nil
+}
+
 func (s *tikvStore) GetSnapshot(ver kv.Version) (kv.Snapshot, error) {
+	return s.GetSnapshotWithOptions(ver, SnapshotOptions{})
+}
+
+// GetSnapshotWithOptions is like GetSnapshot, but the requests sent by the
+// snapshot use the priority and the scan timeout in opts.
+func (s *tikvStore) GetSnapshotWithOptions(ver kv.Version, opts SnapshotOptions) (kv.Snapshot, error) {
 	snapshot := newTiKVSnapshot(s, ver)
+	snapshot.priority = opts.Priority
+	snapshot.scanTimeout = opts.ScanTimeout
 	snapshotCounter.Inc()
 	return snapshot, nil
 }
 
+// GetValueAtTS reads the value of key at version ts, it returns kv.ErrNotExist
+// if the key doesn't exist at ts.
+func (s *tikvStore) GetValueAtTS(ctx goctx.Context, key kv.Key, ts uint64) ([]byte, error) {
+	if err := s.CheckVisibility(ts); err != nil {
+		return nil, errors.Trace(err)
+	}
+	snapshot := newTiKVSnapshot(s, kv.Version{Ver: ts})
+	val, err := snapshot.get(s.newBackoffer(getMaxBackoff, ctx), key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(val) == 0 {
+		return nil, kv.ErrNotExist
+	}
+	return val, nil
+}
+
+// BatchGetAtTS reads the values of keys at version ts, the keys which don't
+// exist at ts are not in the returned map.
+func (s *tikvStore) BatchGetAtTS(ctx goctx.Context, keys []kv.Key, ts uint64) (map[string][]byte, error) {
+	if err := s.CheckVisibility(ts); err != nil {
+		return nil, errors.Trace(err)
+	}
+	snapshot := newTiKVSnapshot(s, kv.Version{Ver: ts})
+	m, err := snapshot.batchGet(s.newBackoffer(batchGetMaxBackoff, ctx), keys)
+	return m, errors.Trace(err)
+}
+
 func (s *tikvStore) Close() error {
+	// Mark the store as closing, so Open of the same cluster fails fast
+	// instead of racing with the background goroutines being stopped.
 	mc.Lock()
-	defer mc.Unlock()
+	// Close is idempotent, so it's safe to be deferred after an explicit Close.
+	if s.closed {
+		mc.Unlock()
+		return nil
+	}
+	s.closed = true
+	if mc.cache[s.uuid] == s {
+		delete(mc.cache, s.uuid)
+	}
+	mc.closing[s.uuid] = struct{}{}
+	mc.Unlock()
+	defer func() {
+		mc.Lock()
+		delete(mc.closing, s.uuid)
+		mc.Unlock()
+	}()
 
-	delete(mc.cache, s.uuid)
-	s.oracle.Close()
-	s.pdClient.Close()
+	// Stop the safepoint updater first, it reads the sys table through the store.
+	close(s.spMsg)
+	s.spWg.Wait()
 	if s.gcWorker != nil {
 		s.gcWorker.Close()
 	}
+	s.oracle.Close()
+	if s.fallbackOracle != nil {
+		s.fallbackOracle.Close()
+	}
+	if s.ownsPDClient {
+		s.pdClient.Close()
+	}
 
 	if err := s.client.Close(); err != nil {
 		return errors.Trace(err)
@@ -284,7 +1312,20 @@ func (s *tikvStore) UUID() string {
 }
 
 func (s *tikvStore) CurrentVersion() (kv.Version, error) {
-	bo := NewBackoffer(tsoMaxBackoff, goctx.Background())
+	bo := s.newBackoffer(tsoMaxBackoff, goctx.Background())
+	startTS, err := s.getTimestampWithRetry(bo)
+	if err != nil {
+		return kv.NewVersion(0), errors.Trace(err)
+	}
+	return kv.NewVersion(startTS), nil
+}
+
+// CurrentVersionWithTimeout is like CurrentVersion, but gives up if it can't
+// get the timestamp from PD within the timeout.
+func (s *tikvStore) CurrentVersionWithTimeout(timeout time.Duration) (kv.Version, error) {
+	ctx, cancel := goctx.WithTimeout(goctx.Background(), timeout)
+	defer cancel()
+	bo := s.newBackoffer(tsoMaxBackoff, ctx)
 	startTS, err := s.getTimestampWithRetry(bo)
 	if err != nil {
 		return kv.NewVersion(0), errors.Trace(err)
@@ -292,15 +1333,119 @@ func (s *tikvStore) CurrentVersion() (kv.Version, error) {
 	return kv.NewVersion(startTS), nil
 }
 
+// getTimestampWithRetry gets the timestamp from PD, it falls back to
+// s.fallbackOracle if it's set and bo is exhausted.
 func (s *tikvStore) getTimestampWithRetry(bo *Backoffer) (uint64, error) {
-	for {
+	ts, _, err := s.getTimestampWithFallback(bo)
+	return ts, errors.Trace(err)
+}
+
+// getTimestampWithFallback is like getTimestampWithRetry, fallback is true if
+// the timestamp is from s.fallbackOracle, it's not ordered with the ones
+// from PD, so it must not be used to write.
+func (s *tikvStore) getTimestampWithFallback(bo *Backoffer) (ts uint64, fallback bool, err error) {
+	ts, err = s.getTimestampFromPD(bo)
+	if err == nil || s.fallbackOracle == nil {
+		return ts, false, errors.Trace(err)
+	}
+	log.Warnf("[kv] %v, use the fallback oracle, the txn is not linearizable", err)
+	ts, fbErr := s.fallbackOracle.GetTimestamp(bo.ctx)
+	if fbErr != nil {
+		return 0, false, errors.Annotatef(err, "fallback oracle failed: %v", fbErr)
+	}
+	return ts, true, nil
+}
+
+// getTimestampFromPD gets the timestamp from PD, retrying until bo is exhausted.
+func (s *tikvStore) getTimestampFromPD(bo *Backoffer) (uint64, error) {
+	start := time.Now()
+	for retries := 0; ; retries++ {
 		startTS, err := s.oracle.GetTimestamp(bo.ctx)
 		if err == nil {
+			if s.pdReconnect != nil {
+				atomic.StoreInt32(&s.tsoFailures, 0)
+			}
 			return startTS, nil
 		}
+		s.onTSOFailure()
 		err = bo.Backoff(boPDRPC, errors.Errorf("get timestamp failed: %v", err))
 		if err != nil {
-			return 0, errors.Trace(err)
+			// The annotation keeps the txnRetryableMark in the error message.
+			return 0, errors.Annotatef(err, "get timestamp failed after %d retries over %v", retries, time.Since(start))
+		}
+	}
+}
+
+// onTSOFailure counts the consecutive TSO failures, and replaces the PD client
+// once they reach pdReconnectAfter, in case the client is connected to a dead
+// PD endpoint.
+func (s *tikvStore) onTSOFailure() {
+	if s.pdReconnect == nil {
+		return
+	}
+	n := atomic.AddInt32(&s.tsoFailures, 1)
+	// Only one of the concurrent callers reconnects.
+	if n < s.pdReconnectAfter || !atomic.CompareAndSwapInt32(&s.tsoFailures, n, 0) {
+		return
+	}
+	log.Warnf("[kv] get timestamp failed %d times in a row, reconnect pd", n)
+	if err := s.pdReconnect.reconnect(); err != nil {
+		log.Errorf("[kv] reconnect pd err: %v", err)
+	}
+}
+
+// minOracleUpdateInterval is the minimum interval accepted by SetOracleUpdateInterval,
+// so the oracle doesn't flood PD with timestamp requests.
+const minOracleUpdateInterval = 10 * time.Millisecond
+
+// oracleIntervalSetter is implemented by the oracles which update the cached
+// timestamp periodically, like the PD oracle.
+type oracleIntervalSetter interface {
+	SetUpdateInterval(interval time.Duration)
+}
+
+// SetOracleUpdateInterval changes the interval the oracle updates the timestamp
+// returned by GetLowResolutionTimestamp, without reopening the store. The
+// interval should be at least 10ms, and the oracle should support it, e.g. the
+// fixed oracle doesn't.
+func (s *tikvStore) SetOracleUpdateInterval(interval time.Duration) error {
+	if interval < minOracleUpdateInterval {
+		return errors.Errorf("oracle update interval should be at least %v, got %v", minOracleUpdateInterval, interval)
+	}
+	setter, ok := s.oracle.(oracleIntervalSetter)
+	if !ok {
+		return errors.New("oracle doesn't support changing the update interval")
+	}
+	setter.SetUpdateInterval(interval)
+	return nil
+}
+
+// GetLowResolutionTimestamp returns the timestamp cached by the oracle without
+// getting a new one from PD. The oracle updates it every update interval of the
+// oracle, see SetOracleUpdateInterval, so it may lag by up to the interval.
+func (s *tikvStore) GetLowResolutionTimestamp() (uint64, error) {
+	ts, err := s.oracle.GetLowResolutionTimestamp()
+	return ts, errors.Trace(err)
+}
+
+// ListStores returns the meta of all the TiKV stores known by PD, the state
+// of each store (up, offline or tombstone) is included.
+func (s *tikvStore) ListStores(bo *Backoffer) ([]*metapb.Store, error) {
+	lister, ok := s.pdClient.(storeLister)
+	if !ok {
+		return nil, errors.New("pd client doesn't support listing stores")
+	}
+	for {
+		stores, err := lister.GetAllStores(bo.ctx)
+		if err == nil {
+			return stores, nil
+		}
+		if errors.Cause(err) == goctx.Canceled {
+			return nil, errors.Trace(err)
+		}
+		err = errors.Errorf("list stores from PD failed, err: %v", err)
+		if err = bo.Backoff(boPDRPC, err); err != nil {
+			return nil, errors.Trace(err)
 		}
 	}
 }
@@ -316,29 +1461,136 @@ func (s *tikvStore) GetOracle() oracle.Oracle {
 	return s.oracle
 }
 
+// SupportDeleteRange returns true for the real store. It returns false for the
+// mock store unless it's created with WithDeleteRangeSupport(true).
 func (s *tikvStore) SupportDeleteRange() (supported bool) {
-	if s.mock {
-		return false
-	}
-	return true
+	return s.supportDeleteRange
 }
 
 func (s *tikvStore) SendReq(bo *Backoffer, req *tikvrpc.Request, regionID RegionVerID, timeout time.Duration) (*tikvrpc.Response, error) {
-	sender := NewRegionRequestSender(s.regionCache, s.client, kvrpcpb.IsolationLevel_SI)
-	return sender.SendReq(bo, req, regionID, timeout)
+	return s.SendReqWithIsolation(bo, req, regionID, timeout, kvrpcpb.IsolationLevel_SI)
+}
+
+// SendReqWithIsolation sends the request like SendReq, but with the given isolation level
+// instead of SI.
+func (s *tikvStore) SendReqWithIsolation(bo *Backoffer, req *tikvrpc.Request, regionID RegionVerID, timeout time.Duration, level kvrpcpb.IsolationLevel) (*tikvrpc.Response, error) {
+	resp, _, err := s.sendReq(bo, req, regionID, timeout, level)
+	return resp, err
+}
+
+// SendReqWithStats sends the request like SendReq, and returns how many times
+// it's sent and whether the leader of the region changed meanwhile.
+func (s *tikvStore) SendReqWithStats(bo *Backoffer, req *tikvrpc.Request, regionID RegionVerID, timeout time.Duration) (*tikvrpc.Response, SendReqStats, error) {
+	return s.sendReq(bo, req, regionID, timeout, kvrpcpb.IsolationLevel_SI)
+}
+
+func (s *tikvStore) sendReq(bo *Backoffer, req *tikvrpc.Request, regionID RegionVerID, timeout time.Duration, level kvrpcpb.IsolationLevel) (*tikvrpc.Response, SendReqStats, error) {
+	if s.reqLimiter != nil {
+		if err := s.reqLimiter.wait(bo.ctx); err != nil {
+			return nil, SendReqStats{}, errors.Trace(err)
+		}
+	}
+	sender := NewRegionRequestSender(s.regionCache, s.client, level)
+	s.reqObserverMu.RLock()
+	observer := s.reqObserver
+	s.reqObserverMu.RUnlock()
+	start := time.Now()
+	resp, err := sender.SendReq(bo, req, regionID, timeout)
+	elapsed := time.Since(start)
+	label := req.Type.String()
+	storeReqHistogram.WithLabelValues(label).Observe(elapsed.Seconds())
+	if err != nil {
+		storeReqErrorCounter.WithLabelValues(label).Inc()
+	}
+	if s.slowRequestThreshold > 0 && elapsed > s.slowRequestThreshold {
+		log.Warnf("[kv] slow request %s to region %d takes %v, attempts %d", req.Type, regionID.id, elapsed, sender.Stats().Attempts)
+	}
+	if observer != nil {
+		observer(req, resp, elapsed, err)
+	}
+	return resp, sender.Stats(), err
+}
+
+// SendReqCtx sends the request like SendReq, the backoffer is created from ctx,
+// so cancelling ctx aborts the request and its retries.
+func (s *tikvStore) SendReqCtx(ctx goctx.Context, req *tikvrpc.Request, regionID RegionVerID, timeout time.Duration) (*tikvrpc.Response, error) {
+	bo := s.newBackoffer(sendReqMaxBackoff, ctx)
+	resp, err := s.SendReq(bo, req, regionID, timeout)
+	return resp, errors.Trace(err)
+}
+
+// SetRequestObserver sets the function called after every request sent by SendReq
+// returns, with the response, the elapsed time and the error. Passing nil removes
+// the observer.
+func (s *tikvStore) SetRequestObserver(observer func(req *tikvrpc.Request, resp *tikvrpc.Response, elapsed time.Duration, err error)) {
+	s.reqObserverMu.Lock()
+	s.reqObserver = observer
+	s.reqObserverMu.Unlock()
 }
 
 func (s *tikvStore) GetRegionCache() *RegionCache {
 	return s.regionCache
 }
 
+// OnRegionInvalidate registers f to be called when a region is dropped from the
+// region cache, e.g. because of NotLeader or an epoch change.
+func (s *tikvStore) OnRegionInvalidate(f func(RegionVerID)) {
+	s.regionCache.OnRegionInvalidate(f)
+}
+
+// PrewarmRegions loads the regions in [startKey, endKey) into the region cache,
+// so the first requests to them don't need to query PD. An empty endKey means
+// the end of the key space. It is safe to call it more than once or concurrently,
+// the regions already cached are not loaded again.
+func (s *tikvStore) PrewarmRegions(bo *Backoffer, startKey, endKey []byte) error {
+	key := startKey
+	for {
+		loc, err := s.regionCache.LocateKey(bo, key)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if len(loc.EndKey) == 0 || (len(endKey) > 0 && bytes.Compare(loc.EndKey, endKey) >= 0) {
+			return nil
+		}
+		key = loc.EndKey
+	}
+}
+
 // ParseEtcdAddr parses path to etcd address list
 func ParseEtcdAddr(path string) (etcdAddrs []string, err error) {
 	etcdAddrs, _, err = parsePath(path)
 	return
 }
 
-func parsePath(path string) (etcdAddrs []string, disableGC bool, err error) {
+// pathOptions is the store options specified in the query of the path.
+type pathOptions struct {
+	disableGC                bool
+	disableSafePointUpdate   bool
+	safePointFromPD          bool
+	maxSafePointStaleness    time.Duration
+	safePointRefreshInterval time.Duration
+	gcLifeTime               time.Duration
+	oracleUpdateInterval     time.Duration
+	maxBackoff               int
+	grpcConnCount            int
+	trackTxns                bool
+	allowFallbackOracle      bool
+	slowRequestThreshold     time.Duration
+	storeName                string
+	// fixedOracle makes the store use a FixedOracle starting at oracleBaseTS
+	// instead of the PD oracle, it's only for deterministic testing.
+	fixedOracle  bool
+	oracleBaseTS uint64
+	// maxReqPerSec limits the rate of the requests sent by SendReq, the requests
+	// beyond it wait, or fail with ErrRateLimited if rejectRateLimited is set.
+	maxReqPerSec      int
+	rejectRateLimited bool
+	// pdReconnectAfter makes the store reconnect PD after the consecutive TSO
+	// failures, 0 means never.
+	pdReconnectAfter int
+}
+
+func parsePath(path string) (etcdAddrs []string, opts pathOptions, err error) {
 	var u *url.URL
 	u, err = url.Parse(path)
 	if err != nil {
@@ -350,19 +1602,132 @@ func parsePath(path string) (etcdAddrs []string, disableGC bool, err error) {
 		log.Error(err)
 		return
 	}
-	switch strings.ToLower(u.Query().Get("disableGC")) {
-	case "true":
-		disableGC = true
-	case "false", "":
+	if opts.disableGC, err = parseBoolParam(u.Query(), "disableGC"); err != nil {
+		return
+	}
+	if opts.disableSafePointUpdate, err = parseBoolParam(u.Query(), "disableSafePointUpdate"); err != nil {
+		return
+	}
+	if opts.safePointFromPD, err = parseBoolParam(u.Query(), "safePointFromPD"); err != nil {
+		return
+	}
+	if opts.maxSafePointStaleness, err = parseDurationParam(u.Query(), "spStaleness"); err != nil {
+		return
+	}
+	if opts.safePointRefreshInterval, err = parseDurationParam(u.Query(), "spRefresh"); err != nil {
+		return
+	}
+	if opts.gcLifeTime, err = parseDurationParam(u.Query(), "gcLifeTime"); err != nil {
+		return
+	}
+	if opts.oracleUpdateInterval, err = parseDurationParam(u.Query(), "oracleUpdate"); err != nil {
+		return
+	}
+	if opts.slowRequestThreshold, err = parseDurationParam(u.Query(), "slowReqLog"); err != nil {
+		return
+	}
+	if opts.trackTxns, err = parseBoolParam(u.Query(), "trackTxns"); err != nil {
+		return
+	}
+	if opts.allowFallbackOracle, err = parseBoolParam(u.Query(), "allowFallbackOracle"); err != nil {
+		return
+	}
+	if opts.maxBackoff, err = parsePositiveIntParam(u.Query(), "maxBackoff"); err != nil {
+		return
+	}
+	if opts.grpcConnCount, err = parsePositiveIntParam(u.Query(), "grpcConnCount"); err != nil {
+		return
+	}
+	if opts.maxReqPerSec, err = parsePositiveIntParam(u.Query(), "maxReqPerSec"); err != nil {
+		return
+	}
+	if opts.pdReconnectAfter, err = parsePositiveIntParam(u.Query(), "pdReconnectAfter"); err != nil {
+		return
+	}
+	if opts.rejectRateLimited, err = parseBoolParam(u.Query(), "rejectRateLimited"); err != nil {
+		return
+	}
+	if opts.gcLifeTime > 0 && opts.gcLifeTime < gcMinLifeTime {
+		err = errors.Errorf("gcLifeTime should be at least %v, got %v", gcMinLifeTime, opts.gcLifeTime)
+		return
+	}
+	query := u.Query()
+	switch strings.ToLower(query.Get("oracle")) {
+	case "", "pd":
+	case "fixed":
+		opts.fixedOracle = true
 	default:
-		err = errors.New("disableGC flag should be true/false")
+		err = errors.Errorf("oracle should be pd/fixed, got %s", query.Get("oracle"))
 		return
 	}
+	if str := query.Get("oracleBaseTS"); str != "" {
+		if !opts.fixedOracle {
+			err = errors.New("oracleBaseTS should be used with oracle=fixed")
+			return
+		}
+		if opts.oracleBaseTS, err = strconv.ParseUint(str, 10, 64); err != nil {
+			err = errors.Errorf("oracleBaseTS should be an unsigned integer, got %s", str)
+			return
+		}
+	} else if opts.fixedOracle {
+		opts.oracleBaseTS = oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0)
+	}
+	opts.storeName = query.Get("storeName")
+	// The vendored pd client always dials PD insecurely, the TLS params are
+	// rejected rather than silently ignored.
+	for _, key := range []string{"ca", "cert", "key"} {
+		if query.Get(key) != "" {
+			err = errors.Errorf("connecting PD with TLS is not supported, got %s", key)
+			return
+		}
+	}
 	etcdAddrs = strings.Split(u.Host, ",")
 	return
 }
 
+// parseBoolParam parses the true/false flag specified by key in the query,
+// it returns false if the key is absent.
+func parseBoolParam(query url.Values, key string) (bool, error) {
+	switch strings.ToLower(query.Get(key)) {
+	case "true":
+		return true, nil
+	case "false", "":
+		return false, nil
+	default:
+		return false, errors.Errorf("%s flag should be true/false", key)
+	}
+}
+
+// parseDurationParam parses the duration specified by key in the query,
+// it returns 0 if the key is absent.
+func parseDurationParam(query url.Values, key string) (time.Duration, error) {
+	str := query.Get(key)
+	if str == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("%s should be a positive duration, got %s", key, str)
+	}
+	return d, nil
+}
+
+// parsePositiveIntParam parses the positive integer specified by key in the query,
+// it returns 0 if the key is absent.
+func parsePositiveIntParam(query url.Values, key string) (int, error) {
+	str := query.Get(key)
+	if str == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil || n <= 0 {
+		return 0, errors.Errorf("%s should be a positive integer, got %s", key, str)
+	}
+	return n, nil
+}
+
 func init() {
 	mc.cache = make(map[string]*tikvStore)
+	mc.closing = make(map[string]struct{})
 	rand.Seed(time.Now().UnixNano())
 }
@@ -57,7 +57,7 @@ func NewLockResolver(etcdAddrs []string) (*LockResolver, error) {
 		return nil, errors.Trace(err)
 	}
 	uuid := fmt.Sprintf("tikv-%v", pdCli.GetClusterID(goctx.TODO()))
-	s, err := newTikvStore(uuid, &codecPDClient{pdCli}, newRPCClient(), false)
+	s, err := newTikvStore(uuid, &codecPDClient{pdCli}, newRPCClient(0), false, 0, nil)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -186,7 +186,7 @@ func (lr *LockResolver) ResolveLocks(bo *Backoffer, locks []*Lock) (ok bool, err
 // To avoid unnecessarily aborting too many txns, it is wiser to wait a few
 // seconds before calling it after Prewrite.
 func (lr *LockResolver) GetTxnStatus(txnID uint64, primary []byte) (TxnStatus, error) {
-	bo := NewBackoffer(cleanupMaxBackoff, goctx.Background())
+	bo := lr.store.newBackoffer(cleanupMaxBackoff, goctx.Background())
 	status, err := lr.getTxnStatus(bo, txnID, primary)
 	return status, errors.Trace(err)
 }
@@ -275,5 +275,5 @@ func init() {
 	defaultLockTTL = 3
 	maxLockTTL = 120
 	ttlFactor = 6
-	oracleUpdateInterval = 2
+	defaultOracleUpdateInterval = 2 * time.Millisecond
 }
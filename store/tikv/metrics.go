@@ -69,6 +69,23 @@ var (
 			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18),
 		})
 
+	storeReqHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "tidb",
+			Subsystem: "tikvclient",
+			Name:      "store_request_seconds",
+			Help:      "Bucketed histogram of the requests sent by the store, including the retries.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18),
+		}, []string{"type"})
+
+	storeReqErrorCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tidb",
+			Subsystem: "tikvclient",
+			Name:      "store_request_error_total",
+			Help:      "Counter of the requests sent by the store which fail.",
+		}, []string{"type"})
+
 	connPoolHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "tidb",
@@ -130,6 +147,22 @@ var (
 		}, []string{"type"},
 	)
 
+	gcSafePointLoadCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tidb",
+			Subsystem: "tikvclient",
+			Name:      "gc_safepoint_load_total",
+			Help:      "Counter of loading the gc safepoint.",
+		}, []string{"result"})
+
+	gcSafePointGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "tidb",
+			Subsystem: "tikvclient",
+			Name:      "gc_safepoint",
+			Help:      "Gauge of the cached gc safepoint.",
+		})
+
 	lockResolverCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "tidb",
@@ -220,12 +253,16 @@ func init() {
 	prometheus.MustRegister(backoffCounter)
 	prometheus.MustRegister(backoffHistogram)
 	prometheus.MustRegister(sendReqHistogram)
+	prometheus.MustRegister(storeReqHistogram)
+	prometheus.MustRegister(storeReqErrorCounter)
 	prometheus.MustRegister(connPoolHistogram)
 	prometheus.MustRegister(coprocessorCounter)
 	prometheus.MustRegister(coprocessorHistogram)
 	prometheus.MustRegister(gcWorkerCounter)
 	prometheus.MustRegister(gcConfigGauge)
 	prometheus.MustRegister(gcHistogram)
+	prometheus.MustRegister(gcSafePointLoadCounter)
+	prometheus.MustRegister(gcSafePointGauge)
 	prometheus.MustRegister(lockResolverCounter)
 	prometheus.MustRegister(regionErrorCounter)
 	prometheus.MustRegister(txnWriteKVCountHistogram)
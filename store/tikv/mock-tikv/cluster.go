@@ -16,6 +16,7 @@ package mocktikv
 import (
 	"bytes"
 	"math"
+	"sort"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
@@ -40,6 +41,8 @@ type Cluster struct {
 	id      uint64
 	stores  map[uint64]*Store
 	regions map[uint64]*Region
+	// gcSafePoint is the GC safepoint returned by PD.
+	gcSafePoint uint64
 }
 
 // NewCluster creates an empty cluster. It needs to be bootstrapped before
@@ -86,6 +89,22 @@ func (c *Cluster) GetAllRegions() []*Region {
 	return regions
 }
 
+// GetGCSafePoint returns the GC safepoint of the cluster.
+func (c *Cluster) GetGCSafePoint() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.gcSafePoint
+}
+
+// SetGCSafePoint sets the GC safepoint of the cluster.
+func (c *Cluster) SetGCSafePoint(safePoint uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.gcSafePoint = safePoint
+}
+
 // GetStore returns a Store's meta.
 func (c *Cluster) GetStore(storeID uint64) *metapb.Store {
 	c.RLock()
@@ -97,6 +116,19 @@ func (c *Cluster) GetStore(storeID uint64) *metapb.Store {
 	return nil
 }
 
+// GetAllStores returns all the Stores' meta, ordered by ID.
+func (c *Cluster) GetAllStores() []*metapb.Store {
+	c.RLock()
+	defer c.RUnlock()
+
+	stores := make([]*metapb.Store, 0, len(c.stores))
+	for _, store := range c.stores {
+		stores = append(stores, proto.Clone(store.meta).(*metapb.Store))
+	}
+	sort.Slice(stores, func(i, j int) bool { return stores[i].GetId() < stores[j].GetId() })
+	return stores
+}
+
 // StopStore stops a store with storeID.
 func (c *Cluster) StopStore(storeID uint64) {
 	c.Lock()
@@ -49,3 +49,16 @@ func BootstrapWithMultiRegions(cluster *Cluster, splitKeys ...[]byte) (storeID u
 	}
 	return
 }
+
+// BootstrapWithMultiStoresAndRegions initializes a Cluster with n Stores and
+// len(splitKeys) + 1 Regions, every Region has a peer on each Store and its
+// leader on the first Store. The splitKeys should be sorted.
+func BootstrapWithMultiStoresAndRegions(cluster *Cluster, n int, splitKeys ...[]byte) (storeIDs, regionIDs []uint64) {
+	storeIDs, _, regionID, _ := BootstrapWithMultiStores(cluster, n)
+	regionIDs = append([]uint64{regionID}, cluster.AllocIDs(len(splitKeys))...)
+	for i, k := range splitKeys {
+		peerIDs := cluster.AllocIDs(n)
+		cluster.Split(regionIDs[i], regionIDs[i+1], k, peerIDs, peerIDs[0])
+	}
+	return
+}
@@ -17,6 +17,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/juju/errors"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
 )
@@ -345,6 +346,41 @@ func (s *testMockTiKVSuite) TestBatchGet(c *C) {
 	c.Assert(string(pairs[2].Value), Equals, "v3")
 }
 
+func (s *testMVCCLevelDB) TestGCedVersions(c *C) {
+	s.mustPutOK(c, "k1", "v1", 1, 2)
+	s.mustPutOK(c, "k1", "v11", 5, 6)
+	s.mustPutOK(c, "k2", "v2", 1, 2)
+	s.mustPutOK(c, "k3", "v3", 7, 8)
+	s.store.(*MVCCLevelDB).SetGCedVersions(map[string]uint64{"k1": 6, "k3": 10})
+
+	s.mustGetOK(c, "k1", 6, "v11")
+	s.mustGetOK(c, "k2", 3, "v2")
+	_, err := s.store.Get([]byte("k1"), 3, kvrpcpb.IsolationLevel_SI)
+	_, ok := errors.Cause(err).(ErrAbort)
+	c.Assert(ok, IsTrue)
+	// It's GC'd even if no version is visible at the timestamp.
+	s.mustGetErr(c, "k3", 5)
+
+	pairs := s.store.BatchGet([][]byte{[]byte("k1"), []byte("k2"), []byte("k3")}, 9, kvrpcpb.IsolationLevel_SI)
+	c.Assert(pairs, HasLen, 3)
+	c.Assert(pairs[0].Err, IsNil)
+	c.Assert(pairs[1].Err, IsNil)
+	c.Assert(pairs[2].Err, NotNil)
+	for _, pairs := range [][]Pair{
+		s.store.Scan(nil, nil, 10, 9, kvrpcpb.IsolationLevel_SI),
+		s.store.ReverseScan(nil, nil, 10, 9, kvrpcpb.IsolationLevel_SI),
+	} {
+		c.Assert(pairs, HasLen, 3)
+		for _, pair := range pairs {
+			c.Assert(pair.Err != nil, Equals, string(pair.Key) == "k3", Commentf("key %s", pair.Key))
+		}
+	}
+	s.mustScanOK(c, "", 10, 10, "k1", "v11", "k2", "v2", "k3", "v3")
+
+	s.store.(*MVCCLevelDB).SetGCedVersions(nil)
+	s.mustGetOK(c, "k1", 3, "v1")
+}
+
 func (s *testMockTiKVSuite) TestScanLock(c *C) {
 	s.mustPutOK(c, "k1", "v1", 1, 2)
 	s.mustPrewriteOK(c, putMutations("p1", "v5", "s1", "v5"), "p1", 5)
@@ -392,6 +428,27 @@ func (s *testMockTiKVSuite) TestResolveLock(c *C) {
 	s.mustScanLock(c, 30, nil)
 }
 
+func (s *testMockTiKVSuite) TestDeleteRange(c *C) {
+	for _, k := range []string{"a", "b", "c", "d"} {
+		s.mustPutOK(c, k, k+"5", 5, 10)
+		s.mustPutOK(c, k, k+"15", 15, 20)
+	}
+	s.mustPrewriteOK(c, putMutations("c", "c25"), "c", 25)
+
+	// All the versions and locks in the range are deleted.
+	c.Assert(s.store.DeleteRange([]byte("b"), []byte("d")), IsNil)
+	s.mustScanOK(c, "", 10, 30, "a", "a15", "d", "d15")
+	s.mustGetOK(c, "a", 10, "a5")
+	s.mustGetNone(c, "b", 10)
+	s.mustGetNone(c, "c", 30)
+	s.mustScanLock(c, 30, nil)
+
+	c.Assert(s.store.DeleteRange([]byte("c"), nil), IsNil)
+	s.mustScanOK(c, "", 10, 30, "a", "a15")
+	c.Assert(s.store.DeleteRange(nil, nil), IsNil)
+	s.mustScanOK(c, "", 10, 30)
+}
+
 func (s *testMockTiKVSuite) TestRollbackAndWriteConflict(c *C) {
 	s.mustPutOK(c, "test", "test", 1, 3)
 
@@ -15,6 +15,7 @@ package mocktikv
 
 import (
 	"bytes"
+	"fmt"
 	"math"
 	"sync"
 
@@ -53,6 +54,9 @@ type MVCCLevelDB struct {
 	// EOF
 	db *leveldb.DB
 	mu sync.RWMutex
+	// gcedVersions maps the keys to the timestamps, the versions older than
+	// them are treated as GC'd, see SetGCedVersions.
+	gcedVersions map[string]uint64
 }
 
 var lockVer uint64 = math.MaxUint64
@@ -288,7 +292,32 @@ func (mvcc *MVCCLevelDB) Get(key []byte, startTS uint64, isoLevel kvrpcpb.Isolat
 	return mvcc.getValue(key, startTS, isoLevel)
 }
 
+// SetGCedVersions makes the versions of the keys older than the timestamps in
+// versions treated as GC'd, reading the keys before the timestamps returns
+// ErrAbort. It simulates reading the versions collected by GC in tests, since
+// the mock store doesn't run GC by itself. It replaces the previous ones.
+func (mvcc *MVCCLevelDB) SetGCedVersions(versions map[string]uint64) {
+	mvcc.mu.Lock()
+	defer mvcc.mu.Unlock()
+
+	mvcc.gcedVersions = make(map[string]uint64, len(versions))
+	for k, v := range versions {
+		mvcc.gcedVersions[k] = v
+	}
+}
+
+// checkGCed returns ErrAbort if the versions of key read at startTS are GC'd.
+func (mvcc *MVCCLevelDB) checkGCed(key []byte, startTS uint64) error {
+	if safePoint, ok := mvcc.gcedVersions[string(key)]; ok && startTS < safePoint {
+		return ErrAbort(fmt.Sprintf("the versions of key %q before %d are GC'd, read at %d", key, safePoint, startTS))
+	}
+	return nil
+}
+
 func (mvcc *MVCCLevelDB) getValue(key []byte, startTS uint64, isoLevel kvrpcpb.IsolationLevel) ([]byte, error) {
+	if err := mvcc.checkGCed(key, startTS); err != nil {
+		return nil, errors.Trace(err)
+	}
 	startKey := mvccEncode(key, lockVer)
 	iter := newIterator(mvcc.db, &util.Range{
 		Start: startKey,
@@ -371,6 +400,9 @@ func (mvcc *MVCCLevelDB) Scan(startKey, endKey []byte, limit int, startTS uint64
 	var pairs []Pair
 	for len(pairs) < limit && ok {
 		value, err := getValue(iter, currKey, startTS, isoLevel)
+		if gcErr := mvcc.checkGCed(currKey, startTS); gcErr != nil {
+			value, err = nil, gcErr
+		}
 		if err != nil {
 			pairs = append(pairs, Pair{
 				Key: currKey,
@@ -448,6 +480,13 @@ func (mvcc *MVCCLevelDB) ReverseScan(startKey, endKey []byte, limit int, startTS
 	if len(helper.pairs) < limit {
 		helper.finishEntry()
 	}
+	// Only the returned keys are checked, the GC'd keys without any version
+	// visible at startTS are skipped.
+	for i, pair := range helper.pairs {
+		if err := mvcc.checkGCed(pair.Key, startTS); err != nil {
+			helper.pairs[i] = Pair{Key: pair.Key, Err: err}
+		}
+	}
 	return helper.pairs
 }
 
@@ -819,3 +858,37 @@ func (mvcc *MVCCLevelDB) ResolveLock(startKey, endKey []byte, startTS, commitTS
 	}
 	return mvcc.db.Write(batch, nil)
 }
+
+// DeleteRange implements the MVCCStore interface.
+func (mvcc *MVCCLevelDB) DeleteRange(startKey, endKey []byte) error {
+	mvcc.mu.Lock()
+	defer mvcc.mu.Unlock()
+
+	var start, end []byte
+	if len(startKey) > 0 {
+		start = mvccEncode(startKey, lockVer)
+	}
+	if len(endKey) > 0 {
+		end = mvccEncode(endKey, lockVer)
+	}
+	iter := mvcc.db.NewIterator(&util.Range{
+		Start: start,
+		Limit: end,
+	}, nil)
+	defer iter.Release()
+
+	batch := &leveldb.Batch{}
+	for iter.Next() {
+		batch.Delete(iter.Key())
+	}
+	if err := iter.Error(); err != nil {
+		return errors.Trace(err)
+	}
+	return mvcc.db.Write(batch, nil)
+}
+
+// Close calls leveldb's Close to free resources, the data written to the path
+// can be loaded again by NewMVCCLevelDB.
+func (mvcc *MVCCLevelDB) Close() error {
+	return mvcc.db.Close()
+}
@@ -92,5 +92,25 @@ func (c *pdClient) GetStore(ctx context.Context, storeID uint64) (*metapb.Store,
 	return store, nil
 }
 
+// GetAllStores returns all the stores of the cluster.
+func (c *pdClient) GetAllStores(ctx context.Context) ([]*metapb.Store, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	return c.cluster.GetAllStores(), nil
+}
+
+// GetGCSafePoint returns the GC safepoint of the cluster.
+func (c *pdClient) GetGCSafePoint(ctx context.Context) (uint64, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+	}
+	return c.cluster.GetGCSafePoint(), nil
+}
+
 func (c *pdClient) Close() {
 }
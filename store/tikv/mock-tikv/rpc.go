@@ -14,6 +14,8 @@
 package mocktikv
 
 import (
+	"io"
+
 	"github.com/golang/protobuf/proto"
 	"github.com/juju/errors"
 	"github.com/pingcap/kvproto/pkg/coprocessor"
@@ -218,7 +220,8 @@ func (h *rpcHandler) handleKvScan(req *kvrpcpb.ScanRequest) *kvrpcpb.ScanRespons
 	if !h.checkKeyInRegion(req.GetStartKey()) {
 		panic("KvScan: startKey not in region")
 	}
-	pairs := h.mvccStore.Scan(req.GetStartKey(), h.endKey, int(req.GetLimit()), req.GetVersion(), h.isolationLevel)
+	// The MVCC store takes the raw keys, the region's end key is encoded.
+	pairs := h.mvccStore.Scan(req.GetStartKey(), MvccKey(h.endKey).Raw(), int(req.GetLimit()), req.GetVersion(), h.isolationLevel)
 	return &kvrpcpb.ScanResponse{
 		Pairs: convertToPbPairs(pairs),
 	}
@@ -339,9 +342,16 @@ func (h *rpcHandler) handleKvResolveLock(req *kvrpcpb.ResolveLockRequest) *kvrpc
 }
 
 func (h *rpcHandler) handleKvDeleteRange(req *kvrpcpb.DeleteRangeRequest) *kvrpcpb.DeleteRangeResponse {
-	return &kvrpcpb.DeleteRangeResponse{
-		Error: "not implemented",
+	if !h.checkKeyInRegion(req.StartKey) {
+		panic("KvDeleteRange: key not in region")
 	}
+	err := h.mvccStore.DeleteRange(req.StartKey, req.EndKey)
+	if err != nil {
+		return &kvrpcpb.DeleteRangeResponse{
+			Error: err.Error(),
+		}
+	}
+	return &kvrpcpb.DeleteRangeResponse{}
 }
 
 func (h *rpcHandler) handleKvRawGet(req *kvrpcpb.RawGetRequest) *kvrpcpb.RawGetResponse {
@@ -531,7 +541,7 @@ func (c *RPCClient) SendReq(ctx goctx.Context, addr string, req *tikvrpc.Request
 			resp.DeleteRange = &kvrpcpb.DeleteRangeResponse{RegionError: err}
 			return resp, nil
 		}
-		resp.DeleteRange = &kvrpcpb.DeleteRangeResponse{}
+		resp.DeleteRange = handler.handleKvDeleteRange(r)
 	case tikvrpc.CmdRawGet:
 		r := req.RawGet
 		if err := handler.checkRequest(reqCtx, r.Size()); err != nil {
@@ -599,7 +609,10 @@ func (c *RPCClient) SendReq(ctx goctx.Context, addr string, req *tikvrpc.Request
 	return resp, nil
 }
 
-// Close closes the client.
+// Close closes the client, the MvccStore is closed as well if it can be closed.
 func (c *RPCClient) Close() error {
+	if closer, ok := c.MvccStore.(io.Closer); ok {
+		return closer.Close()
+	}
 	return nil
 }
@@ -23,6 +23,9 @@ import (
 type Oracle interface {
 	GetTimestamp(ctx goctx.Context) (uint64, error)
 	GetTimestampAsync(ctx goctx.Context) Future
+	// GetLowResolutionTimestamp returns a recent timestamp without getting a new
+	// one from the source, it may lag behind the latest timestamp.
+	GetLowResolutionTimestamp() (uint64, error)
 	IsExpired(lockTimestamp uint64, TTL uint64) bool
 	Close()
 }
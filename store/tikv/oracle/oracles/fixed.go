@@ -0,0 +1,93 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracles
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	goctx "golang.org/x/net/context"
+)
+
+var _ oracle.Oracle = &FixedOracle{}
+
+// FixedOracle is an Oracle whose clock only moves by Advance, it's used for
+// deterministic testing.
+type FixedOracle struct {
+	mu       sync.Mutex
+	physical int64
+	lastTS   uint64
+}
+
+// NewFixedOracle creates a FixedOracle, the timestamps it gives are after baseTS.
+func NewFixedOracle(baseTS uint64) *FixedOracle {
+	return &FixedOracle{
+		physical: oracle.ExtractPhysical(baseTS),
+		lastTS:   baseTS,
+	}
+}
+
+// Advance moves the clock forward by d, in millisecond precision.
+func (o *FixedOracle) Advance(d time.Duration) {
+	o.mu.Lock()
+	o.physical += int64(d / time.Millisecond)
+	o.mu.Unlock()
+}
+
+// GetTimestamp gets the timestamp of the current clock, the logical part is
+// increased if the clock doesn't move since the last one.
+func (o *FixedOracle) GetTimestamp(goctx.Context) (uint64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ts := oracle.ComposeTS(o.physical, 0)
+	if ts <= o.lastTS {
+		ts = o.lastTS + 1
+	}
+	o.lastTS = ts
+	return ts, nil
+}
+
+// GetTimestampAsync implements oracle.Oracle interface.
+func (o *FixedOracle) GetTimestampAsync(ctx goctx.Context) oracle.Future {
+	return &fixedFuture{ctx: ctx, o: o}
+}
+
+// GetLowResolutionTimestamp returns the last timestamp it gives, or baseTS if
+// it gives none.
+func (o *FixedOracle) GetLowResolutionTimestamp() (uint64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.lastTS, nil
+}
+
+// IsExpired checks the lock against the current clock.
+func (o *FixedOracle) IsExpired(lockTS uint64, TTL uint64) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.physical >= oracle.ExtractPhysical(lockTS)+int64(TTL)
+}
+
+// Close implements oracle.Oracle interface.
+func (o *FixedOracle) Close() {
+}
+
+type fixedFuture struct {
+	ctx goctx.Context
+	o   *FixedOracle
+}
+
+func (f *fixedFuture) Wait() (uint64, error) {
+	return f.o.GetTimestamp(f.ctx)
+}
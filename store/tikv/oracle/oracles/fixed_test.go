@@ -0,0 +1,51 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"golang.org/x/net/context"
+)
+
+func TestFixedOracle(t *testing.T) {
+	baseTS := oracle.ComposeTS(1000, 0)
+	o := NewFixedOracle(baseTS)
+	defer o.Close()
+	if ts, _ := o.GetLowResolutionTimestamp(); ts != baseTS {
+		t.Errorf("low resolution ts %d, expect %d", ts, baseTS)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		if ts, _ := o.GetTimestamp(context.Background()); ts != baseTS+i {
+			t.Errorf("ts %d, expect %d", ts, baseTS+i)
+		}
+	}
+	if o.IsExpired(baseTS, 10) {
+		t.Error("should not expired")
+	}
+
+	o.Advance(10 * time.Millisecond)
+	ts, _ := o.GetTimestampAsync(context.Background()).Wait()
+	if ts != oracle.ComposeTS(1010, 0) {
+		t.Errorf("ts %d, expect %d", ts, oracle.ComposeTS(1010, 0))
+	}
+	if lowTS, _ := o.GetLowResolutionTimestamp(); lowTS != ts {
+		t.Errorf("low resolution ts %d, expect %d", lowTS, ts)
+	}
+	if !o.IsExpired(baseTS, 10) {
+		t.Error("should expired")
+	}
+}
@@ -59,6 +59,11 @@ func (l *localOracle) GetTimestampAsync(ctx goctx.Context) oracle.Future {
 	}
 }
 
+// GetLowResolutionTimestamp gets a new timestamp, it costs nothing to get one from local time.
+func (l *localOracle) GetLowResolutionTimestamp() (uint64, error) {
+	return l.GetTimestamp(goctx.Background())
+}
+
 type future struct {
 	ctx goctx.Context
 	l   *localOracle
@@ -33,6 +33,8 @@ type pdOracle struct {
 	c      pd.Client
 	lastTS uint64
 	quit   chan struct{}
+	// intervalCh sends the new update interval to updateTS.
+	intervalCh chan time.Duration
 }
 
 // NewPdOracle create an Oracle that uses a pd client source.
@@ -42,8 +44,9 @@ type pdOracle struct {
 // itself to keep up with the timestamp on PD server.
 func NewPdOracle(pdClient pd.Client, updateInterval time.Duration) (oracle.Oracle, error) {
 	o := &pdOracle{
-		c:    pdClient,
-		quit: make(chan struct{}),
+		c:          pdClient,
+		quit:       make(chan struct{}),
+		intervalCh: make(chan time.Duration),
 	}
 	ctx := goctx.TODO()
 	go o.updateTS(ctx, updateInterval)
@@ -94,6 +97,16 @@ func (o *pdOracle) GetTimestampAsync(ctx goctx.Context) oracle.Future {
 	return &tsFuture{ts, o}
 }
 
+// GetLowResolutionTimestamp returns the `lastTS` got from PD server, it's updated
+// at least every `updateInterval`, so it may lag by up to `updateInterval`.
+func (o *pdOracle) GetLowResolutionTimestamp() (uint64, error) {
+	lastTS := atomic.LoadUint64(&o.lastTS)
+	if lastTS == 0 {
+		return 0, errors.New("pd oracle has not got any timestamp")
+	}
+	return lastTS, nil
+}
+
 func (o *pdOracle) getTimestamp(ctx goctx.Context) (uint64, error) {
 	now := time.Now()
 	physical, logical, err := o.c.GetTS(ctx)
@@ -125,6 +138,9 @@ func (o *pdOracle) updateTS(ctx goctx.Context, interval time.Duration) {
 				break
 			}
 			o.setLastTS(ts)
+		case interval = <-o.intervalCh:
+			ticker.Stop()
+			ticker = time.NewTicker(interval)
 		case <-o.quit:
 			ticker.Stop()
 			return
@@ -132,6 +148,15 @@ func (o *pdOracle) updateTS(ctx goctx.Context, interval time.Duration) {
 	}
 }
 
+// SetUpdateInterval changes the interval to update `lastTS`, the next update
+// is after the new interval. It does nothing if the oracle is closed.
+func (o *pdOracle) SetUpdateInterval(interval time.Duration) {
+	select {
+	case o.intervalCh <- interval:
+	case <-o.quit:
+	}
+}
+
 func (o *pdOracle) Close() {
 	close(o.quit)
 }
@@ -25,6 +25,39 @@ type codecPDClient struct {
 	pd.Client
 }
 
+// storeLister is implemented by the PD clients which can list all the stores.
+type storeLister interface {
+	GetAllStores(ctx context.Context) ([]*metapb.Store, error)
+}
+
+// GetAllStores forwards the call to the underlying client if it can list stores.
+func (c *codecPDClient) GetAllStores(ctx context.Context) ([]*metapb.Store, error) {
+	lister, ok := c.Client.(storeLister)
+	if !ok {
+		return nil, errors.New("pd client doesn't support listing stores")
+	}
+	stores, err := lister.GetAllStores(ctx)
+	return stores, errors.Trace(err)
+}
+
+// errSafePointNotSupported is returned if the PD client can't load the GC safepoint.
+var errSafePointNotSupported = errors.New("pd client doesn't support loading gc safepoint")
+
+// safePointLoader is implemented by the PD clients which can load the GC safepoint.
+type safePointLoader interface {
+	GetGCSafePoint(ctx context.Context) (uint64, error)
+}
+
+// GetGCSafePoint forwards the call to the underlying client if it can load the safepoint.
+func (c *codecPDClient) GetGCSafePoint(ctx context.Context) (uint64, error) {
+	loader, ok := c.Client.(safePointLoader)
+	if !ok {
+		return 0, errSafePointNotSupported
+	}
+	safePoint, err := loader.GetGCSafePoint(ctx)
+	return safePoint, errors.Trace(err)
+}
+
 // GetRegion encodes the key before send requests to pd-server and decodes the
 // returned StartKey && EndKey from pd-server.
 func (c *codecPDClient) GetRegion(ctx context.Context, key []byte) (*metapb.Region, *metapb.Peer, error) {
@@ -0,0 +1,104 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/pd/pd-client"
+	goctx "golang.org/x/net/context"
+)
+
+// reconnectPDClient forwards the calls to the current PD client, which is
+// replaced by reconnect. The oracle and the region cache hold it instead of
+// the current client, so they use the new one after reconnecting.
+type reconnectPDClient struct {
+	mu      sync.RWMutex
+	client  pd.Client
+	connect func() (pd.Client, error)
+}
+
+func newReconnectPDClient(client pd.Client, connect func() (pd.Client, error)) *reconnectPDClient {
+	return &reconnectPDClient{client: client, connect: connect}
+}
+
+func (c *reconnectPDClient) current() pd.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// reconnect creates a new PD client and swaps it in, the old one is closed.
+func (c *reconnectPDClient) reconnect() error {
+	client, err := c.connect()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.mu.Lock()
+	old := c.client
+	c.client = client
+	c.mu.Unlock()
+	old.Close()
+	return nil
+}
+
+func (c *reconnectPDClient) GetClusterID(ctx goctx.Context) uint64 {
+	return c.current().GetClusterID(ctx)
+}
+
+func (c *reconnectPDClient) GetTS(ctx goctx.Context) (int64, int64, error) {
+	return c.current().GetTS(ctx)
+}
+
+func (c *reconnectPDClient) GetTSAsync(ctx goctx.Context) pd.TSFuture {
+	return c.current().GetTSAsync(ctx)
+}
+
+func (c *reconnectPDClient) GetRegion(ctx goctx.Context, key []byte) (*metapb.Region, *metapb.Peer, error) {
+	return c.current().GetRegion(ctx, key)
+}
+
+func (c *reconnectPDClient) GetRegionByID(ctx goctx.Context, regionID uint64) (*metapb.Region, *metapb.Peer, error) {
+	return c.current().GetRegionByID(ctx, regionID)
+}
+
+func (c *reconnectPDClient) GetStore(ctx goctx.Context, storeID uint64) (*metapb.Store, error) {
+	return c.current().GetStore(ctx, storeID)
+}
+
+// GetAllStores forwards the call to the current client if it can list stores.
+func (c *reconnectPDClient) GetAllStores(ctx goctx.Context) ([]*metapb.Store, error) {
+	lister, ok := c.current().(storeLister)
+	if !ok {
+		return nil, errors.New("pd client doesn't support listing stores")
+	}
+	stores, err := lister.GetAllStores(ctx)
+	return stores, errors.Trace(err)
+}
+
+// GetGCSafePoint forwards the call to the current client if it can load the safepoint.
+func (c *reconnectPDClient) GetGCSafePoint(ctx goctx.Context) (uint64, error) {
+	loader, ok := c.current().(safePointLoader)
+	if !ok {
+		return 0, errSafePointNotSupported
+	}
+	safePoint, err := loader.GetGCSafePoint(ctx)
+	return safePoint, errors.Trace(err)
+}
+
+func (c *reconnectPDClient) Close() {
+	c.current().Close()
+}
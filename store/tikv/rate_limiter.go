@@ -0,0 +1,85 @@
+// Copyright 2017 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	goctx "golang.org/x/net/context"
+)
+
+// rateLimiter is a token bucket, it's refilled at rate tokens per second and
+// holds at most a second of tokens, so a burst after idling is bounded too.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	// reject makes wait return ErrRateLimited instead of blocking.
+	reject bool
+}
+
+func newRateLimiter(perSec int, reject bool) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(perSec),
+		tokens: float64(perSec),
+		last:   time.Now(),
+		reject: reject,
+	}
+}
+
+// take takes a token, it returns how long the caller should wait for it. If
+// there is no token and block is false, it takes nothing and returns false.
+func (l *rateLimiter) take(block bool) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+	if !block {
+		return 0, false
+	}
+	// Borrow the token, the later callers wait longer.
+	l.tokens--
+	return time.Duration(-l.tokens / l.rate * float64(time.Second)), true
+}
+
+// wait waits for a token until ctx is done, or returns ErrRateLimited at once
+// if there is no token and reject is set.
+func (l *rateLimiter) wait(ctx goctx.Context) error {
+	d, ok := l.take(!l.reject)
+	if !ok {
+		return errors.Trace(ErrRateLimited)
+	}
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+}
@@ -49,7 +49,7 @@ func NewRawKVClient(pdAddrs []string) (*RawKVClient, error) {
 		clusterID:   pdCli.GetClusterID(goctx.TODO()),
 		regionCache: NewRegionCache(pdCli),
 		pdClient:    pdCli,
-		rpcClient:   newRPCClient(),
+		rpcClient:   newRPCClient(0),
 	}, nil
 }
 
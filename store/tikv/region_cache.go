@@ -33,11 +33,18 @@ type RegionCache struct {
 		sync.RWMutex
 		regions map[RegionVerID]*Region
 		sorted  *llrb.LLRB
+		// dropped collects the regions dropped while holding the lock, they're
+		// passed to the invalidate callbacks after the lock is released.
+		dropped []RegionVerID
 	}
 	storeMu struct {
 		sync.RWMutex
 		stores map[uint64]*Store
 	}
+	invalidateMu struct {
+		sync.RWMutex
+		callbacks []func(RegionVerID)
+	}
 }
 
 // NewRegionCache creates a RegionCache.
@@ -51,6 +58,35 @@ func NewRegionCache(pdClient pd.Client) *RegionCache {
 	return c
 }
 
+// OnRegionInvalidate registers f to be called with the region's VerID whenever a
+// region is dropped from the cache. f is called without holding the cache lock,
+// so it may use the cache.
+func (c *RegionCache) OnRegionInvalidate(f func(RegionVerID)) {
+	c.invalidateMu.Lock()
+	c.invalidateMu.callbacks = append(c.invalidateMu.callbacks, f)
+	c.invalidateMu.Unlock()
+}
+
+// unlockAndNotify releases c.mu, then calls the invalidate callbacks with the
+// regions dropped while holding it.
+func (c *RegionCache) unlockAndNotify() {
+	dropped := c.mu.dropped
+	c.mu.dropped = nil
+	c.mu.Unlock()
+	if len(dropped) == 0 {
+		return
+	}
+
+	c.invalidateMu.RLock()
+	callbacks := c.invalidateMu.callbacks
+	c.invalidateMu.RUnlock()
+	for _, id := range dropped {
+		for _, f := range callbacks {
+			f(id)
+		}
+	}
+}
+
 // RPCContext contains data that is needed to send RPC to a region.
 type RPCContext struct {
 	Region RegionVerID
@@ -127,7 +163,7 @@ func (c *RegionCache) LocateKey(bo *Backoffer, key []byte) (*KeyLocation, error)
 	}
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlockAndNotify()
 	r = c.insertRegionToCache(r)
 	return &KeyLocation{
 		Region:   r.VerID(),
@@ -156,7 +192,7 @@ func (c *RegionCache) LocateRegionByID(bo *Backoffer, regionID uint64) (*KeyLoca
 	}
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlockAndNotify()
 	r = c.insertRegionToCache(r)
 	return &KeyLocation{
 		Region:   r.VerID(),
@@ -208,7 +244,7 @@ func (c *RegionCache) ListRegionIDsInKeyRange(bo *Backoffer, startKey, endKey []
 // DropRegion removes a cached Region.
 func (c *RegionCache) DropRegion(id RegionVerID) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlockAndNotify()
 
 	c.dropRegionFromCache(id)
 }
@@ -216,7 +252,7 @@ func (c *RegionCache) DropRegion(id RegionVerID) {
 // UpdateLeader update some region cache with newer leader info.
 func (c *RegionCache) UpdateLeader(regionID RegionVerID, leaderStoreID uint64) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlockAndNotify()
 
 	r, ok := c.mu.regions[regionID]
 	if !ok {
@@ -230,6 +266,17 @@ func (c *RegionCache) UpdateLeader(regionID RegionVerID, leaderStoreID uint64) {
 	}
 }
 
+// cachedCount returns the number of the regions and the stores in the cache.
+func (c *RegionCache) cachedCount() (regionCount, storeCount int) {
+	c.mu.RLock()
+	regionCount = len(c.mu.regions)
+	c.mu.RUnlock()
+	c.storeMu.RLock()
+	storeCount = len(c.storeMu.stores)
+	c.storeMu.RUnlock()
+	return
+}
+
 func (c *RegionCache) getRegionFromCache(key []byte) *Region {
 	var r *Region
 	c.mu.sorted.DescendLessOrEqual(newRBSearchItem(key), func(item llrb.Item) bool {
@@ -250,7 +297,9 @@ func (c *RegionCache) insertRegionToCache(r *Region) *Region {
 	}
 	old := c.mu.sorted.ReplaceOrInsert(newRBItem(r))
 	if old != nil {
-		delete(c.mu.regions, old.(*llrbItem).region.VerID())
+		oldID := old.(*llrbItem).region.VerID()
+		delete(c.mu.regions, oldID)
+		c.mu.dropped = append(c.mu.dropped, oldID)
 	}
 	c.mu.regions[r.VerID()] = r
 	return r
@@ -273,6 +322,7 @@ func (c *RegionCache) dropRegionFromCache(verID RegionVerID) {
 	}
 	c.mu.sorted.Delete(newRBItem(r))
 	delete(c.mu.regions, r.VerID())
+	c.mu.dropped = append(c.mu.dropped, r.VerID())
 }
 
 // loadRegion loads region from pd client, and picks the first peer as leader.
@@ -408,7 +458,7 @@ func (c *RegionCache) OnRequestFail(ctx *RPCContext, err error) {
 			c.dropRegionFromCache(regionID)
 		}
 	}
-	c.mu.Unlock()
+	c.unlockAndNotify()
 
 	// Store's meta may be out of date.
 	storeID := ctx.KVCtx.GetPeer().GetStoreId()
@@ -424,13 +474,13 @@ func (c *RegionCache) OnRequestFail(ctx *RPCContext, err error) {
 			c.dropRegionFromCache(id)
 		}
 	}
-	c.mu.Unlock()
+	c.unlockAndNotify()
 }
 
 // OnRegionStale removes the old region and inserts new regions into the cache.
 func (c *RegionCache) OnRegionStale(ctx *RPCContext, newRegions []*metapb.Region) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlockAndNotify()
 
 	c.dropRegionFromCache(ctx.Region)
 
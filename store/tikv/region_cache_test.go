@@ -225,6 +225,37 @@ func (s *testRegionCacheSuite) TestMerge(c *C) {
 	s.checkCache(c, 1)
 }
 
+func (s *testRegionCacheSuite) TestOnRegionInvalidate(c *C) {
+	var dropped1, dropped2 []RegionVerID
+	s.cache.OnRegionInvalidate(func(id RegionVerID) {
+		dropped1 = append(dropped1, id)
+		// The callback is called outside the lock, so it can use the cache.
+		_, err := s.cache.LocateKey(s.bo, []byte("a"))
+		c.Assert(err, IsNil)
+	})
+	s.cache.OnRegionInvalidate(func(id RegionVerID) {
+		dropped2 = append(dropped2, id)
+	})
+
+	loc, err := s.cache.LocateKey(s.bo, []byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(dropped1, HasLen, 0)
+	s.cache.DropRegion(loc.Region)
+	c.Assert(dropped1, DeepEquals, []RegionVerID{loc.Region})
+	c.Assert(dropped2, DeepEquals, []RegionVerID{loc.Region})
+
+	// The region is loaded again by the first callback, dropping it again
+	// because the new leader is unknown notifies both callbacks.
+	s.checkCache(c, 1)
+	s.cache.UpdateLeader(loc.Region, 0)
+	c.Assert(dropped1, DeepEquals, []RegionVerID{loc.Region, loc.Region})
+	c.Assert(dropped2, DeepEquals, []RegionVerID{loc.Region, loc.Region})
+
+	// Dropping a region not in the cache doesn't call the callbacks.
+	s.cache.DropRegion(RegionVerID{id: s.region1 + 100})
+	c.Assert(dropped2, HasLen, 2)
+}
+
 func (s *testRegionCacheSuite) TestReconnect(c *C) {
 	loc, err := s.cache.LocateKey(s.bo, []byte("a"))
 	c.Assert(err, IsNil)
@@ -47,6 +47,15 @@ type RegionRequestSender struct {
 	client         Client
 	isolationLevel kvrpcpb.IsolationLevel
 	storeAddr      string
+	stats          SendReqStats
+}
+
+// SendReqStats is the retry information of the last request sent by a RegionRequestSender.
+type SendReqStats struct {
+	// Attempts is the number of times the request is sent to TiKV.
+	Attempts int
+	// LeaderChanged is true if TiKV reports NotLeader for the request.
+	LeaderChanged bool
 }
 
 // NewRegionRequestSender creates a new sender.
@@ -58,8 +67,14 @@ func NewRegionRequestSender(regionCache *RegionCache, client Client, isolationLe
 	}
 }
 
+// Stats returns the retry information of the last request.
+func (s *RegionRequestSender) Stats() SendReqStats {
+	return s.stats
+}
+
 // SendReq sends a request to tikv server.
 func (s *RegionRequestSender) SendReq(bo *Backoffer, req *tikvrpc.Request, regionID RegionVerID, timeout time.Duration) (*tikvrpc.Response, error) {
+	s.stats = SendReqStats{}
 	for {
 		ctx, err := s.regionCache.GetRPCContext(bo, regionID)
 		if err != nil {
@@ -108,6 +123,7 @@ func (s *RegionRequestSender) sendReqToRegion(bo *Backoffer, ctx *RPCContext, re
 	}
 	context, cancel := goctx.WithTimeout(bo.ctx, timeout)
 	defer cancel()
+	s.stats.Attempts++
 	resp, err = s.client.SendReq(context, ctx.Addr, req)
 	if err != nil {
 		if e := s.onSendFail(bo, ctx, err); e != nil {
@@ -150,6 +166,7 @@ func (s *RegionRequestSender) onRegionError(bo *Backoffer, ctx *RPCContext, regi
 	if notLeader := regionErr.GetNotLeader(); notLeader != nil {
 		// Retry if error is `NotLeader`.
 		log.Debugf("tikv reports `NotLeader`: %s, ctx: %s, retry later", notLeader, ctx.KVCtx)
+		s.stats.LeaderChanged = true
 		s.regionCache.UpdateLeader(ctx.Region, notLeader.GetLeader().GetStoreId())
 		if notLeader.GetLeader() == nil {
 			err = bo.Backoff(boRegionMiss, errors.Errorf("not leader: %v, ctx: %s", notLeader, ctx.KVCtx))
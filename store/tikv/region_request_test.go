@@ -238,7 +238,7 @@ func (s *testRegionRequestSuite) TestNoReloadRegionForGrpcWhenCtxCanceled(c *C)
 		wg.Done()
 	}()
 
-	client := newRPCClient()
+	client := newRPCClient(0)
 	sender := NewRegionRequestSender(s.cache, client, kvrpcpb.IsolationLevel_SI)
 	req := &tikvrpc.Request{
 		Type: tikvrpc.CmdRawPut,
@@ -258,7 +258,7 @@ func (s *testRegionRequestSuite) TestNoReloadRegionForGrpcWhenCtxCanceled(c *C)
 
 	// Just for covering error code = codes.Canceled.
 	client1 := &cancelContextClient{
-		Client:       newRPCClient(),
+		Client:       newRPCClient(0),
 		redirectAddr: addr,
 	}
 	sender = NewRegionRequestSender(s.cache, client1, kvrpcpb.IsolationLevel_SI)
@@ -30,19 +30,25 @@ type Scanner struct {
 	cache        []*pb.KvPair
 	idx          int
 	nextStartKey []byte
-	eof          bool
+	// endKey is the exclusive upper bound of the keys, nil means unbounded.
+	endKey []byte
+	eof    bool
 }
 
-func newScanner(snapshot *tikvSnapshot, startKey []byte, batchSize int) (*Scanner, error) {
+func newScanner(snapshot *tikvSnapshot, startKey []byte, endKey []byte, batchSize int) (*Scanner, error) {
 	// It must be > 1. Otherwise scanner won't skipFirst.
 	if batchSize <= 1 {
 		batchSize = scanBatchSize
 	}
+	if err := snapshot.store.CheckVisibility(snapshot.version.Ver); err != nil {
+		return nil, errors.Trace(err)
+	}
 	scanner := &Scanner{
 		snapshot:     snapshot,
 		batchSize:    batchSize,
 		valid:        true,
 		nextStartKey: startKey,
+		endKey:       endKey,
 	}
 	err := scanner.Next()
 	if kv.IsErrNotFound(err) {
@@ -74,7 +80,7 @@ func (s *Scanner) Value() []byte {
 
 // Next return next element.
 func (s *Scanner) Next() error {
-	bo := NewBackoffer(scannerNextMaxBackoff, goctx.Background())
+	bo := s.snapshot.store.newBackoffer(scannerNextMaxBackoff, goctx.Background())
 	if !s.valid {
 		return errors.New("scanner iterator is invalid")
 	}
@@ -94,6 +100,10 @@ func (s *Scanner) Next() error {
 				continue
 			}
 		}
+		if len(s.endKey) > 0 && s.Key().Cmp(s.endKey) >= 0 {
+			s.Close()
+			return nil
+		}
 		if err := s.resolveCurrentLock(bo); err != nil {
 			s.Close()
 			return errors.Trace(err)
@@ -147,7 +157,7 @@ func (s *Scanner) getData(bo *Backoffer) error {
 				Version:  s.startTS(),
 			},
 		}
-		resp, err := sender.SendReq(bo, req, loc.Region, readTimeoutMedium)
+		resp, err := sender.SendReq(bo, req, loc.Region, s.snapshot.getScanTimeout())
 		if err != nil {
 			return errors.Trace(err)
 		}
@@ -185,8 +195,8 @@ func (s *Scanner) getData(bo *Backoffer) error {
 			// No more data in current Region. Next getData() starts
 			// from current Region's endKey.
 			s.nextStartKey = loc.EndKey
-			if len(loc.EndKey) == 0 {
-				// Current Region is the last one.
+			if len(loc.EndKey) == 0 || (len(s.endKey) > 0 && kv.Key(loc.EndKey).Cmp(s.endKey) >= 0) {
+				// Current Region is the last one, or the last one in the range.
 				s.eof = true
 			}
 			return nil
@@ -14,8 +14,12 @@
 package tikv
 
 import (
+	"sync"
+
 	. "github.com/pingcap/check"
 	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv/tikvrpc"
+	goctx "golang.org/x/net/context"
 )
 
 type testScanMockSuite struct {
@@ -41,7 +45,7 @@ func (s *testScanMockSuite) TestScanMultipleRegions(c *C) {
 	txn, err = store.Begin()
 	c.Assert(err, IsNil)
 	snapshot := newTiKVSnapshot(store, kv.Version{Ver: txn.StartTS()})
-	scanner, err := newScanner(snapshot, []byte("a"), 10)
+	scanner, err := newScanner(snapshot, []byte("a"), nil, 10)
 	c.Assert(err, IsNil)
 	for ch := byte('a'); ch <= byte('z'); ch++ {
 		c.Assert([]byte{ch}, BytesEquals, []byte(scanner.Key()))
@@ -49,3 +53,78 @@ func (s *testScanMockSuite) TestScanMultipleRegions(c *C) {
 	}
 	c.Assert(scanner.Valid(), IsFalse)
 }
+
+// scanRecordClient records the scan requests.
+type scanRecordClient struct {
+	Client
+	mu    sync.Mutex
+	scans []*tikvrpc.Request
+}
+
+func (c *scanRecordClient) SendReq(ctx goctx.Context, addr string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+	if req.Type == tikvrpc.CmdScan {
+		c.mu.Lock()
+		c.scans = append(c.scans, req)
+		c.mu.Unlock()
+	}
+	return c.Client.SendReq(ctx, addr, req)
+}
+
+func (s *testScanMockSuite) TestIterWithBatchSize(c *C) {
+	var client *scanRecordClient
+	kvStore, err := NewMockTikvStore(WithRegionSplit([][]byte{[]byte("h"), []byte("p")}), WithHijackClient(func(c Client) Client {
+		client = &scanRecordClient{Client: c}
+		return client
+	}))
+	c.Assert(err, IsNil)
+	defer kvStore.Close()
+
+	txn, err := kvStore.Begin()
+	c.Assert(err, IsNil)
+	for ch := byte('a'); ch <= byte('z'); ch++ {
+		err = txn.Set([]byte{ch}, []byte{ch})
+		c.Assert(err, IsNil)
+	}
+	err = txn.Commit()
+	c.Assert(err, IsNil)
+
+	ver, err := kvStore.CurrentVersion()
+	c.Assert(err, IsNil)
+	snapshot, err := kvStore.GetSnapshot(ver)
+	c.Assert(err, IsNil)
+	iterSnapshot, ok := snapshot.(interface {
+		IterWithBatchSize(startKey, endKey kv.Key, batchSize int) (kv.Iterator, error)
+	})
+	c.Assert(ok, IsTrue)
+	iter, err := iterSnapshot.IterWithBatchSize([]byte("c"), []byte("t"), 3)
+	c.Assert(err, IsNil)
+	for ch := byte('c'); ch < byte('t'); ch++ {
+		c.Assert(iter.Valid(), IsTrue)
+		c.Assert([]byte(iter.Key()), BytesEquals, []byte{ch})
+		c.Assert(iter.Next(), IsNil)
+	}
+	c.Assert(iter.Valid(), IsFalse)
+	// The batch size reaches every scan request, and the region after endKey isn't scanned.
+	c.Assert(len(client.scans) >= 7, IsTrue, Commentf("%d scans", len(client.scans)))
+	for _, req := range client.scans {
+		c.Assert(req.Scan.GetLimit(), Equals, uint32(3))
+		c.Assert(kv.Key(req.Scan.GetStartKey()).Cmp([]byte("t")) < 0, IsTrue, Commentf("%q", req.Scan.GetStartKey()))
+	}
+
+	// An empty endKey means no upper bound.
+	client.scans = nil
+	iter, err = iterSnapshot.IterWithBatchSize([]byte("x"), nil, maxScanBatchSize)
+	c.Assert(err, IsNil)
+	for ch := byte('x'); ch <= byte('z'); ch++ {
+		c.Assert([]byte(iter.Key()), BytesEquals, []byte{ch})
+		c.Assert(iter.Next(), IsNil)
+	}
+	c.Assert(iter.Valid(), IsFalse)
+	c.Assert(client.scans, HasLen, 1)
+	c.Assert(client.scans[0].Scan.GetLimit(), Equals, uint32(maxScanBatchSize))
+
+	for _, batchSize := range []int{-1, 0, 1, maxScanBatchSize + 1} {
+		_, err = iterSnapshot.IterWithBatchSize([]byte("a"), nil, batchSize)
+		c.Assert(err, NotNil)
+	}
+}
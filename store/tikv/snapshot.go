@@ -33,6 +33,11 @@ var (
 const (
 	scanBatchSize = 256
 	batchGetSize  = 5120
+	// minScanBatchSize and maxScanBatchSize are the bounds of the batch size
+	// of IterWithBatchSize, the scanner can't skip the first key of the next
+	// batch unless the batch size is greater than 1.
+	minScanBatchSize = 2
+	maxScanBatchSize = 10240
 )
 
 // tikvSnapshot implements MvccSnapshot interface.
@@ -41,6 +46,18 @@ type tikvSnapshot struct {
 	version        kv.Version
 	isolationLevel kv.IsoLevel
 	priority       pb.CommandPri
+	// scanTimeout is the timeout of each scan request, 0 means readTimeoutMedium.
+	scanTimeout time.Duration
+}
+
+// SnapshotOptions controls the requests sent by a snapshot, the zero value
+// is the default used by GetSnapshot.
+type SnapshotOptions struct {
+	// Priority is the priority of the requests, e.g. CommandPri_Low for
+	// background reads so they don't starve the OLTP traffic.
+	Priority pb.CommandPri
+	// ScanTimeout is the timeout of each scan request, 0 means the default.
+	ScanTimeout time.Duration
 }
 
 // newTiKVSnapshot creates a snapshot of an TiKV store.
@@ -53,6 +70,13 @@ func newTiKVSnapshot(store *tikvStore, ver kv.Version) *tikvSnapshot {
 	}
 }
 
+func (s *tikvSnapshot) getScanTimeout() time.Duration {
+	if s.scanTimeout > 0 {
+		return s.scanTimeout
+	}
+	return readTimeoutMedium
+}
+
 // BatchGet gets all the keys' value from kv-server and returns a map contains key/value pairs.
 // The map will not contain nonexistent keys.
 func (s *tikvSnapshot) BatchGet(keys []kv.Key) (map[string][]byte, error) {
@@ -60,9 +84,17 @@ func (s *tikvSnapshot) BatchGet(keys []kv.Key) (map[string][]byte, error) {
 	start := time.Now()
 	defer func() { txnCmdHistogram.WithLabelValues("batch_get").Observe(time.Since(start).Seconds()) }()
 
+	if err := s.store.CheckVisibility(s.version.Ver); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	m, err := s.batchGet(s.store.newBackoffer(batchGetMaxBackoff, goctx.Background()), keys)
+	return m, errors.Trace(err)
+}
+
+func (s *tikvSnapshot) batchGet(bo *Backoffer, keys []kv.Key) (map[string][]byte, error) {
 	// We want [][]byte instead of []kv.Key, use some magic to save memory.
 	bytesKeys := *(*[][]byte)(unsafe.Pointer(&keys))
-	bo := NewBackoffer(batchGetMaxBackoff, goctx.Background())
 
 	// Create a map to collect key-values from region servers.
 	var mu sync.Mutex
@@ -187,7 +219,10 @@ func (s *tikvSnapshot) batchGetSingleRegion(bo *Backoffer, batch batchKeys, coll
 
 // Get gets the value for key k from snapshot.
 func (s *tikvSnapshot) Get(k kv.Key) ([]byte, error) {
-	val, err := s.get(NewBackoffer(getMaxBackoff, goctx.Background()), k)
+	if err := s.store.CheckVisibility(s.version.Ver); err != nil {
+		return nil, errors.Trace(err)
+	}
+	val, err := s.get(s.store.newBackoffer(getMaxBackoff, goctx.Background()), k)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -256,7 +291,18 @@ func (s *tikvSnapshot) get(bo *Backoffer, k kv.Key) ([]byte, error) {
 
 // Seek return a list of key-value pair after `k`.
 func (s *tikvSnapshot) Seek(k kv.Key) (kv.Iterator, error) {
-	scanner, err := newScanner(s, k, scanBatchSize)
+	scanner, err := newScanner(s, k, nil, scanBatchSize)
+	return scanner, errors.Trace(err)
+}
+
+// IterWithBatchSize returns an Iterator over the keys in [startKey, endKey),
+// it scans batchSize keys per request instead of the default 256, so the large
+// scans take fewer round trips. An empty endKey means no upper bound.
+func (s *tikvSnapshot) IterWithBatchSize(startKey, endKey kv.Key, batchSize int) (kv.Iterator, error) {
+	if batchSize < minScanBatchSize || batchSize > maxScanBatchSize {
+		return nil, errors.Errorf("scan batch size should be in [%d, %d], got %d", minScanBatchSize, maxScanBatchSize, batchSize)
+	}
+	scanner, err := newScanner(s, startKey, endKey, batchSize)
 	return scanner, errors.Trace(err)
 }
 
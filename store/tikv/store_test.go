@@ -14,9 +14,17 @@
 package tikv
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/juju/errors"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/kvproto/pkg/errorpb"
@@ -25,8 +33,13 @@ import (
 	"github.com/pingcap/pd/pd-client"
 	"github.com/pingcap/tidb"
 	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv/mock-tikv"
 	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/pingcap/tidb/store/tikv/oracle/oracles"
 	"github.com/pingcap/tidb/store/tikv/tikvrpc"
+	"github.com/pingcap/tidb/terror"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	goctx "golang.org/x/net/context"
 )
 
@@ -43,115 +56,2035 @@ func (s *testStoreSuite) SetUpTest(c *C) {
 }
 
 func (s *testStoreSuite) TestParsePath(c *C) {
-	etcdAddrs, disableGC, err := parsePath("tikv://node1:2379,node2:2379")
+	etcdAddrs, opts, err := parsePath("tikv://node1:2379,node2:2379")
 	c.Assert(err, IsNil)
 	c.Assert(etcdAddrs, DeepEquals, []string{"node1:2379", "node2:2379"})
-	c.Assert(disableGC, IsFalse)
+	c.Assert(opts.disableGC, IsFalse)
 
 	_, _, err = parsePath("tikv://node1:2379")
 	c.Assert(err, IsNil)
-	_, disableGC, err = parsePath("tikv://node1:2379?disableGC=true")
+	_, opts, err = parsePath("tikv://node1:2379?disableGC=true")
 	c.Assert(err, IsNil)
-	c.Assert(disableGC, IsTrue)
+	c.Assert(opts.disableGC, IsTrue)
+	c.Assert(opts.disableSafePointUpdate, IsFalse)
+	_, opts, err = parsePath("tikv://node1:2379?disableSafePointUpdate=true")
+	c.Assert(err, IsNil)
+	c.Assert(opts.disableSafePointUpdate, IsTrue)
+	_, _, err = parsePath("tikv://node1:2379?disableSafePointUpdate=yes")
+	c.Assert(err, NotNil)
+	c.Assert(opts.safePointFromPD, IsFalse)
+	_, opts, err = parsePath("tikv://node1:2379?safePointFromPD=true")
+	c.Assert(err, IsNil)
+	c.Assert(opts.safePointFromPD, IsTrue)
+
+	_, opts, err = parsePath("tikv://node1:2379?spStaleness=180s")
+	c.Assert(err, IsNil)
+	c.Assert(opts.maxSafePointStaleness, Equals, 180*time.Second)
+	_, _, err = parsePath("tikv://node1:2379?spStaleness=abc")
+	c.Assert(err, NotNil)
+	_, _, err = parsePath("tikv://node1:2379?spStaleness=-1s")
+	c.Assert(err, NotNil)
+
+	_, opts, err = parsePath("tikv://node1:2379?spRefresh=1s")
+	c.Assert(err, IsNil)
+	c.Assert(opts.safePointRefreshInterval, Equals, time.Second)
+	c.Assert(opts.maxSafePointStaleness, Equals, time.Duration(0))
+	_, _, err = parsePath("tikv://node1:2379?spRefresh=1")
+	c.Assert(err, NotNil)
+
+	_, opts, err = parsePath("tikv://node1:2379?gcLifeTime=1h")
+	c.Assert(err, IsNil)
+	c.Assert(opts.gcLifeTime, Equals, time.Hour)
+	_, _, err = parsePath("tikv://node1:2379?gcLifeTime=1m")
+	c.Assert(err, NotNil)
+	_, _, err = parsePath("tikv://node1:2379?gcLifeTime=-10m")
+	c.Assert(err, NotNil)
+
+	_, opts, err = parsePath("tikv://node1:2379?oracleUpdate=500ms")
+	c.Assert(err, IsNil)
+	c.Assert(opts.oracleUpdateInterval, Equals, 500*time.Millisecond)
+	_, _, err = parsePath("tikv://node1:2379?oracleUpdate=0s")
+	c.Assert(err, NotNil)
+	_, _, err = parsePath("tikv://node1:2379?oracleUpdate=500")
+	c.Assert(err, NotNil)
+
+	_, opts, err = parsePath("tikv://node1:2379?trackTxns=true")
+	c.Assert(err, IsNil)
+	c.Assert(opts.trackTxns, IsTrue)
+
+	_, opts, err = parsePath("tikv://node1:2379?slowReqLog=500ms")
+	c.Assert(err, IsNil)
+	c.Assert(opts.slowRequestThreshold, Equals, 500*time.Millisecond)
+	_, _, err = parsePath("tikv://node1:2379?slowReqLog=500")
+	c.Assert(err, NotNil)
+
+	_, opts, err = parsePath("tikv://node1:2379?grpcConnCount=4")
+	c.Assert(err, IsNil)
+	c.Assert(opts.grpcConnCount, Equals, 4)
+	_, _, err = parsePath("tikv://node1:2379?grpcConnCount=0")
+	c.Assert(err, NotNil)
+
+	_, opts, err = parsePath("tikv://node1:2379?allowFallbackOracle=true")
+	c.Assert(err, IsNil)
+	c.Assert(opts.allowFallbackOracle, IsTrue)
+
+	_, opts, err = parsePath("tikv://node1:2379?maxBackoff=500")
+	c.Assert(err, IsNil)
+	c.Assert(opts.maxBackoff, Equals, 500)
+	_, _, err = parsePath("tikv://node1:2379?maxBackoff=0")
+	c.Assert(err, NotNil)
+	_, _, err = parsePath("tikv://node1:2379?maxBackoff=1s")
+	c.Assert(err, NotNil)
+
+	_, opts, err = parsePath("tikv://node1:2379?storeName=mycluster")
+	c.Assert(err, IsNil)
+	c.Assert(opts.storeName, Equals, "mycluster")
+
+	_, opts, err = parsePath("tikv://node1:2379")
+	c.Assert(err, IsNil)
+	c.Assert(opts.oracleUpdateInterval, Equals, time.Duration(0))
+	c.Assert(opts.maxBackoff, Equals, 0)
+	c.Assert(opts.storeName, Equals, "")
+	_, _, err = parsePath("tikv://node1:2379?ca=/tmp/ca.pem&cert=/tmp/client.pem&key=/tmp/client-key.pem")
+	c.Assert(err, ErrorMatches, "connecting PD with TLS is not supported.*")
+	_, _, err = parsePath("tikv://node1:2379?key=/tmp/client-key.pem")
+	c.Assert(err, NotNil)
+}
+
+// closeRecordPDClient records whether it's closed.
+type closeRecordPDClient struct {
+	pd.Client
+	closed chan struct{}
+}
+
+func (c *closeRecordPDClient) Close() {
+	c.Client.Close()
+	close(c.closed)
+}
+
+type clusterIDPDClient struct {
+	pd.Client
+	clusterID uint64
+}
+
+func (c *clusterIDPDClient) GetClusterID(goctx.Context) uint64 {
+	return c.clusterID
+}
+
+func (s *testStoreSuite) TestStoreName(c *C) {
+	var clusterID uint64
+	defer func(f func([]string) (pd.Client, error)) { newPDClient = f }(newPDClient)
+	newPDClient = func([]string) (pd.Client, error) {
+		return &clusterIDPDClient{Client: mocktikv.NewPDClient(mocktikv.NewCluster()), clusterID: clusterID}, nil
+	}
+	open := func(path string) kv.Storage {
+		store, err := Driver{}.Open(path)
+		c.Assert(err, IsNil)
+		return store
+	}
+
+	clusterID = 100
+	store1 := open("tikv://127.0.0.1:2379?storeName=mycluster&disableSafePointUpdate=true")
+	defer store1.Close()
+	c.Assert(store1.UUID(), Equals, "mycluster")
+	c.Assert(open("tikv://127.0.0.1:2379?storeName=mycluster"), Equals, store1)
+
+	// The name is used by another cluster, fall back to the cluster ID.
+	clusterID = 200
+	store2 := open("tikv://127.0.0.1:2379?storeName=mycluster&disableSafePointUpdate=true")
+	defer store2.Close()
+	c.Assert(store2.UUID(), Equals, "tikv-200")
+}
+
+func (s *testStoreSuite) TestReopenClosedStore(c *C) {
+	defer func(f func([]string) (pd.Client, error)) { newPDClient = f }(newPDClient)
+	newPDClient = func([]string) (pd.Client, error) {
+		return &clusterIDPDClient{Client: mocktikv.NewPDClient(mocktikv.NewCluster()), clusterID: 300}, nil
+	}
+	path := "tikv://127.0.0.1:2379?disableSafePointUpdate=true"
+	store1, err := Driver{}.Open(path)
+	c.Assert(err, IsNil)
+	c.Assert(store1.Close(), IsNil)
+	c.Assert(store1.(*tikvStore).closed, IsTrue)
+
+	store2, err := Driver{}.Open(path)
+	c.Assert(err, IsNil)
+	c.Assert(store2, Not(Equals), store1)
+	_, err = store2.CurrentVersion()
+	c.Assert(err, IsNil)
+
+	// A closed store left in the cache is replaced too.
+	c.Assert(store2.Close(), IsNil)
+	mc.Lock()
+	mc.cache[store2.UUID()] = store2.(*tikvStore)
+	mc.Unlock()
+	store3, err := Driver{}.Open(path)
+	c.Assert(err, IsNil)
+	defer store3.Close()
+	c.Assert(store3, Not(Equals), store2)
+	c.Assert(store3.(*tikvStore).closed, IsFalse)
+	_, err = store3.CurrentVersion()
+	c.Assert(err, IsNil)
+}
+
+func (s *testStoreSuite) TestNewTikvStoreWithPDClient(c *C) {
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithSingleStore(cluster)
+	pdCli := &closeRecordPDClient{Client: mocktikv.NewPDClient(cluster), closed: make(chan struct{})}
+	client := mocktikv.NewRPCClient(cluster, mocktikv.NewMvccStore())
+	store, err := NewTikvStoreWithPDClient("shared-pd-client", pdCli, WithStoreClient(client), WithStoreOracleUpdateInterval(time.Second))
+	c.Assert(err, IsNil)
+	c.Assert(store.UUID(), Equals, "shared-pd-client")
+	c.Assert(store.(*tikvStore).enableGC, IsFalse)
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("a"), []byte("b")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+
+	// The shared client survives the store.
+	c.Assert(store.Close(), IsNil)
+	select {
+	case <-pdCli.closed:
+		c.Fatal("the shared pd client is closed")
+	default:
+	}
+	_, _, err = pdCli.GetTS(goctx.Background())
+	c.Assert(err, IsNil)
+	store, err = NewTikvStoreWithPDClient("shared-pd-client", pdCli, WithStoreClient(mocktikv.NewRPCClient(cluster, mocktikv.NewMvccStore())))
+	c.Assert(err, IsNil)
+	_, err = store.CurrentVersion()
+	c.Assert(err, IsNil)
+	c.Assert(store.Close(), IsNil)
+	pdCli.Close()
+
+	// The store closes the pd client it creates.
+	var owned *closeRecordPDClient
+	store, err = NewMockTikvStore(WithHijackPDClient(func(c pd.Client) pd.Client {
+		owned = &closeRecordPDClient{Client: c, closed: make(chan struct{})}
+		return owned
+	}))
+	c.Assert(err, IsNil)
+	c.Assert(store.Close(), IsNil)
+	select {
+	case <-owned.closed:
+	default:
+		c.Fatal("the pd client of the store isn't closed")
+	}
+}
+
+func (s *testStoreSuite) TestCloseTwice(c *C) {
+	store, err := NewMockTikvStore()
+	c.Assert(err, IsNil)
+	c.Assert(store.Close(), IsNil)
+	c.Assert(store.Close(), IsNil)
+
+	defer func(f func([]string) (pd.Client, error)) { newPDClient = f }(newPDClient)
+	newPDClient = func([]string) (pd.Client, error) {
+		return &clusterIDPDClient{Client: mocktikv.NewPDClient(mocktikv.NewCluster()), clusterID: 301}, nil
+	}
+	path := "tikv://127.0.0.1:2379?disableSafePointUpdate=true"
+	store1, err := Driver{}.Open(path)
+	c.Assert(err, IsNil)
+	c.Assert(store1.Close(), IsNil)
+	store2, err := Driver{}.Open(path)
+	c.Assert(err, IsNil)
+	defer store2.Close()
+	// Closing store1 again doesn't touch the store reopened in its place.
+	c.Assert(store1.Close(), IsNil)
+	mc.Lock()
+	cached := mc.cache[store2.UUID()]
+	_, closing := mc.closing[store2.UUID()]
+	mc.Unlock()
+	c.Assert(cached, Equals, store2.(*tikvStore))
+	c.Assert(closing, IsFalse)
+}
+
+func (s *testStoreSuite) TestPDLeaderAddr(c *C) {
+	c.Assert(s.store.ClusterID(), Equals, uint64(1))
+	leader, err := s.store.PDLeaderAddr(goctx.Background())
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, mockPDLeaderAddr)
+
+	var hasLeader atomic.Value
+	hasLeader.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/pd/api/v1/leader")
+		if !hasLeader.Load().(bool) {
+			http.Error(w, "no leader", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"name":"pd2","member_id":2,"peer_urls":["http://10.0.0.2:2380"],"client_urls":["http://10.0.0.2:2379"]}`)
+	}))
+	defer srv.Close()
+	defer func(f func([]string) (pd.Client, error)) { newPDClient = f }(newPDClient)
+	newPDClient = func([]string) (pd.Client, error) {
+		return &clusterIDPDClient{Client: mocktikv.NewPDClient(mocktikv.NewCluster()), clusterID: 302}, nil
+	}
+	// The first PD address is unreachable, the second one is tried then.
+	path := fmt.Sprintf("tikv://127.0.0.1:1,%s?disableSafePointUpdate=true", strings.TrimPrefix(srv.URL, "http://"))
+	store, err := Driver{}.Open(path)
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	c.Assert(ts.ClusterID(), Equals, uint64(302))
+	leader, err = ts.PDLeaderAddr(goctx.Background())
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, "10.0.0.2:2379")
+
+	hasLeader.Store(false)
+	_, err = ts.PDLeaderAddr(goctx.Background())
+	c.Assert(err, NotNil)
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	cancel()
+	_, err = ts.PDLeaderAddr(ctx)
+	c.Assert(errors.Cause(err), Equals, goctx.Canceled)
+}
+
+func (s *testStoreSuite) TestGrpcConnCount(c *C) {
+	defer func(f func([]string) (pd.Client, error)) { newPDClient = f }(newPDClient)
+	newPDClient = func([]string) (pd.Client, error) {
+		return &clusterIDPDClient{Client: mocktikv.NewPDClient(mocktikv.NewCluster()), clusterID: 400}, nil
+	}
+	var connCounts []uint32
+	defer func(f func(uint32) Client) { newStoreClient = f }(newStoreClient)
+	newStoreClient = func(connCount uint32) Client {
+		connCounts = append(connCounts, connCount)
+		return newRPCClient(connCount)
+	}
+
+	store, err := Driver{}.Open("tikv://127.0.0.1:2379?disableSafePointUpdate=true&grpcConnCount=4")
+	c.Assert(err, IsNil)
+	c.Assert(store.(*tikvStore).client.(*rpcClient).connCount, Equals, uint32(4))
+	c.Assert(store.Close(), IsNil)
+	store, err = Driver{}.Open("tikv://127.0.0.1:2379?disableSafePointUpdate=true")
+	c.Assert(err, IsNil)
+	c.Assert(store.(*tikvStore).client.(*rpcClient).connCount, Equals, uint32(maxConnectionNumber))
+	c.Assert(store.Close(), IsNil)
+	c.Assert(connCounts, DeepEquals, []uint32{4, 0})
+}
+
+func (s *testStoreSuite) TestFixedOracle(c *C) {
+	defer func(f func([]string) (pd.Client, error)) { newPDClient = f }(newPDClient)
+	newPDClient = func([]string) (pd.Client, error) {
+		return &clusterIDPDClient{Client: mocktikv.NewPDClient(mocktikv.NewCluster()), clusterID: 401}, nil
+	}
+
+	baseTS := oracle.ComposeTS(1000, 0)
+	store, err := Driver{}.Open(fmt.Sprintf("tikv://127.0.0.1:2379?disableSafePointUpdate=true&oracle=fixed&oracleBaseTS=%d", baseTS))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	o, ok := store.(*tikvStore).oracle.(*oracles.FixedOracle)
+	c.Assert(ok, IsTrue)
+
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.StartTS(), Equals, baseTS+1)
+	c.Assert(txn.Rollback(), IsNil)
+	txn, err = store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.StartTS(), Equals, baseTS+2)
+	c.Assert(txn.Rollback(), IsNil)
+
+	o.Advance(time.Second)
+	txn, err = store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.StartTS(), Equals, oracle.ComposeTS(2000, 0))
+	c.Assert(txn.Rollback(), IsNil)
+
+	for _, path := range []string{
+		"tikv://127.0.0.1:2379?oracle=local",
+		"tikv://127.0.0.1:2379?oracleBaseTS=100",
+		"tikv://127.0.0.1:2379?oracle=fixed&oracleBaseTS=-1",
+	} {
+		_, _, err = parsePath(path)
+		c.Assert(err, NotNil, Commentf("%s", path))
+	}
+	_, opts, err := parsePath("tikv://127.0.0.1:2379?oracle=fixed")
+	c.Assert(err, IsNil)
+	c.Assert(opts.fixedOracle, IsTrue)
+	c.Assert(opts.oracleBaseTS, Greater, baseTS)
+	_, opts, err = parsePath("tikv://127.0.0.1:2379?oracle=pd")
+	c.Assert(err, IsNil)
+	c.Assert(opts.fixedOracle, IsFalse)
+}
+
+func (s *testStoreSuite) TestOpenWithContext(c *C) {
+	unblock := make(chan struct{})
+	client := &closeRecordPDClient{
+		Client: mocktikv.NewPDClient(mocktikv.NewCluster()),
+		closed: make(chan struct{}),
+	}
+	defer func(f func([]string) (pd.Client, error)) { newPDClient = f }(newPDClient)
+	newPDClient = func([]string) (pd.Client, error) {
+		<-unblock
+		return client, nil
+	}
+
+	ctx, cancel := goctx.WithTimeout(goctx.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := Driver{}.OpenWithContext(ctx, "tikv://127.0.0.1:2379")
+	c.Assert(errors.Cause(err), Equals, goctx.DeadlineExceeded)
+	c.Assert(time.Since(start), Less, time.Second)
+
+	// The client created after giving up is closed.
+	close(unblock)
+	select {
+	case <-client.closed:
+	case <-time.After(time.Second):
+		c.Fatal("the pd client is not closed")
+	}
+}
+
+func (s *testStoreSuite) TestSafePointRefreshInterval(c *C) {
+	c.Assert(s.store.safePointRefreshInterval, Equals, defaultSafePointRefreshInterval)
+	store, err := NewMockTikvStore(WithSafePointRefreshInterval(30 * time.Second))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	c.Assert(store.(*tikvStore).safePointRefreshInterval, Equals, 30*time.Second)
+}
+
+func (s *testStoreSuite) TestCheckVisibility(c *C) {
+	// The safepoint updater is not started.
+	c.Assert(s.store.CheckVisibility(0), IsNil)
+	safePoint, age, ok := s.store.CheckVisibilityDetailed()
+	c.Assert(safePoint, Equals, uint64(0))
+	c.Assert(age, Equals, time.Duration(0))
+	c.Assert(ok, IsTrue)
+
+	s.store.spMutex.Lock()
+	s.store.safePoint, s.store.spTime = 100, time.Now().Add(-time.Second)
+	s.store.spMutex.Unlock()
+	c.Assert(s.store.CheckVisibility(100), IsNil)
+	c.Assert(errors.Cause(s.store.CheckVisibility(99)), Equals, ErrStartTSBelowSafePoint)
+	safePoint, age, ok = s.store.CheckVisibilityDetailed()
+	c.Assert(safePoint, Equals, uint64(100))
+	c.Assert(age, GreaterEqual, time.Second)
+	c.Assert(age, Less, defaultMaxSafePointStaleness)
+	c.Assert(ok, IsTrue)
+
+	s.store.spMutex.Lock()
+	s.store.spTime = time.Now().Add(-2 * defaultMaxSafePointStaleness)
+	s.store.spMutex.Unlock()
+	c.Assert(s.store.CheckVisibility(100), NotNil)
+	safePoint, age, ok = s.store.CheckVisibilityDetailed()
+	c.Assert(safePoint, Equals, uint64(100))
+	c.Assert(age, GreaterEqual, 2*defaultMaxSafePointStaleness)
+	c.Assert(ok, IsFalse)
+
+	store, err := NewMockTikvStore(WithSafePointStaleness(3 * defaultMaxSafePointStaleness))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	ts.spMutex.Lock()
+	ts.safePoint, ts.spTime = 100, time.Now().Add(-2*defaultMaxSafePointStaleness)
+	ts.spMutex.Unlock()
+	c.Assert(ts.CheckVisibility(100), IsNil)
+}
+
+func (s *testStoreSuite) TestStaleSafePointRejectsReads(c *C) {
+	store, err := NewMockTikvStore(WithoutSafePointUpdate())
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	txn, err := ts.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("a"), []byte("v")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+	ver, err := ts.CurrentVersion()
+	c.Assert(err, IsNil)
+
+	reads := func() []error {
+		snapshot := newTiKVSnapshot(ts, ver)
+		_, getErr := snapshot.Get([]byte("a"))
+		_, batchGetErr := snapshot.BatchGet([]kv.Key{kv.Key("a")})
+		_, seekErr := snapshot.Seek([]byte("a"))
+		_, iterErr := snapshot.IterWithBatchSize([]byte("a"), []byte("b"), 10)
+		resp := ts.GetClient().Send(goctx.Background(), &kv.Request{
+			Tp:        kv.ReqTypeSelect,
+			StartTs:   ver.Ver,
+			KeyRanges: []kv.KeyRange{{StartKey: []byte("a"), EndKey: []byte("b")}},
+		})
+		_, copErr := resp.Next()
+		return []error{getErr, batchGetErr, seekErr, iterErr, copErr}
+	}
+
+	// The reads fail once the cached safepoint is stale.
+	ts.spMutex.Lock()
+	ts.safePoint, ts.spTime = 0, time.Now().Add(-2*defaultMaxSafePointStaleness)
+	ts.spMutex.Unlock()
+	for i, err := range reads() {
+		c.Assert(err, ErrorMatches, "start timestamp may fall behind safepoint.*", Commentf("read %d", i))
+	}
+
+	// And they're checked against the safepoint once it's refreshed.
+	ts.spMutex.Lock()
+	ts.safePoint, ts.spTime = ver.Ver+1, time.Now()
+	ts.spMutex.Unlock()
+	for i, err := range reads() {
+		c.Assert(errors.Cause(err), Equals, ErrStartTSBelowSafePoint, Commentf("read %d", i))
+	}
+}
+
+func (s *testStoreSuite) TestGCedVersions(c *C) {
+	oldVer, err := s.store.CurrentVersion()
+	c.Assert(err, IsNil)
+	time.Sleep(time.Millisecond)
+	gcTS := oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0)
+	store, err := NewMockTikvStore(WithGCedVersions(map[string]uint64{"k1": gcTS}), WithoutSafePointUpdate())
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+
+	txn, err := ts.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("k1"), []byte("v1")), IsNil)
+	c.Assert(txn.Set([]byte("k2"), []byte("v2")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+	txn, err = ts.Begin()
+	c.Assert(err, IsNil)
+	val, err := txn.Get([]byte("k1"))
+	c.Assert(err, IsNil)
+	c.Assert(val, BytesEquals, []byte("v1"))
+
+	// Reading the GC'd versions gets the error from TiKV, if the safepoint isn't
+	// loaded yet.
+	txn, err = ts.BeginWithStartTSUnchecked(oldVer.Ver)
+	c.Assert(err, IsNil)
+	_, err = txn.Get([]byte("k1"))
+	c.Assert(err, ErrorMatches, ".*GC'd.*")
+	_, err = txn.Get([]byte("k2"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+
+	// The loaded safepoint stops the reads before they're sent.
+	ts.updateSafePoint(gcTS)
+	_, err = ts.BeginWithStartTS(oldVer.Ver)
+	c.Assert(errors.Cause(err), Equals, ErrStartTSBelowSafePoint)
+	_, err = txn.Get([]byte("k1"))
+	c.Assert(errors.Cause(err), Equals, ErrStartTSBelowSafePoint)
+
+	// The MVCC store should support it.
+	_, err = NewMockTikvStore(WithMVCCStore(mocktikv.NewMvccStore()), WithGCedVersions(map[string]uint64{"k1": gcTS}))
+	c.Assert(err, NotNil)
+}
+
+func (s *testStoreSuite) TestDisableSafePointUpdate(c *C) {
+	store, err := NewMockTikvStore(WithoutSafePointUpdate())
+	c.Assert(err, IsNil)
+	ts := store.(*tikvStore)
+	c.Assert(ts.StartGCWorker(), IsNil)
+	ts.spMutex.RLock()
+	c.Assert(ts.spTime.IsZero(), IsTrue)
+	ts.spMutex.RUnlock()
+	c.Assert(ts.CheckVisibility(0), IsNil)
+	c.Assert(store.Close(), IsNil)
+}
+
+func (s *testStoreSuite) TestWaitBootstrap(c *C) {
+	store, err := NewMockTikvStore(WithoutSafePointUpdate())
+	c.Assert(err, IsNil)
+	c.Assert(store.(*tikvStore).WaitBootstrap(goctx.Background()), IsNil)
+	c.Assert(store.Close(), IsNil)
+
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithSingleStore(cluster)
+	store, err = NewMockTikvStore(WithCluster(cluster), WithPDSafePoint())
+	c.Assert(err, IsNil)
+	ts := store.(*tikvStore)
+	// The safepoint updater isn't started yet.
+	ctx, cancel := goctx.WithTimeout(goctx.Background(), 50*time.Millisecond)
+	c.Assert(errors.Cause(ts.WaitBootstrap(ctx)), Equals, goctx.DeadlineExceeded)
+	cancel()
+	c.Assert(ts.StartGCWorker(), IsNil)
+	ctx, cancel = goctx.WithTimeout(goctx.Background(), 5*time.Second)
+	defer cancel()
+	c.Assert(ts.WaitBootstrap(ctx), IsNil)
+	c.Assert(store.Close(), IsNil)
+
+	// The safepoint is loaded by the session created after bootstrapping.
+	store, err = NewMockTikvStore()
+	c.Assert(err, IsNil)
+	ts = store.(*tikvStore)
+	_, err = tidb.BootstrapSession(store)
+	c.Assert(err, IsNil)
+	c.Assert(ts.WaitBootstrap(ctx), IsNil)
+	c.Assert(store.Close(), IsNil)
+
+	// It returns once the store is closed.
+	store, err = NewMockTikvStore(WithPDSafePoint())
+	c.Assert(err, IsNil)
+	ts = store.(*tikvStore)
+	c.Assert(store.Close(), IsNil)
+	c.Assert(errors.Cause(ts.WaitBootstrap(ctx)), Equals, ErrStoreClosing)
+}
+
+func (s *testStoreSuite) TestDescribe(c *C) {
+	store, err := NewMockTikvStore(WithStoreCount(3), WithRegionSplit([][]byte{[]byte("b"), []byte("c")}), WithoutSafePointUpdate())
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	ts.updateSafePoint(100)
+
+	info, err := ts.Describe(goctx.Background())
+	c.Assert(err, IsNil)
+	c.Assert(info.ClusterID, Equals, ts.clusterID)
+	c.Assert(info.UUID, Equals, ts.UUID())
+	c.Assert(info.PDAddrs, HasLen, 0)
+	c.Assert(info.Mock, IsTrue)
+	c.Assert(info.StoreCount, Equals, 3)
+	c.Assert(info.RegionCount, Equals, 3)
+	c.Assert(info.SafePoint, Equals, uint64(100))
+	c.Assert(info.GCEnabled, IsFalse)
+
+	// Without the mock cluster, the counts come from the region cache.
+	ts.mockCluster = nil
+	info, err = ts.Describe(goctx.Background())
+	c.Assert(err, IsNil)
+	c.Assert(info.StoreCount, Equals, 0)
+	c.Assert(info.RegionCount, Equals, 0)
+	bo := NewBackoffer(getMaxBackoff, goctx.Background())
+	loc, err := ts.regionCache.LocateKey(bo, []byte("a"))
+	c.Assert(err, IsNil)
+	_, err = ts.regionCache.GetRPCContext(bo, loc.Region)
+	c.Assert(err, IsNil)
+	info, err = ts.Describe(goctx.Background())
+	c.Assert(err, IsNil)
+	c.Assert(info.StoreCount, Equals, 1)
+	c.Assert(info.RegionCount, Equals, 1)
+
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	cancel()
+	_, err = ts.Describe(ctx)
+	c.Assert(errors.Cause(err), Equals, goctx.Canceled)
+}
+
+type plainPDClient struct {
+	pd.Client
+}
+
+func (s *testStoreSuite) TestSafePointFromPD(c *C) {
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithSingleStore(cluster)
+	cluster.SetGCSafePoint(100)
+	store, err := NewMockTikvStore(WithCluster(cluster), WithPDSafePoint(), WithSafePointRefreshInterval(time.Millisecond*10))
+	c.Assert(err, IsNil)
+	ts := store.(*tikvStore)
+	// No session is needed to load the safepoint from PD.
+	c.Assert(ts.StartGCWorker(), IsNil)
+	defer store.Close()
+
+	waitSafePoint := func(expect uint64) {
+		for i := 0; i < 100; i++ {
+			ts.spMutex.RLock()
+			safePoint := ts.safePoint
+			ts.spMutex.RUnlock()
+			if safePoint == expect {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		c.Fatalf("safepoint is not updated to %d", expect)
+	}
+	waitSafePoint(100)
+	cluster.SetGCSafePoint(200)
+	safePoint, err := ts.RefreshSafePoint()
+	c.Assert(err, IsNil)
+	c.Assert(safePoint, Equals, uint64(200))
+	c.Assert(ts.CheckVisibility(150), NotNil)
+	c.Assert(ts.CheckVisibility(200), IsNil)
+
+	// The PD client which can't load the safepoint.
+	store1, err := NewMockTikvStore(WithHijackPDClient(func(c pd.Client) pd.Client {
+		return &plainPDClient{c}
+	}))
+	c.Assert(err, IsNil)
+	defer store1.Close()
+	_, err = store1.(*tikvStore).loadSafePointFromPD()
+	c.Assert(errors.Cause(err), Equals, errSafePointNotSupported)
+}
+
+func (s *testStoreSuite) TestBeginWithStartTS(c *C) {
+	store, err := NewMockTikvStore()
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	ts.spMutex.Lock()
+	ts.safePoint, ts.spTime = 100, time.Now()
+	ts.spMutex.Unlock()
+
+	_, err = ts.BeginWithStartTS(99)
+	c.Assert(errors.Cause(err), Equals, ErrStartTSBelowSafePoint)
+	txn, err := ts.BeginWithStartTS(100)
+	c.Assert(err, IsNil)
+	c.Assert(txn.StartTS(), Equals, uint64(100))
+	c.Assert(txn.Rollback(), IsNil)
+
+	// The check is skipped by BeginWithStartTSUnchecked.
+	txn, err = ts.BeginWithStartTSUnchecked(99)
+	c.Assert(err, IsNil)
+	c.Assert(txn.StartTS(), Equals, uint64(99))
+	c.Assert(txn.Rollback(), IsNil)
+}
+
+func (s *testStoreSuite) TestSendReqCtx(c *C) {
+	var client *busyClient
+	store, err := NewMockTikvStore(WithHijackClient(func(c Client) Client {
+		client = newBusyClient(c)
+		return client
+	}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	client.setBusy(true)
+	loc, err := ts.regionCache.LocateKey(NewBackoffer(100, goctx.Background()), []byte("a"))
+	c.Assert(err, IsNil)
+	req := &tikvrpc.Request{
+		Type: tikvrpc.CmdGet,
+		Get: &pb.GetRequest{
+			Key:     []byte("a"),
+			Version: 1,
+		},
+	}
+
+	// The request keeps backing off until the context is cancelled.
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	time.AfterFunc(time.Millisecond*100, cancel)
+	start := time.Now()
+	_, err = ts.SendReqCtx(ctx, req, loc.Region, time.Second*10)
+	c.Assert(err, NotNil)
+	c.Assert(time.Since(start), Less, time.Second)
+}
+
+func (s *testStoreSuite) TestMaxBackoff(c *C) {
+	bo := s.store.newBackoffer(getMaxBackoff, goctx.Background())
+	c.Assert(bo.maxSleep, Equals, getMaxBackoff)
+
+	store, err := NewMockTikvStore(WithMaxBackoff(500))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	bo = ts.newBackoffer(getMaxBackoff, goctx.Background())
+	c.Assert(bo.maxSleep, Equals, 500)
+	// The per-command limit is still the upper bound.
+	bo = ts.newBackoffer(100, goctx.Background())
+	c.Assert(bo.maxSleep, Equals, 100)
+}
+
+// cappedRetryPolicy retries at most max times without sleeping.
+type cappedRetryPolicy struct {
+	max     int
+	retries int
+	types   []int
+}
+
+func (p *cappedRetryPolicy) NextBackoff(errType int) (time.Duration, bool) {
+	if p.retries >= p.max {
+		return 0, false
+	}
+	p.retries++
+	p.types = append(p.types, errType)
+	return time.Millisecond, true
+}
+
+func (s *testStoreSuite) TestRetryPolicy(c *C) {
+	// The default policy keeps retrying until maxSleep is exceeded.
+	policy := NewDefaultRetryPolicy()
+	d, ok := policy.NextBackoff(RetryRegionMiss)
+	c.Assert(ok, IsTrue)
+	c.Assert(d, Equals, 100*time.Millisecond)
+	d, ok = policy.NextBackoff(RetryRegionMiss)
+	c.Assert(ok, IsTrue)
+	c.Assert(d, Equals, 200*time.Millisecond)
+	_, ok = policy.NextBackoff(-1)
+	c.Assert(ok, IsFalse)
+
+	var (
+		client   *busyClient
+		policies []*cappedRetryPolicy
+	)
+	store, err := NewMockTikvStore(WithHijackClient(func(c Client) Client {
+		client = newBusyClient(c)
+		return client
+	}), WithRetryPolicy(func() RetryPolicy {
+		p := &cappedRetryPolicy{max: 3}
+		policies = append(policies, p)
+		return p
+	}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	loc, err := ts.regionCache.LocateKey(NewBackoffer(100, goctx.Background()), []byte("a"))
+	c.Assert(err, IsNil)
+	req := &tikvrpc.Request{
+		Type: tikvrpc.CmdGet,
+		Get: &pb.GetRequest{
+			Key:     []byte("a"),
+			Version: 1,
+		},
+	}
+
+	client.setBusy(true)
+	start := time.Now()
+	_, err = ts.SendReqCtx(goctx.Background(), req, loc.Region, time.Second)
+	c.Assert(err, NotNil)
+	c.Assert(IsRetryableError(err), IsTrue)
+	c.Assert(time.Since(start), Less, time.Second)
+	c.Assert(policies, HasLen, 1)
+	c.Assert(policies[0].types, DeepEquals, []int{RetryServerBusy, RetryServerBusy, RetryServerBusy})
+
+	// Every backoffer has its own policy.
+	client.setBusy(false)
+	_, err = ts.SendReqCtx(goctx.Background(), req, loc.Region, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(policies, HasLen, 1)
+	bo := ts.newBackoffer(getMaxBackoff, goctx.Background())
+	c.Assert(bo.Backoff(boTxnLock, errors.New("locked")), IsNil)
+	c.Assert(policies, HasLen, 2)
+	c.Assert(policies[1].types, DeepEquals, []int{RetryTxnLock})
+}
+
+// gatherMetric scrapes the registered metric with the type label, it returns
+// nil if the metric isn't found.
+func gatherMetric(c *C, name, typ string) *dto.Metric {
+	families, err := prometheus.DefaultGatherer.Gather()
+	c.Assert(err, IsNil)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "type" && label.GetValue() == typ {
+					return m
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *testStoreSuite) TestStoreRequestMetrics(c *C) {
+	sampleCount := func(typ string) uint64 {
+		m := gatherMetric(c, "tidb_tikvclient_store_request_seconds", typ)
+		if m == nil {
+			return 0
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+	errorCount := func(typ string) float64 {
+		m := gatherMetric(c, "tidb_tikvclient_store_request_error_total", typ)
+		if m == nil {
+			return 0
+		}
+		return m.GetCounter().GetValue()
+	}
+
+	var client *busyClient
+	store, err := NewMockTikvStore(WithMaxBackoff(10), WithHijackClient(func(c Client) Client {
+		client = newBusyClient(c)
+		return client
+	}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	loc, err := ts.regionCache.LocateKey(NewBackoffer(100, goctx.Background()), []byte("a"))
+	c.Assert(err, IsNil)
+	getReq := &tikvrpc.Request{
+		Type: tikvrpc.CmdGet,
+		Get:  &pb.GetRequest{Key: []byte("a"), Version: 1},
+	}
+	scanReq := &tikvrpc.Request{
+		Type: tikvrpc.CmdScan,
+		Scan: &pb.ScanRequest{StartKey: []byte("a"), Limit: 1, Version: 1},
+	}
+
+	gets, scans, getErrors := sampleCount("Get"), sampleCount("Scan"), errorCount("Get")
+	_, err = ts.SendReqCtx(goctx.Background(), getReq, loc.Region, time.Second)
+	c.Assert(err, IsNil)
+	_, err = ts.SendReqCtx(goctx.Background(), scanReq, loc.Region, time.Second)
+	c.Assert(err, IsNil)
+	_, err = ts.SendReqCtx(goctx.Background(), scanReq, loc.Region, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(sampleCount("Get"), Equals, gets+1)
+	c.Assert(sampleCount("Scan"), Equals, scans+2)
+	c.Assert(errorCount("Get"), Equals, getErrors)
+
+	// The request failed after the retries is counted once.
+	client.setBusy(true)
+	_, err = ts.SendReqCtx(goctx.Background(), getReq, loc.Region, time.Second)
+	c.Assert(err, NotNil)
+	c.Assert(sampleCount("Get"), Equals, gets+2)
+	c.Assert(errorCount("Get"), Equals, getErrors+1)
+}
+
+func (s *testStoreSuite) TestStoreCountAndRegionSplit(c *C) {
+	store, err := NewMockTikvStore(WithStoreCount(3), WithRegionSplit([][]byte{[]byte("b"), []byte("d")}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+
+	bo := NewBackoffer(getMaxBackoff, goctx.Background())
+	regions := make(map[RegionVerID]struct{})
+	for _, key := range []string{"a", "c", "e"} {
+		loc, err := ts.regionCache.LocateKey(bo, []byte(key))
+		c.Assert(err, IsNil)
+		regions[loc.Region] = struct{}{}
+		region := ts.regionCache.getRegionFromCache([]byte(key))
+		c.Assert(region.meta.GetPeers(), HasLen, 3)
+	}
+	c.Assert(regions, HasLen, 3)
+
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	for _, key := range []string{"a", "c", "e"} {
+		c.Assert(txn.Set([]byte(key), []byte(key)), IsNil)
+	}
+	c.Assert(txn.Commit(), IsNil)
+	txn, err = store.Begin()
+	c.Assert(err, IsNil)
+	for _, key := range []string{"a", "c", "e"} {
+		val, err := txn.Get([]byte(key))
+		c.Assert(err, IsNil)
+		c.Assert(val, BytesEquals, []byte(key))
+	}
+}
+
+func (s *testStoreSuite) TestWithRegionCache(c *C) {
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithSingleStore(cluster)
+	cachePD := &mockPDClient{client: &codecPDClient{mocktikv.NewPDClient(cluster)}}
+	cache := NewRegionCache(cachePD)
+	store, err := NewMockTikvStore(WithCluster(cluster), WithRegionCache(cache))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	c.Assert(ts.GetRegionCache(), Equals, cache)
+
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("a"), []byte("a")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+
+	// The requests are routed by the cache, it doesn't need PD once it's loaded.
+	cachePD.disable()
+	defer cachePD.enable()
+	txn, err = store.Begin()
+	c.Assert(err, IsNil)
+	val, err := txn.Get([]byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(val, BytesEquals, []byte("a"))
+
+	// The region can't be reloaded after it's dropped.
+	loc, err := cache.LocateKey(NewBackoffer(getMaxBackoff, goctx.Background()), []byte("a"))
+	c.Assert(err, IsNil)
+	cache.DropRegion(loc.Region)
+	_, err = cache.LocateKey(NewBackoffer(10, goctx.Background()), []byte("a"))
+	c.Assert(err, NotNil)
+}
+
+func (s *testStoreSuite) TestActiveTransactions(c *C) {
+	// The tracking is disabled by default.
+	txn, err := s.store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(s.store.ActiveTransactions(), IsNil)
+	c.Assert(txn.Rollback(), IsNil)
+
+	store, err := NewMockTikvStore(WithTxnTracking())
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	c.Assert(ts.ActiveTransactions(), HasLen, 0)
+
+	begin := time.Now()
+	txn1, err := store.Begin()
+	c.Assert(err, IsNil)
+	txn2, err := store.BeginWithStartTS(txn1.StartTS() - 1)
+	c.Assert(err, IsNil)
+	txn3, err := store.Begin()
+	c.Assert(err, IsNil)
+	infos := ts.ActiveTransactions()
+	c.Assert(infos, HasLen, 3)
+	for i, txn := range []kv.Transaction{txn2, txn1, txn3} {
+		c.Assert(infos[i].StartTS, Equals, txn.StartTS())
+		c.Assert(infos[i].BeginTime.Before(begin), IsFalse)
+	}
+
+	c.Assert(txn1.Set([]byte("key"), []byte("value")), IsNil)
+	c.Assert(txn1.Commit(), IsNil)
+	c.Assert(txn2.Rollback(), IsNil)
+	infos = ts.ActiveTransactions()
+	c.Assert(infos, HasLen, 1)
+	c.Assert(infos[0].StartTS, Equals, txn3.StartTS())
+
+	// A failed commit finishes the txn too.
+	c.Assert(txn3.Set([]byte("key"), []byte("value")), IsNil)
+	c.Assert(txn3.Commit(), NotNil)
+	c.Assert(ts.ActiveTransactions(), HasLen, 0)
+}
+
+func (s *testStoreSuite) TestDeleteRangeSupport(c *C) {
+	c.Assert(s.store.SupportDeleteRange(), IsFalse)
+	store, err := NewMockTikvStore(WithDeleteRangeSupport(true))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	c.Assert(ts.SupportDeleteRange(), IsTrue)
+
+	txn, err := ts.Begin()
+	c.Assert(err, IsNil)
+	for _, k := range []string{"a", "b", "c"} {
+		c.Assert(txn.Set([]byte(k), []byte(k)), IsNil)
+	}
+	c.Assert(txn.Commit(), IsNil)
+
+	bo := NewBackoffer(100, goctx.Background())
+	loc, err := ts.regionCache.LocateKey(bo, []byte("a"))
+	c.Assert(err, IsNil)
+	req := &tikvrpc.Request{
+		Type: tikvrpc.CmdDeleteRange,
+		DeleteRange: &pb.DeleteRangeRequest{
+			StartKey: []byte("a"),
+			EndKey:   []byte("c"),
+		},
+	}
+	resp, err := ts.SendReq(bo, req, loc.Region, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(resp.DeleteRange.GetError(), Equals, "")
+
+	txn, err = ts.Begin()
+	c.Assert(err, IsNil)
+	_, err = txn.Get([]byte("b"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	val, err := txn.Get([]byte("c"))
+	c.Assert(err, IsNil)
+	c.Assert(val, BytesEquals, []byte("c"))
+}
+
+func (s *testStoreSuite) TestGetValueAtTS(c *C) {
+	key := kv.Key("key")
+	var commitTSs []uint64
+	for _, value := range []string{"v1", "v2", ""} {
+		txn, err := s.store.Begin()
+		c.Assert(err, IsNil)
+		if value == "" {
+			c.Assert(txn.Delete(key), IsNil)
+		} else {
+			c.Assert(txn.Set(key, []byte(value)), IsNil)
+		}
+		c.Assert(txn.Commit(), IsNil)
+		commitTSs = append(commitTSs, txn.(*tikvTxn).commitTS)
+	}
+
+	ctx := goctx.Background()
+	_, err := s.store.GetValueAtTS(ctx, key, commitTSs[0]-1)
+	c.Assert(kv.ErrNotExist.Equal(err), IsTrue)
+	val, err := s.store.GetValueAtTS(ctx, key, commitTSs[0])
+	c.Assert(err, IsNil)
+	c.Assert(val, BytesEquals, []byte("v1"))
+	val, err = s.store.GetValueAtTS(ctx, key, commitTSs[1]-1)
+	c.Assert(err, IsNil)
+	c.Assert(val, BytesEquals, []byte("v1"))
+	val, err = s.store.GetValueAtTS(ctx, key, commitTSs[1])
+	c.Assert(err, IsNil)
+	c.Assert(val, BytesEquals, []byte("v2"))
+	_, err = s.store.GetValueAtTS(ctx, key, commitTSs[2])
+	c.Assert(kv.ErrNotExist.Equal(err), IsTrue)
+}
+
+func (s *testStoreSuite) TestBatchGetAtTS(c *C) {
+	store, err := NewMockTikvStore(WithRegionSplit([][]byte{[]byte("b"), []byte("d")}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+
+	keys := []kv.Key{kv.Key("a"), kv.Key("c"), kv.Key("e"), kv.Key("f")}
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	for _, key := range keys[:3] {
+		c.Assert(txn.Set(key, key), IsNil)
+	}
+	c.Assert(txn.Commit(), IsNil)
+	commitTS := txn.(*tikvTxn).commitTS
+	txn, err = store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set(kv.Key("c"), []byte("c2")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+
+	ctx := goctx.Background()
+	m, err := ts.BatchGetAtTS(ctx, keys, commitTS-1)
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 0)
+	m, err = ts.BatchGetAtTS(ctx, keys, commitTS)
+	c.Assert(err, IsNil)
+	c.Assert(m, DeepEquals, map[string][]byte{"a": []byte("a"), "c": []byte("c"), "e": []byte("e")})
+	m, err = ts.BatchGetAtTS(ctx, keys, txn.(*tikvTxn).commitTS)
+	c.Assert(err, IsNil)
+	c.Assert(m, DeepEquals, map[string][]byte{"a": []byte("a"), "c": []byte("c2"), "e": []byte("e")})
+
+	// The retries stop when the context is done.
+	client := newBusyClient(ts.client)
+	ts.client = client
+	client.setBusy(true)
+	ctx, cancel := goctx.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = ts.BatchGetAtTS(ctx, keys, commitTS)
+	c.Assert(err, NotNil)
+	c.Assert(time.Since(start), Less, time.Second)
+	client.setBusy(false)
+}
+
+func (s *testStoreSuite) TestOracle(c *C) {
+	o := &mockOracle{}
+	s.store.oracle = o
+
+	ctx := goctx.Background()
+	t1, err := s.store.getTimestampWithRetry(NewBackoffer(100, ctx))
+	c.Assert(err, IsNil)
+	t2, err := s.store.getTimestampWithRetry(NewBackoffer(100, ctx))
+	c.Assert(err, IsNil)
+	c.Assert(t1, Less, t2)
+
+	// Check retry.
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	o.disable()
+	go func() {
+		defer wg.Done()
+		time.Sleep(time.Millisecond * 100)
+		o.enable()
+	}()
+
+	go func() {
+		defer wg.Done()
+		t3, err := s.store.getTimestampWithRetry(NewBackoffer(tsoMaxBackoff, ctx))
+		c.Assert(err, IsNil)
+		c.Assert(t2, Less, t3)
+		expired := s.store.oracle.IsExpired(t2, 50)
+		c.Assert(expired, IsTrue)
+	}()
+
+	wg.Wait()
+
+	// The error tells how many retries and how long it takes.
+	o.disable()
+	defer o.enable()
+	_, err = s.store.getTimestampWithRetry(NewBackoffer(100, ctx))
+	c.Assert(err, NotNil)
+	c.Assert(err, ErrorMatches, "(?s)get timestamp failed after [0-9]+ retries over .*")
+	c.Assert(strings.Contains(err.Error(), txnRetryableMark), IsTrue)
+}
+
+func (s *testStoreSuite) TestOracleUpdateInterval(c *C) {
+	store, err := NewMockTikvStore(WithOracleUpdateInterval(time.Millisecond * 10))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+
+	// The oracle updates lastTS by itself.
+	t1, err := ts.GetLowResolutionTimestamp()
+	c.Assert(err, IsNil)
+	t2 := waitLowResolutionTimestamp(c, ts, t1, 5*time.Second)
+	c.Assert(t1, Less, t2)
+}
+
+func (s *testStoreSuite) TestSetOracleUpdateInterval(c *C) {
+	// The default interval is changed by other tests, so a long one is set. The
+	// safepoint updater is disabled since the timestamps it gets update lastTS too.
+	store, err := NewMockTikvStore(WithOracleUpdateInterval(time.Minute), WithoutSafePointUpdate())
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+
+	// With the long interval, lastTS doesn't change in a short time.
+	t1, err := ts.GetLowResolutionTimestamp()
+	c.Assert(err, IsNil)
+	time.Sleep(50 * time.Millisecond)
+	t2, err := ts.GetLowResolutionTimestamp()
+	c.Assert(err, IsNil)
+	c.Assert(t2, Equals, t1)
+
+	c.Assert(ts.SetOracleUpdateInterval(10*time.Millisecond), IsNil)
+	// The ticks may be delayed when the machine is loaded, so it polls lastTS
+	// with a generous deadline instead of sleeping a fixed time.
+	for i := 0; i < 3; i++ {
+		t3 := waitLowResolutionTimestamp(c, ts, t2, 5*time.Second)
+		c.Assert(t3, Greater, t2)
+		t2 = t3
+	}
+
+	// Back to a long interval.
+	c.Assert(ts.SetOracleUpdateInterval(time.Minute), IsNil)
+	time.Sleep(20 * time.Millisecond)
+	t1, err = ts.GetLowResolutionTimestamp()
+	c.Assert(err, IsNil)
+	time.Sleep(50 * time.Millisecond)
+	t2, err = ts.GetLowResolutionTimestamp()
+	c.Assert(err, IsNil)
+	c.Assert(t2, Equals, t1)
+
+	c.Assert(ts.SetOracleUpdateInterval(time.Millisecond), NotNil)
+	ts.oracle = oracles.NewFixedOracle(t2)
+	defer ts.oracle.Close()
+	c.Assert(ts.SetOracleUpdateInterval(time.Second), NotNil)
+}
+
+// waitLowResolutionTimestamp polls the low resolution timestamp of the store
+// until it differs from prev, or the timeout is reached.
+func waitLowResolutionTimestamp(c *C, store *tikvStore, prev uint64, timeout time.Duration) uint64 {
+	deadline := time.Now().Add(timeout)
+	for {
+		ts, err := store.GetLowResolutionTimestamp()
+		c.Assert(err, IsNil)
+		if ts != prev || time.Now().After(deadline) {
+			return ts
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *testStoreSuite) TestGetLowResolutionTimestamp(c *C) {
+	store, err := NewMockTikvStore()
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+
+	t1, err := ts.GetLowResolutionTimestamp()
+	c.Assert(err, IsNil)
+	c.Assert(t1, Greater, uint64(0))
+	t2, err := ts.getTimestampWithRetry(NewBackoffer(100, goctx.Background()))
+	c.Assert(err, IsNil)
+	c.Assert(t1, Less, t2)
+	// The cached timestamp is updated by GetTimestamp.
+	t3, err := ts.GetLowResolutionTimestamp()
+	c.Assert(err, IsNil)
+	c.Assert(t3 >= t2, IsTrue)
+}
+
+func (s *testStoreSuite) TestBusyServerKV(c *C) {
+	client := newBusyClient(s.store.client)
+	s.store.client = client
+
+	txn, err := s.store.Begin()
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte("key"), []byte("value"))
+	c.Assert(err, IsNil)
+	err = txn.Commit()
+	c.Assert(err, IsNil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	client.setBusy(true)
+	go func() {
+		defer wg.Done()
+		time.Sleep(time.Millisecond * 100)
+		client.setBusy(false)
+	}()
+
+	go func() {
+		defer wg.Done()
+		txn, err := s.store.Begin()
+		c.Assert(err, IsNil)
+		val, err := txn.Get([]byte("key"))
+		c.Assert(err, IsNil)
+		c.Assert(val, BytesEquals, []byte("value"))
+	}()
+
+	wg.Wait()
+}
+
+func (s *testStoreSuite) TestBusyServerCop(c *C) {
+	client := newBusyClient(s.store.client)
+	s.store.client = client
+	_, err := tidb.BootstrapSession(s.store)
+	c.Assert(err, IsNil)
+
+	session, err := tidb.CreateSession(s.store)
+	c.Assert(err, IsNil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	client.setBusy(true)
+	go func() {
+		defer wg.Done()
+		time.Sleep(time.Millisecond * 100)
+		client.setBusy(false)
+	}()
+
+	go func() {
+		defer wg.Done()
+		rs, err := session.Execute(`SELECT variable_value FROM mysql.tidb WHERE variable_name="bootstrapped"`)
+		c.Assert(err, IsNil)
+		row, err := rs[0].Next()
+		c.Assert(err, IsNil)
+		c.Assert(row, NotNil)
+		c.Assert(row.Data[0].GetString(), Equals, "True")
+	}()
+
+	wg.Wait()
+}
+
+type blockCloseClient struct {
+	Client
+	closing chan struct{}
+	unblock chan struct{}
+}
+
+func (c *blockCloseClient) Close() error {
+	close(c.closing)
+	<-c.unblock
+	return c.Client.Close()
+}
+
+func (s *testStoreSuite) TestCloseMarksClosing(c *C) {
+	client := &blockCloseClient{
+		closing: make(chan struct{}),
+		unblock: make(chan struct{}),
+	}
+	store, err := NewMockTikvStore(WithHijackClient(func(cli Client) Client {
+		client.Client = cli
+		return client
+	}))
+	c.Assert(err, IsNil)
+	uuid := store.UUID()
+	mc.Lock()
+	mc.cache[uuid] = store.(*tikvStore)
+	mc.Unlock()
+
+	done := make(chan error)
+	go func() {
+		done <- store.Close()
+	}()
+	<-client.closing
+	mc.Lock()
+	_, cached := mc.cache[uuid]
+	_, closing := mc.closing[uuid]
+	mc.Unlock()
+	c.Assert(cached, IsFalse)
+	c.Assert(closing, IsTrue)
+
+	close(client.unblock)
+	c.Assert(<-done, IsNil)
+	mc.Lock()
+	_, closing = mc.closing[uuid]
+	mc.Unlock()
+	c.Assert(closing, IsFalse)
+}
+
+// slowPDClient makes GetTS hang until the context is done once slow is set.
+type slowPDClient struct {
+	pd.Client
+	sync.RWMutex
+	slow bool
+}
+
+func (c *slowPDClient) setSlow(slow bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.slow = slow
+}
+
+func (c *slowPDClient) GetTS(ctx goctx.Context) (int64, int64, error) {
+	c.RLock()
+	slow := c.slow
+	c.RUnlock()
+	if slow {
+		select {
+		case <-ctx.Done():
+			return 0, 0, errors.Trace(ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+	return c.Client.GetTS(ctx)
+}
+
+func (s *testStoreSuite) TestCurrentVersionWithTimeout(c *C) {
+	pdClient := &slowPDClient{}
+	store, err := NewMockTikvStore(WithHijackPDClient(func(cli pd.Client) pd.Client {
+		pdClient.Client = cli
+		return pdClient
+	}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	tikvStore := store.(*tikvStore)
+
+	ver, err := tikvStore.CurrentVersionWithTimeout(time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(ver.Ver, Greater, uint64(0))
+
+	pdClient.setSlow(true)
+	start := time.Now()
+	_, err = tikvStore.CurrentVersionWithTimeout(100 * time.Millisecond)
+	c.Assert(err, NotNil)
+	c.Assert(time.Since(start), Less, time.Second)
+	pdClient.setSlow(false)
+}
+
+// failPDClient makes GetTS fail once fail is set.
+type failPDClient struct {
+	pd.Client
+	sync.RWMutex
+	fail bool
+}
+
+func (c *failPDClient) setFail(fail bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.fail = fail
+}
+
+func (c *failPDClient) GetTS(ctx goctx.Context) (int64, int64, error) {
+	c.RLock()
+	fail := c.fail
+	c.RUnlock()
+	if fail {
+		return 0, 0, errors.New("mock PD unavailable")
+	}
+	return c.Client.GetTS(ctx)
+}
+
+func (s *testStoreSuite) TestFallbackOracle(c *C) {
+	newStore := func(opts ...MockTiKVStoreOption) (*tikvStore, *failPDClient) {
+		pdClient := &failPDClient{}
+		opts = append(opts, WithMaxBackoff(50), WithHijackPDClient(func(cli pd.Client) pd.Client {
+			pdClient.Client = cli
+			return pdClient
+		}))
+		store, err := NewMockTikvStore(opts...)
+		c.Assert(err, IsNil)
+		return store.(*tikvStore), pdClient
+	}
+
+	// PD failure is returned if the fallback is not enabled.
+	store, pdClient := newStore()
+	pdClient.setFail(true)
+	_, err := store.Begin()
+	c.Assert(err, NotNil)
+	_, err = store.CurrentVersion()
+	c.Assert(err, NotNil)
+	store.Close()
+
+	store, pdClient = newStore(WithFallbackOracle(oracles.NewLocalOracle()))
+	defer store.Close()
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.(*tikvTxn).Linearizable(), IsTrue)
+	c.Assert(txn.Set([]byte("fallback_key"), []byte("v")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+
+	pdClient.setFail(true)
+	txn, err = store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.(*tikvTxn).Linearizable(), IsFalse)
+	val, err := txn.Get([]byte("fallback_key"))
+	c.Assert(err, IsNil)
+	c.Assert(val, BytesEquals, []byte("v"))
+	c.Assert(errors.Cause(txn.Set([]byte("fallback_key"), []byte("v2"))), Equals, ErrReadOnlyTxn)
+	// The commit fails too, as the write is rejected.
+	c.Assert(errors.Cause(txn.Commit()), Equals, ErrReadOnlyTxn)
+	_, err = store.CurrentVersion()
+	c.Assert(err, IsNil)
+
+	pdClient.setFail(false)
+	txn, err = store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.(*tikvTxn).Linearizable(), IsTrue)
+	c.Assert(txn.Rollback(), IsNil)
+}
+
+// orderRecordClient records the order in which the stacked clients are called.
+type orderRecordClient struct {
+	Client
+	name  string
+	calls *[]string
+}
+
+func (c *orderRecordClient) SendReq(ctx goctx.Context, addr string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+	*c.calls = append(*c.calls, c.name)
+	return c.Client.SendReq(ctx, addr, req)
+}
+
+func (s *testStoreSuite) TestStackHijackClients(c *C) {
+	var calls []string
+	hijack := func(name string) func(Client) Client {
+		return func(cli Client) Client {
+			return &orderRecordClient{Client: cli, name: name, calls: &calls}
+		}
+	}
+	var pdWrapped []string
+	hijackPD := func(name string) func(pd.Client) pd.Client {
+		return func(cli pd.Client) pd.Client {
+			pdWrapped = append(pdWrapped, name)
+			return cli
+		}
+	}
+	store, err := NewMockTikvStore(
+		WithHijackClient(hijack("inner")),
+		WithHijackClient(hijack("outer")),
+		WithHijackPDClient(hijackPD("first")),
+		WithHijackPDClient(hijackPD("second")),
+	)
+	c.Assert(err, IsNil)
+	defer store.Close()
+	c.Assert(pdWrapped, DeepEquals, []string{"first", "second"})
+
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	_, err = txn.Get([]byte("key"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	c.Assert(calls, DeepEquals, []string{"outer", "inner"})
 }
 
-func (s *testStoreSuite) TestOracle(c *C) {
-	o := &mockOracle{}
-	s.store.oracle = o
+func (s *testStoreSuite) TestBeginReadOnly(c *C) {
+	txn, err := s.store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("ro_key"), []byte("value")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
 
-	ctx := goctx.Background()
-	t1, err := s.store.getTimestampWithRetry(NewBackoffer(100, ctx))
+	txn, err = s.store.BeginReadOnly()
 	c.Assert(err, IsNil)
-	t2, err := s.store.getTimestampWithRetry(NewBackoffer(100, ctx))
+	val, err := txn.Get([]byte("ro_key"))
 	c.Assert(err, IsNil)
-	c.Assert(t1, Less, t2)
+	c.Assert(val, BytesEquals, []byte("value"))
+	iter, err := txn.Seek([]byte("ro_key"))
+	c.Assert(err, IsNil)
+	c.Assert(iter.Valid(), IsTrue)
+	c.Assert([]byte(iter.Key()), BytesEquals, []byte("ro_key"))
+	iter.Close()
 
-	// Check retry.
-	var wg sync.WaitGroup
-	wg.Add(2)
+	c.Assert(errors.Cause(txn.Set([]byte("ro_key"), []byte("new"))), Equals, ErrReadOnlyTxn)
+	c.Assert(errors.Cause(txn.Delete([]byte("ro_key"))), Equals, ErrReadOnlyTxn)
+	c.Assert(errors.Cause(txn.LockKeys([]byte("ro_key"))), Equals, ErrReadOnlyTxn)
+	c.Assert(txn.IsReadOnly(), IsTrue)
+	c.Assert(errors.Cause(txn.Commit()), Equals, ErrReadOnlyTxn)
+	c.Assert(txn.Valid(), IsFalse)
 
-	o.disable()
-	go func() {
-		defer wg.Done()
-		time.Sleep(time.Millisecond * 100)
-		o.enable()
-	}()
+	// The commit succeeds if no write is attempted.
+	txn, err = s.store.BeginReadOnly()
+	c.Assert(err, IsNil)
+	_, err = txn.Get([]byte("ro_key"))
+	c.Assert(err, IsNil)
+	c.Assert(txn.Commit(), IsNil)
 
-	go func() {
-		defer wg.Done()
-		t3, err := s.store.getTimestampWithRetry(NewBackoffer(tsoMaxBackoff, ctx))
+	txn, err = s.store.Begin()
+	c.Assert(err, IsNil)
+	val, err = txn.Get([]byte("ro_key"))
+	c.Assert(err, IsNil)
+	c.Assert(val, BytesEquals, []byte("value"))
+	c.Assert(txn.Rollback(), IsNil)
+}
+
+func (s *testStoreSuite) TestListStores(c *C) {
+	cluster := mocktikv.NewCluster()
+	storeIDs, _, _, _ := mocktikv.BootstrapWithMultiStores(cluster, 3)
+	cluster.StopStore(storeIDs[1])
+	store, err := NewMockTikvStore(WithCluster(cluster))
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	stores, err := store.(*tikvStore).ListStores(NewBackoffer(100, goctx.Background()))
+	c.Assert(err, IsNil)
+	c.Assert(stores, HasLen, 3)
+	for i, meta := range stores {
+		c.Assert(meta.GetId(), Equals, storeIDs[i])
+		c.Assert(meta.GetAddress(), Equals, cluster.GetStore(storeIDs[i]).GetAddress())
+	}
+	c.Assert(stores[0].GetState(), Equals, metapb.StoreState_Up)
+	c.Assert(stores[1].GetState(), Equals, metapb.StoreState_Offline)
+
+	// A PD client which can't list stores.
+	store, err = NewMockTikvStore(WithHijackPDClient(func(cli pd.Client) pd.Client {
+		return &mockPDClient{client: cli}
+	}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	_, err = store.(*tikvStore).ListStores(NewBackoffer(100, goctx.Background()))
+	c.Assert(err, NotNil)
+}
+
+func (s *testStoreSuite) TestRequestObserver(c *C) {
+	var observed []tikvrpc.CmdType
+	s.store.SetRequestObserver(func(req *tikvrpc.Request, resp *tikvrpc.Response, elapsed time.Duration, err error) {
 		c.Assert(err, IsNil)
-		c.Assert(t2, Less, t3)
-		expired := s.store.oracle.IsExpired(t2, 50)
-		c.Assert(expired, IsTrue)
-	}()
+		c.Assert(resp, NotNil)
+		c.Assert(elapsed, GreaterEqual, time.Duration(0))
+		observed = append(observed, req.Type)
+	})
+	// The 2PC requests are sent by SendReq.
+	txn, err := s.store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("key"), []byte("value")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+	c.Assert(observed, DeepEquals, []tikvrpc.CmdType{tikvrpc.CmdPrewrite, tikvrpc.CmdCommit})
 
-	wg.Wait()
+	s.store.SetRequestObserver(nil)
+	txn, err = s.store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("key"), []byte("value")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+	c.Assert(observed, HasLen, 2)
 }
 
-func (s *testStoreSuite) TestBusyServerKV(c *C) {
-	client := newBusyClient(s.store.client)
-	s.store.client = client
+// isolationRecordClient records the isolation level of the Get requests it sends.
+type isolationRecordClient struct {
+	Client
+	levels []pb.IsolationLevel
+}
 
-	txn, err := s.store.Begin()
+func (c *isolationRecordClient) SendReq(ctx goctx.Context, addr string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+	if req.Type == tikvrpc.CmdGet {
+		c.levels = append(c.levels, req.Get.Context.GetIsolationLevel())
+	}
+	return c.Client.SendReq(ctx, addr, req)
+}
+
+// notLeaderOnceClient reports NotLeader for the first Get request it sends.
+type notLeaderOnceClient struct {
+	Client
+	leader   *metapb.Peer
+	reported bool
+}
+
+func (c *notLeaderOnceClient) SendReq(ctx goctx.Context, addr string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+	if req.Type == tikvrpc.CmdGet && !c.reported {
+		c.reported = true
+		return tikvrpc.GenRegionErrorResp(req, &errorpb.Error{NotLeader: &errorpb.NotLeader{Leader: c.leader}})
+	}
+	return c.Client.SendReq(ctx, addr, req)
+}
+
+func (s *testStoreSuite) TestSendReqWithStats(c *C) {
+	client := &notLeaderOnceClient{}
+	store, err := NewMockTikvStore(WithHijackClient(func(c Client) Client {
+		client.Client = c
+		return client
+	}))
 	c.Assert(err, IsNil)
-	err = txn.Set([]byte("key"), []byte("value"))
+	defer store.Close()
+	tikvStore := store.(*tikvStore)
+
+	bo := NewBackoffer(getMaxBackoff, goctx.Background())
+	loc, err := tikvStore.regionCache.LocateKey(bo, []byte("key"))
 	c.Assert(err, IsNil)
-	err = txn.Commit()
+	client.leader = tikvStore.regionCache.getRegionFromCache([]byte("key")).meta.GetPeers()[0]
+	ver, err := tikvStore.CurrentVersion()
 	c.Assert(err, IsNil)
+	newReq := func() *tikvrpc.Request {
+		return &tikvrpc.Request{
+			Type: tikvrpc.CmdGet,
+			Get: &pb.GetRequest{
+				Key:     []byte("key"),
+				Version: ver.Ver,
+			},
+		}
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+	resp, stats, err := tikvStore.SendReqWithStats(bo, newReq(), loc.Region, readTimeoutShort)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Get, NotNil)
+	c.Assert(stats, Equals, SendReqStats{Attempts: 2, LeaderChanged: true})
 
-	client.setBusy(true)
-	go func() {
-		defer wg.Done()
-		time.Sleep(time.Millisecond * 100)
-		client.setBusy(false)
-	}()
+	_, stats, err = tikvStore.SendReqWithStats(bo, newReq(), loc.Region, readTimeoutShort)
+	c.Assert(err, IsNil)
+	c.Assert(stats, Equals, SendReqStats{Attempts: 1})
+}
 
-	go func() {
-		defer wg.Done()
-		txn, err := s.store.Begin()
+// sleepClient sleeps before sending the Get requests.
+type sleepClient struct {
+	Client
+	sleep time.Duration
+}
+
+func (c *sleepClient) SendReq(ctx goctx.Context, addr string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+	if req.Type == tikvrpc.CmdGet {
+		time.Sleep(c.sleep)
+	}
+	return c.Client.SendReq(ctx, addr, req)
+}
+
+// warnRecordHook records the messages logged at the warn level.
+type warnRecordHook struct {
+	sync.Mutex
+	msgs []string
+}
+
+func (h *warnRecordHook) Levels() []log.Level {
+	return []log.Level{log.WarnLevel}
+}
+
+func (h *warnRecordHook) Fire(entry *log.Entry) error {
+	h.Lock()
+	h.msgs = append(h.msgs, entry.Message)
+	h.Unlock()
+	return nil
+}
+
+func (h *warnRecordHook) slowRequests() (msgs []string) {
+	h.Lock()
+	defer h.Unlock()
+	for _, msg := range h.msgs {
+		if strings.Contains(msg, "slow request") {
+			msgs = append(msgs, msg)
+		}
+	}
+	return
+}
+
+func (s *testStoreSuite) TestMaxRequestRate(c *C) {
+	newGetReq := func(c *C, store *tikvStore) (*tikvrpc.Request, RegionVerID) {
+		loc, err := store.regionCache.LocateKey(NewBackoffer(getMaxBackoff, goctx.Background()), []byte("key"))
 		c.Assert(err, IsNil)
-		val, err := txn.Get([]byte("key"))
+		ver, err := store.CurrentVersion()
 		c.Assert(err, IsNil)
-		c.Assert(val, BytesEquals, []byte("value"))
-	}()
+		return &tikvrpc.Request{
+			Type: tikvrpc.CmdGet,
+			Get:  &pb.GetRequest{Key: []byte("key"), Version: ver.Ver},
+		}, loc.Region
+	}
 
-	wg.Wait()
+	// The requests beyond the burst wait for the tokens.
+	store, err := NewMockTikvStore(WithMaxRequestRate(20, false))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	req, region := newGetReq(c, ts)
+	start := time.Now()
+	for i := 0; i < 40; i++ {
+		_, err = ts.SendReq(NewBackoffer(getMaxBackoff, goctx.Background()), req, region, readTimeoutShort)
+		c.Assert(err, IsNil)
+	}
+	elapsed := time.Since(start)
+	c.Assert(elapsed, GreaterEqual, 900*time.Millisecond)
+	c.Assert(elapsed, Less, 3*time.Second)
+
+	// The waiting is aborted once the backoffer's context is done. The tokens
+	// are borrowed first, since some may be refilled if the loop above is slow.
+	for i := 0; i < 10; i++ {
+		ts.reqLimiter.take(true)
+	}
+	ctx, cancel := goctx.WithTimeout(goctx.Background(), 10*time.Millisecond)
+	_, err = ts.SendReq(NewBackoffer(getMaxBackoff, ctx), req, region, readTimeoutShort)
+	cancel()
+	c.Assert(errors.Cause(err), Equals, goctx.DeadlineExceeded)
+
+	// The requests beyond the burst are rejected.
+	// A low rate is used so no token is refilled while sending the burst.
+	store, err = NewMockTikvStore(WithMaxRequestRate(2, true))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts = store.(*tikvStore)
+	req, region = newGetReq(c, ts)
+	for i := 0; i < 2; i++ {
+		_, err = ts.SendReq(NewBackoffer(getMaxBackoff, goctx.Background()), req, region, readTimeoutShort)
+		c.Assert(err, IsNil)
+	}
+	_, err = ts.SendReq(NewBackoffer(getMaxBackoff, goctx.Background()), req, region, readTimeoutShort)
+	c.Assert(errors.Cause(err), Equals, ErrRateLimited)
+	c.Assert(IsRetryableError(err), IsTrue)
+	time.Sleep(600 * time.Millisecond)
+	_, err = ts.SendReq(NewBackoffer(getMaxBackoff, goctx.Background()), req, region, readTimeoutShort)
+	c.Assert(err, IsNil)
+
+	// The store is unlimited by default.
+	c.Assert(s.store.reqLimiter, IsNil)
+	_, opts, err := parsePath("tikv://127.0.0.1:2379?maxReqPerSec=5000&rejectRateLimited=true")
+	c.Assert(err, IsNil)
+	c.Assert(opts.maxReqPerSec, Equals, 5000)
+	c.Assert(opts.rejectRateLimited, IsTrue)
+	_, _, err = parsePath("tikv://127.0.0.1:2379?maxReqPerSec=0")
+	c.Assert(err, NotNil)
 }
 
-func (s *testStoreSuite) TestBusyServerCop(c *C) {
-	client := newBusyClient(s.store.client)
-	s.store.client = client
-	_, err := tidb.BootstrapSession(s.store)
+// deadTSOPDClient fails getting the timestamp once it's dead, like the client
+// connected to a dead PD.
+type deadTSOPDClient struct {
+	pd.Client
+	dead   int32
+	calls  int32
+	closed chan struct{}
+}
+
+func (c *deadTSOPDClient) GetTS(ctx goctx.Context) (int64, int64, error) {
+	if atomic.LoadInt32(&c.dead) == 0 {
+		return c.Client.GetTS(ctx)
+	}
+	atomic.AddInt32(&c.calls, 1)
+	return 0, 0, errors.New("pd is dead")
+}
+
+func (c *deadTSOPDClient) Close() {
+	c.Client.Close()
+	close(c.closed)
+}
+
+func (s *testStoreSuite) TestPDReconnect(c *C) {
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithSingleStore(cluster)
+	// connects counts the PD clients created after the initial one.
+	var connects int32
+	newStore := func(opts ...MockTiKVStoreOption) (*tikvStore, *deadTSOPDClient) {
+		var dead *deadTSOPDClient
+		opts = append(opts, WithCluster(cluster), WithOracleUpdateInterval(time.Minute), WithoutSafePointUpdate(),
+			WithRetryPolicy(func() RetryPolicy { return &cappedRetryPolicy{max: 10} }),
+			WithHijackPDClient(func(c pd.Client) pd.Client {
+				if dead != nil {
+					atomic.AddInt32(&connects, 1)
+					return c
+				}
+				dead = &deadTSOPDClient{Client: c, closed: make(chan struct{})}
+				return dead
+			}))
+		store, err := NewMockTikvStore(opts...)
+		c.Assert(err, IsNil)
+		atomic.StoreInt32(&dead.dead, 1)
+		return store.(*tikvStore), dead
+	}
+
+	// The store keeps using the dead client by default.
+	store, dead := newStore()
+	_, err := store.CurrentVersion()
+	c.Assert(err, NotNil)
+	c.Assert(atomic.LoadInt32(&dead.calls), Equals, int32(11))
+	c.Assert(atomic.LoadInt32(&connects), Equals, int32(0))
+	c.Assert(store.Close(), IsNil)
+
+	// The client is replaced after 3 failures, then the store resumes issuing timestamps.
+	store, dead = newStore(WithPDReconnect(3))
+	defer store.Close()
+	ver1, err := store.CurrentVersion()
+	c.Assert(err, IsNil)
+	c.Assert(atomic.LoadInt32(&dead.calls), Equals, int32(3))
+	c.Assert(atomic.LoadInt32(&connects), Equals, int32(1))
+	select {
+	case <-dead.closed:
+	default:
+		c.Fatal("the dead pd client isn't closed")
+	}
+	ver2, err := store.CurrentVersion()
+	c.Assert(err, IsNil)
+	c.Assert(ver2.Cmp(ver1), Greater, 0)
+	c.Assert(atomic.LoadInt32(&connects), Equals, int32(1))
+	// The region cache uses the new client too.
+	_, err = store.regionCache.LocateKey(NewBackoffer(100, goctx.Background()), []byte("a"))
 	c.Assert(err, IsNil)
 
-	session, err := tidb.CreateSession(s.store)
+	_, opts, err := parsePath("tikv://127.0.0.1:2379?pdReconnectAfter=5")
 	c.Assert(err, IsNil)
+	c.Assert(opts.pdReconnectAfter, Equals, 5)
+	_, _, err = parsePath("tikv://127.0.0.1:2379?pdReconnectAfter=0")
+	c.Assert(err, NotNil)
+}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+func (s *testStoreSuite) TestSlowRequestLog(c *C) {
+	hook := &warnRecordHook{}
+	logger := log.StandardLogger()
+	defer func(hooks log.LevelHooks) { logger.Hooks = hooks }(logger.Hooks)
+	logger.Hooks = make(log.LevelHooks)
+	logger.Hooks.Add(hook)
+
+	client := &sleepClient{}
+	store, err := NewMockTikvStore(WithSlowRequestLog(50*time.Millisecond), WithHijackClient(func(c Client) Client {
+		client.Client = c
+		return client
+	}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	tikvStore := store.(*tikvStore)
 
-	client.setBusy(true)
-	go func() {
-		defer wg.Done()
-		time.Sleep(time.Millisecond * 100)
-		client.setBusy(false)
-	}()
+	bo := NewBackoffer(getMaxBackoff, goctx.Background())
+	loc, err := tikvStore.regionCache.LocateKey(bo, []byte("key"))
+	c.Assert(err, IsNil)
+	ver, err := tikvStore.CurrentVersion()
+	c.Assert(err, IsNil)
+	req := &tikvrpc.Request{
+		Type: tikvrpc.CmdGet,
+		Get: &pb.GetRequest{
+			Key:     []byte("key"),
+			Version: ver.Ver,
+		},
+	}
+
+	_, err = tikvStore.SendReq(bo, req, loc.Region, readTimeoutShort)
+	c.Assert(err, IsNil)
+	c.Assert(hook.slowRequests(), HasLen, 0)
+
+	client.sleep = 100 * time.Millisecond
+	_, err = tikvStore.SendReq(bo, req, loc.Region, readTimeoutShort)
+	c.Assert(err, IsNil)
+	msgs := hook.slowRequests()
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(strings.Contains(msgs[0], fmt.Sprintf("slow request Get to region %d", loc.Region.id)), IsTrue, Commentf("%s", msgs[0]))
+}
+
+func (s *testStoreSuite) TestSendReqWithIsolation(c *C) {
+	client := &isolationRecordClient{}
+	store, err := NewMockTikvStore(WithHijackClient(func(c Client) Client {
+		client.Client = c
+		return client
+	}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	tikvStore := store.(*tikvStore)
+
+	bo := NewBackoffer(getMaxBackoff, goctx.Background())
+	loc, err := tikvStore.regionCache.LocateKey(bo, []byte("key"))
+	c.Assert(err, IsNil)
+	ver, err := tikvStore.CurrentVersion()
+	c.Assert(err, IsNil)
+	newReq := func() *tikvrpc.Request {
+		return &tikvrpc.Request{
+			Type: tikvrpc.CmdGet,
+			Get: &pb.GetRequest{
+				Key:     []byte("key"),
+				Version: ver.Ver,
+			},
+		}
+	}
+
+	_, err = tikvStore.SendReqWithIsolation(bo, newReq(), loc.Region, readTimeoutShort, pb.IsolationLevel_RC)
+	c.Assert(err, IsNil)
+	_, err = tikvStore.SendReq(bo, newReq(), loc.Region, readTimeoutShort)
+	c.Assert(err, IsNil)
+	c.Assert(client.levels, DeepEquals, []pb.IsolationLevel{pb.IsolationLevel_RC, pb.IsolationLevel_SI})
+}
+
+func (s *testStoreSuite) TestReopenWithPath(c *C) {
+	path, err := ioutil.TempDir("", "mock-tikv")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(path)
+
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithSingleStore(cluster)
+	store, err := NewMockTikvStore(WithCluster(cluster), WithPath(path))
+	c.Assert(err, IsNil)
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("key"), []byte("value")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+	c.Assert(store.Close(), IsNil)
+
+	store, err = NewMockTikvStore(WithCluster(cluster), WithPath(path))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	txn, err = store.Begin()
+	c.Assert(err, IsNil)
+	val, err := txn.Get([]byte("key"))
+	c.Assert(err, IsNil)
+	c.Assert(val, BytesEquals, []byte("value"))
+}
+
+// closeOrderClient checks whether the safepoint updater has exited when it's closed.
+type closeOrderClient struct {
+	Client
+	updaterExited   *int32
+	exitedWhenClose bool
+}
+
+func (c *closeOrderClient) Close() error {
+	c.exitedWhenClose = atomic.LoadInt32(c.updaterExited) == 1
+	return c.Client.Close()
+}
+
+func (s *testStoreSuite) TestCloseWaitsSafePointUpdater(c *C) {
+	var exited int32
+	client := &closeOrderClient{updaterExited: &exited}
+	store, err := NewMockTikvStore(WithHijackClient(func(cli Client) Client {
+		client.Client = cli
+		return client
+	}))
+	c.Assert(err, IsNil)
+	tikvStore := store.(*tikvStore)
 
+	// Simulate a safepoint updater which is slow to quit.
+	tikvStore.spWg.Add(1)
 	go func() {
-		defer wg.Done()
-		rs, err := session.Execute(`SELECT variable_value FROM mysql.tidb WHERE variable_name="bootstrapped"`)
-		c.Assert(err, IsNil)
-		row, err := rs[0].Next()
-		c.Assert(err, IsNil)
-		c.Assert(row, NotNil)
-		c.Assert(row.Data[0].GetString(), Equals, "True")
+		defer tikvStore.spWg.Done()
+		<-tikvStore.spMsg
+		time.Sleep(10 * time.Millisecond)
+		atomic.StoreInt32(&exited, 1)
 	}()
+	c.Assert(store.Close(), IsNil)
+	c.Assert(client.exitedWhenClose, IsTrue)
+}
+
+// latencyClient delays the prewrite and commit requests.
+type latencyClient struct {
+	Client
+	prewriteLatency time.Duration
+	commitLatency   time.Duration
+}
+
+func (c *latencyClient) SendReq(ctx goctx.Context, addr string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+	switch req.Type {
+	case tikvrpc.CmdPrewrite:
+		time.Sleep(c.prewriteLatency)
+	case tikvrpc.CmdCommit:
+		time.Sleep(c.commitLatency)
+	}
+	return c.Client.SendReq(ctx, addr, req)
+}
+
+func (s *testStoreSuite) TestCommitDetails(c *C) {
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithMultiRegions(cluster, []byte("b"), []byte("d"))
+	store, err := NewMockTikvStore(WithCluster(cluster), WithHijackClient(func(c Client) Client {
+		return &latencyClient{Client: c, prewriteLatency: 30 * time.Millisecond, commitLatency: 10 * time.Millisecond}
+	}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.(*tikvTxn).CommitDetails(), IsNil)
+	for _, key := range []string{"a", "b", "c", "e"} {
+		c.Assert(txn.Set([]byte(key), []byte("value")), IsNil)
+	}
+	c.Assert(txn.Commit(), IsNil)
+	detail := txn.(*tikvTxn).CommitDetails()
+	c.Assert(detail, NotNil)
+	c.Assert(detail.PrewriteTime, GreaterEqual, 30*time.Millisecond)
+	c.Assert(detail.CommitTime, GreaterEqual, 10*time.Millisecond)
+	c.Assert(detail.RegionCount, Equals, int32(3))
+
+	// A txn writing nothing doesn't run 2PC.
+	txn, err = store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Commit(), IsNil)
+	c.Assert(txn.(*tikvTxn).CommitDetails(), IsNil)
+}
 
+func (s *testStoreSuite) TestPrewarmRegions(c *C) {
+	cluster := mocktikv.NewCluster()
+	mocktikv.BootstrapWithMultiRegions(cluster, []byte("b"), []byte("d"), []byte("f"))
+	store, err := NewMockTikvStore(WithCluster(cluster))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	ts := store.(*tikvStore)
+	cachedRegions := func() int {
+		ts.regionCache.mu.RLock()
+		defer ts.regionCache.mu.RUnlock()
+		return len(ts.regionCache.mu.regions)
+	}
+
+	c.Assert(ts.PrewarmRegions(NewBackoffer(100, goctx.Background()), []byte("c"), []byte("e")), IsNil)
+	c.Assert(cachedRegions(), Equals, 2)
+	// The end key is exclusive.
+	c.Assert(ts.PrewarmRegions(NewBackoffer(100, goctx.Background()), []byte("a"), []byte("b")), IsNil)
+	c.Assert(cachedRegions(), Equals, 3)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Check(ts.PrewarmRegions(NewBackoffer(100, goctx.Background()), nil, nil), IsNil)
+		}()
+	}
 	wg.Wait()
+	c.Assert(cachedRegions(), Equals, 4)
 }
 
 var errStopped = errors.New("stopped")
@@ -218,6 +2151,10 @@ func (o *mockOracle) GetTimestampAsync(ctx goctx.Context) oracle.Future {
 	return &mockOracleFuture{o, ctx}
 }
 
+func (o *mockOracle) GetLowResolutionTimestamp() (uint64, error) {
+	return o.GetTimestamp(goctx.Background())
+}
+
 func (o *mockOracle) IsExpired(lockTimestamp uint64, TTL uint64) bool {
 	o.RLock()
 	defer o.RUnlock()
@@ -390,3 +2327,127 @@ func (s *testStoreSuite) TestRequestPriority(c *C) {
 	}
 	iter.Close()
 }
+
+func (s *testStoreSuite) TestBeginBatch(c *C) {
+	_, err := s.store.BeginBatch(0)
+	c.Assert(err, NotNil)
+
+	txn, err := s.store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("batch"), []byte("v1")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+
+	txns, err := s.store.BeginBatch(3)
+	c.Assert(err, IsNil)
+	c.Assert(txns, HasLen, 3)
+
+	// A write committed after the batch began is invisible to all of them.
+	txn, err = s.store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("batch"), []byte("v2")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+
+	for _, t := range txns {
+		c.Assert(t.StartTS(), Equals, txns[0].StartTS())
+		val, err := t.Get([]byte("batch"))
+		c.Assert(err, IsNil)
+		c.Assert(string(val), Equals, "v1")
+	}
+	c.Assert(txns[0].StartTS(), Less, txn.StartTS())
+
+	// They write the same key, only the first committed one succeeds.
+	c.Assert(txns[0].Set([]byte("batch1"), []byte("a")), IsNil)
+	c.Assert(txns[0].Commit(), IsNil)
+	c.Assert(txns[1].Set([]byte("batch1"), []byte("b")), IsNil)
+	c.Assert(txns[1].Commit(), NotNil)
+	c.Assert(txns[2].Rollback(), IsNil)
+}
+
+type recordRequestClient struct {
+	Client
+	mu       sync.Mutex
+	types    []tikvrpc.CmdType
+	pris     []pb.CommandPri
+	timeouts []time.Duration
+}
+
+func (c *recordRequestClient) SendReq(ctx goctx.Context, addr string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+	deadline, _ := ctx.Deadline()
+	c.mu.Lock()
+	c.types = append(c.types, req.Type)
+	c.pris = append(c.pris, req.Priority)
+	c.timeouts = append(c.timeouts, time.Until(deadline))
+	c.mu.Unlock()
+	return c.Client.SendReq(ctx, addr, req)
+}
+
+func (s *testStoreSuite) TestGetSnapshotWithOptions(c *C) {
+	var client *recordRequestClient
+	store, err := NewMockTikvStore(WithHijackClient(func(c Client) Client {
+		client = &recordRequestClient{Client: c}
+		return client
+	}))
+	c.Assert(err, IsNil)
+	defer store.Close()
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("key"), []byte("value")), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+	ver, err := store.CurrentVersion()
+	c.Assert(err, IsNil)
+
+	check := func(snapshot kv.Snapshot, pri pb.CommandPri, minScanTimeout, maxScanTimeout time.Duration) {
+		client.mu.Lock()
+		client.types, client.pris, client.timeouts = nil, nil, nil
+		client.mu.Unlock()
+		_, err := snapshot.Get([]byte("key"))
+		c.Assert(err, IsNil)
+		_, err = snapshot.BatchGet([]kv.Key{[]byte("key")})
+		c.Assert(err, IsNil)
+		iter, err := snapshot.Seek([]byte("key"))
+		c.Assert(err, IsNil)
+		iter.Close()
+
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		c.Assert(client.types, DeepEquals, []tikvrpc.CmdType{tikvrpc.CmdGet, tikvrpc.CmdBatchGet, tikvrpc.CmdScan})
+		for i, p := range client.pris {
+			c.Assert(p, Equals, pri, Commentf("%s", client.types[i]))
+		}
+		c.Assert(client.timeouts[2] > minScanTimeout && client.timeouts[2] <= maxScanTimeout, IsTrue, Commentf("%v", client.timeouts[2]))
+	}
+
+	snapshot, err := store.GetSnapshot(ver)
+	c.Assert(err, IsNil)
+	check(snapshot, pb.CommandPri_Normal, readTimeoutMedium-time.Second, readTimeoutMedium)
+	snapshot, err = store.(*tikvStore).GetSnapshotWithOptions(ver, SnapshotOptions{Priority: pb.CommandPri_Low, ScanTimeout: 3 * time.Second})
+	c.Assert(err, IsNil)
+	check(snapshot, pb.CommandPri_Low, 2*time.Second, 3*time.Second)
+}
+
+func (s *testStoreSuite) TestIsRetryableError(c *C) {
+	bo := NewBackoffer(1, goctx.Background())
+	var boErr error
+	for boErr == nil {
+		boErr = bo.Backoff(boRegionMiss, errors.New("region miss"))
+	}
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{errors.New("unknown"), false},
+		{terror.ErrResultUndetermined, false},
+		{goctx.Canceled, false},
+		{errors.Annotate(errors.New("region error"), txnRetryableMark), true},
+		{boErr, true},
+		{errors.Trace(kv.ErrLockConflict), true},
+		{kv.ErrRetryable, true},
+		{errors.New("dial tcp 127.0.0.1:2379: i/o timeout"), true},
+		{errors.Trace(ErrStoreClosing), true},
+		{errors.Trace(ErrRateLimited), true},
+	}
+	for _, t := range tests {
+		c.Assert(IsRetryableError(t.err), Equals, t.retryable, Commentf("%v", t.err))
+	}
+}
@@ -40,29 +40,54 @@ type tikvTxn struct {
 	valid     bool
 	lockKeys  [][]byte
 	dirty     bool
+	// readOnly is set by BeginReadOnly, or if the startTS is from the fallback
+	// oracle, writes are rejected and commit skips the 2PC.
+	readOnly bool
+	// writeRejected is set if a write is rejected by readOnly, then Commit fails
+	// with ErrReadOnlyTxn too, so the callers ignoring the rejection notice it.
+	writeRejected bool
+	// nonLinearizable is set if the startTS is from the fallback oracle, the txn is read-only.
+	nonLinearizable bool
+	// commitDetails is set after the txn is committed by 2PC.
+	commitDetails *CommitDetails
+	// pinnedCommitTS is set by BeginWithTS, 2PC commits with it instead of
+	// getting the commitTS from PD.
+	pinnedCommitTS uint64
 }
 
 func newTiKVTxn(store *tikvStore) (*tikvTxn, error) {
-	bo := NewBackoffer(tsoMaxBackoff, goctx.Background())
-	startTS, err := store.getTimestampWithRetry(bo)
+	bo := store.newBackoffer(tsoMaxBackoff, goctx.Background())
+	startTS, fallback, err := store.getTimestampWithFallback(bo)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	return newTikvTxnWithStartTS(store, startTS)
+	txn, err := newTikvTxnWithStartTS(store, startTS)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if fallback {
+		// The startTS isn't ordered with the commitTS from PD, writing with it
+		// may break the snapshot isolation.
+		txn.readOnly = true
+		txn.nonLinearizable = true
+	}
+	return txn, nil
 }
 
 // newTikvTxnWithStartTS creates a txn with startTS.
 func newTikvTxnWithStartTS(store *tikvStore, startTS uint64) (*tikvTxn, error) {
 	ver := kv.NewVersion(startTS)
 	snapshot := newTiKVSnapshot(store, ver)
-	return &tikvTxn{
+	txn := &tikvTxn{
 		snapshot:  snapshot,
 		us:        kv.NewUnionStore(snapshot),
 		store:     store,
 		startTS:   startTS,
 		startTime: monotime.Now(),
 		valid:     true,
-	}, nil
+	}
+	store.trackTxn(txn)
+	return txn, nil
 }
 
 // Implement transaction interface.
@@ -80,6 +105,10 @@ func (txn *tikvTxn) Get(k kv.Key) ([]byte, error) {
 
 func (txn *tikvTxn) Set(k kv.Key, v []byte) error {
 	txnCmdCounter.WithLabelValues("set").Inc()
+	if txn.readOnly {
+		txn.writeRejected = true
+		return errors.Trace(ErrReadOnlyTxn)
+	}
 
 	txn.dirty = true
 	return txn.us.Set(k, v)
@@ -108,6 +137,10 @@ func (txn *tikvTxn) SeekReverse(k kv.Key) (kv.Iterator, error) {
 
 func (txn *tikvTxn) Delete(k kv.Key) error {
 	txnCmdCounter.WithLabelValues("delete").Inc()
+	if txn.readOnly {
+		txn.writeRejected = true
+		return errors.Trace(ErrReadOnlyTxn)
+	}
 
 	txn.dirty = true
 	return txn.us.Delete(k)
@@ -140,6 +173,13 @@ func (txn *tikvTxn) Commit() error {
 	start := time.Now()
 	defer func() { txnCmdHistogram.WithLabelValues("commit").Observe(time.Since(start).Seconds()) }()
 
+	// Nothing can be written in a read-only txn, skip the 2PC.
+	if txn.readOnly {
+		if txn.writeRejected {
+			return errors.Trace(ErrReadOnlyTxn)
+		}
+		return nil
+	}
 	if err := txn.us.CheckLazyConditionPairs(); err != nil {
 		return errors.Trace(err)
 	}
@@ -158,11 +198,26 @@ func (txn *tikvTxn) Commit() error {
 	}
 	committer.writeFinishBinlog(binlog.BinlogType_Commit, int64(committer.commitTS))
 	txn.commitTS = committer.commitTS
+	txn.commitDetails = &committer.detail
 	return nil
 }
 
+// CommitDetails returns the details of committing the txn, it returns nil if
+// the txn hasn't been committed or nothing is written by the txn.
+func (txn *tikvTxn) CommitDetails() *CommitDetails {
+	return txn.commitDetails
+}
+
+// Linearizable returns false if the startTS of the txn is from the fallback
+// oracle because PD is unavailable, it may not see the data committed before
+// it began.
+func (txn *tikvTxn) Linearizable() bool {
+	return !txn.nonLinearizable
+}
+
 func (txn *tikvTxn) close() error {
 	txn.valid = false
+	txn.store.untrackTxn(txn)
 	return nil
 }
 
@@ -179,6 +234,10 @@ func (txn *tikvTxn) Rollback() error {
 
 func (txn *tikvTxn) LockKeys(keys ...kv.Key) error {
 	txnCmdCounter.WithLabelValues("lock_keys").Inc()
+	if txn.readOnly {
+		txn.writeRejected = true
+		return errors.Trace(ErrReadOnlyTxn)
+	}
 	for _, key := range keys {
 		txn.lockKeys = append(txn.lockKeys, key)
 	}
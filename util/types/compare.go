@@ -13,6 +13,12 @@
 
 package types
 
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
 // CompareInt64 returns an integer comparing the int64 x to y.
 func CompareInt64(x, y int64) int {
 	if x < y {
@@ -56,3 +62,35 @@ func CompareString(x, y string) int {
 
 	return 1
 }
+
+// CompareStringWithCollation returns an integer comparing the string x to y
+// under the collation. Case insensitive collations, whose names end with "_ci",
+// approximate utf8_general_ci: the trailing spaces are ignored and the runes are
+// compared by their simple upper case mapping, so accented letters still differ
+// from the base ones and there are no expansions like 'ß' = 'ss'. Other
+// collations compare the bytes.
+func CompareStringWithCollation(x, y, collation string) int {
+	if !strings.HasSuffix(collation, "_ci") {
+		return CompareString(x, y)
+	}
+	x, y = strings.TrimRight(x, " "), strings.TrimRight(y, " ")
+	for len(x) > 0 && len(y) > 0 {
+		rx, nx := foldRune(x)
+		ry, ny := foldRune(y)
+		if rx != ry {
+			return CompareInt64(int64(rx), int64(ry))
+		}
+		x, y = x[nx:], y[ny:]
+	}
+	return CompareInt64(int64(len(x)), int64(len(y)))
+}
+
+// foldRune decodes the first rune of s and returns its upper case and width.
+// An invalid byte is mapped past utf8.MaxRune, so it sorts after all the runes.
+func foldRune(s string) (rune, int) {
+	r, n := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError && n == 1 {
+		return utf8.MaxRune + 1 + rune(s[0]), n
+	}
+	return unicode.ToUpper(r), n
+}
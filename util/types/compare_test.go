@@ -14,6 +14,7 @@
 package types
 
 import (
+	"testing"
 	"time"
 
 	. "github.com/pingcap/check"
@@ -186,3 +187,41 @@ func (s *testCompareSuite) TestCompareDatum(c *C) {
 		c.Assert(ret, Equals, -t.ret, comment)
 	}
 }
+
+func (s *testCompareSuite) TestCompareDatumWithCollation(c *C) {
+	defer testleak.AfterTest(c)()
+	cmpTbl := []struct {
+		lhs       interface{}
+		rhs       interface{}
+		collation string
+		ret       int // 0, 1, -1
+	}{
+		{"a", "B", "utf8_bin", 1},
+		{"a", "B", "utf8_general_ci", -1},
+		{"abc", "ABC", "utf8_bin", 1},
+		{"abc", "ABC", "utf8_general_ci", 0},
+		{[]byte("abc"), "ABD", "utf8_general_ci", -1},
+		{"1", int64(2), "utf8_general_ci", -1},
+		{nil, "a", "utf8_general_ci", -1},
+		{"abc  ", "ABC", "utf8_general_ci", 0},
+		{"abc ", "ABC", "utf8_bin", 1},
+		{"ab", "ABC", "utf8_general_ci", -1},
+		{"ÉTÉ", "été", "utf8_general_ci", 0},
+		{"é", "F", "utf8_general_ci", 1},
+		{"a\xff", "Aé", "utf8_general_ci", 1},
+	}
+	sc := new(variable.StatementContext)
+	for i, t := range cmpTbl {
+		comment := Commentf("%d %v %v %s", i, t.lhs, t.rhs, t.collation)
+		lhs, rhs := NewDatum(t.lhs), NewDatum(t.rhs)
+		ret, err := lhs.CompareDatumWithCollation(sc, rhs, t.collation)
+		c.Assert(err, IsNil)
+		c.Assert(ret, Equals, t.ret, comment)
+	}
+
+	// Comparing under the case insensitive collation doesn't allocate.
+	allocs := testing.AllocsPerRun(10, func() {
+		CompareStringWithCollation("Hello World ", "hello world", "utf8_general_ci")
+	})
+	c.Assert(allocs, Equals, float64(0))
+}
@@ -384,6 +384,19 @@ func (d *Datum) SetValue(val interface{}) {
 	}
 }
 
+// CompareDatumWithCollation compares datum to another datum, strings are compared
+// under the collation.
+func (d *Datum) CompareDatumWithCollation(sc *variable.StatementContext, ad Datum, collation string) (int, error) {
+	switch d.k {
+	case KindString, KindBytes:
+		switch ad.k {
+		case KindString, KindBytes:
+			return CompareStringWithCollation(d.GetString(), ad.GetString(), collation), nil
+		}
+	}
+	return d.CompareDatum(sc, ad)
+}
+
 // CompareDatum compares datum to another datum.
 // TODO: return error properly.
 func (d *Datum) CompareDatum(sc *variable.StatementContext, ad Datum) (int, error) {